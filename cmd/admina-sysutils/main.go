@@ -9,8 +9,12 @@ import (
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
 )
 
+// Version はビルド時に -ldflags "-X main.Version=..." で設定されます
+var Version = "dev"
+
 func main() {
 	startTime := time.Now()
+	cli.Version = Version
 
 	logger.PrintErr("Executed command: > %s\n", strings.TrimPrefix(strings.Join(os.Args, " "), os.Args[0]+" "))
 
@@ -198,6 +198,29 @@ func NewClient() *Client {
 	}
 }
 
+// OrganizationAPIKeyEnv returns the name of the environment variable holding the API key
+// for the given organization, e.g. ADMINA_API_KEY_12345.
+func OrganizationAPIKeyEnv(organizationID string) string {
+	suffix := strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || ('A' <= r && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(organizationID))
+	return "ADMINA_API_KEY_" + suffix
+}
+
+// NewOrganizationClient creates a client for the given organization.
+// The API key is read from OrganizationAPIKeyEnv(organizationID), falling back to ADMINA_API_KEY.
+func NewOrganizationClient(organizationID string) *Client {
+	client := NewClient()
+	client.organizationID = organizationID
+	if apiKey := os.Getenv(OrganizationAPIKeyEnv(organizationID)); apiKey != "" {
+		client.apiKey = apiKey
+	}
+	return client
+}
+
 // APIError represents an error response from the Admina API.
 type APIError struct {
 	StatusCode    int
@@ -472,6 +495,11 @@ func (c *Client) GetOrganization(ctx context.Context) (*Organization, error) {
 	return &org, nil
 }
 
+// OrganizationID returns the organization ID the client is configured for.
+func (c *Client) OrganizationID() string {
+	return c.organizationID
+}
+
 func (c *Client) Validate() error {
 	if c.organizationID == "" {
 		return fmt.Errorf("ADMINA_ORGANIZATION_ID is not set")
@@ -526,3 +554,31 @@ func (c *Client) DeleteIdentity(ctx context.Context, identityID string) error {
 
 	return nil
 }
+
+// UpdateIdentityRequest represents the request body for updating an identity.
+// Only non-nil fields are sent, so unspecified attributes are left unchanged.
+type UpdateIdentityRequest struct {
+	DisplayName    *string `json:"displayName,omitempty"`
+	EmployeeType   *string `json:"employeeType,omitempty"`
+	EmployeeStatus *string `json:"employeeStatus,omitempty"`
+}
+
+// UpdateIdentity updates attributes of an identity by ID
+func (c *Client) UpdateIdentity(ctx context.Context, identityID string, req *UpdateIdentityRequest) (*Identity, error) {
+	resp, err := c.doRequest(ctx, http.MethodPatch, fmt.Sprintf("/identity/%s", identityID), nil, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update identity: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := c.handleResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var identity Identity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &identity, nil
+}
@@ -69,6 +69,23 @@ func setupTestServer() (*httptest.Server, *Client) {
 			}`
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte(rawJSONResponse))
+		case "/api/v1/organizations/test-org/identity/1":
+			if r.Method != http.MethodPatch {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			identity := Identity{ID: "1", PeopleID: 1, DisplayName: "Test User", EmployeeStatus: "active"}
+			if status, ok := req["employeeStatus"]; ok {
+				identity.EmployeeStatus = status
+			}
+			if _, ok := req["displayName"]; ok {
+				// 指定していない項目は送信されない
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(identity)
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -164,6 +181,25 @@ func TestMergeIdentities(t *testing.T) {
 	}
 }
 
+func TestUpdateIdentity(t *testing.T) {
+	server, client := setupTestServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	status := "retired"
+	identity, err := client.UpdateIdentity(ctx, "1", &UpdateIdentityRequest{EmployeeStatus: &status})
+	if err != nil {
+		t.Fatalf("UpdateIdentity() error = %v", err)
+	}
+	if identity.EmployeeStatus != "retired" {
+		t.Errorf("UpdateIdentity() got status = %s, want retired", identity.EmployeeStatus)
+	}
+
+	if _, err := client.UpdateIdentity(ctx, "2", &UpdateIdentityRequest{EmployeeStatus: &status}); err == nil {
+		t.Errorf("UpdateIdentity() for unknown identity should return error")
+	}
+}
+
 func TestGetOrganization(t *testing.T) {
 	server, client := setupTestServer()
 	defer server.Close()
@@ -179,6 +215,51 @@ func TestGetOrganization(t *testing.T) {
 	}
 }
 
+func TestNewOrganizationClient(t *testing.T) {
+	originalAPIKey := os.Getenv("ADMINA_API_KEY")
+	originalOrgAPIKey := os.Getenv("ADMINA_API_KEY_ORG_1")
+	defer func() {
+		os.Setenv("ADMINA_API_KEY", originalAPIKey)
+		os.Setenv("ADMINA_API_KEY_ORG_1", originalOrgAPIKey)
+	}()
+
+	tests := []struct {
+		name       string
+		setupEnv   func()
+		wantAPIKey string
+	}{
+		{
+			name: "organization API key",
+			setupEnv: func() {
+				os.Setenv("ADMINA_API_KEY", "default-key")
+				os.Setenv("ADMINA_API_KEY_ORG_1", "org-key")
+			},
+			wantAPIKey: "org-key",
+		},
+		{
+			name: "fallback to default API key",
+			setupEnv: func() {
+				os.Setenv("ADMINA_API_KEY", "default-key")
+				os.Unsetenv("ADMINA_API_KEY_ORG_1")
+			},
+			wantAPIKey: "default-key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupEnv()
+			client := NewOrganizationClient("org-1")
+			if client.organizationID != "org-1" {
+				t.Errorf("NewOrganizationClient() organizationID = %v, want %v", client.organizationID, "org-1")
+			}
+			if client.apiKey != tt.wantAPIKey {
+				t.Errorf("NewOrganizationClient() apiKey = %v, want %v", client.apiKey, tt.wantAPIKey)
+			}
+		})
+	}
+}
+
 func TestValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -2,6 +2,7 @@ package mock
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
 )
@@ -12,6 +13,15 @@ type Client struct {
 	Cursor       string
 	Error        error                  // エラーケースのテスト用
 	MergeResults []admina.MergeIdentity // マージ結果を保持するフィールド
+
+	CreateRequests []*admina.CreateIdentityRequest // 作成を依頼されたアイデンティティ
+	CreateErrors   map[string]error                // メールアドレスごとの作成時のエラー
+
+	DeletedIDs   []string         // 削除を依頼されたアイデンティティID
+	DeleteErrors map[string]error // アイデンティティIDごとの削除時のエラー
+
+	UpdateRequests map[string]*admina.UpdateIdentityRequest // アイデンティティIDごとの変更内容
+	UpdateErrors   map[string]error                         // アイデンティティIDごとの変更時のエラー
 }
 
 func (m *Client) GetIdentities(ctx context.Context, cursor string) ([]admina.Identity, string, error) {
@@ -33,3 +43,74 @@ func (c *Client) MergeIdentities(ctx context.Context, fromPeopleID, toPeopleID i
 	c.MergeResults = append(c.MergeResults, result)
 	return result, nil
 }
+
+func (c *Client) CreateIdentity(ctx context.Context, req *admina.CreateIdentityRequest) (*admina.Identity, error) {
+	if c.Error != nil {
+		return nil, c.Error
+	}
+	if err := c.CreateErrors[req.PrimaryEmail]; err != nil {
+		return nil, err
+	}
+
+	c.CreateRequests = append(c.CreateRequests, req)
+	created := admina.Identity{
+		ID:             fmt.Sprintf("new-%d", len(c.CreateRequests)),
+		PeopleID:       9000 + len(c.CreateRequests),
+		DisplayName:    req.DisplayName,
+		EmployeeType:   req.EmployeeType,
+		EmployeeStatus: req.EmployeeStatus,
+		Email:          req.PrimaryEmail,
+	}
+	c.Identities = append(c.Identities, created)
+	return &created, nil
+}
+
+func (c *Client) DeleteIdentity(ctx context.Context, identityID string) error {
+	if c.Error != nil {
+		return c.Error
+	}
+	if err := c.DeleteErrors[identityID]; err != nil {
+		return err
+	}
+
+	c.DeletedIDs = append(c.DeletedIDs, identityID)
+	return nil
+}
+
+// UpdateIdentity は変更内容を記録し、変更後のアイデンティティを返します
+// Identities は他のテストと共有されることがあるため変更しません
+func (c *Client) UpdateIdentity(ctx context.Context, identityID string, req *admina.UpdateIdentityRequest) (*admina.Identity, error) {
+	if c.Error != nil {
+		return nil, c.Error
+	}
+	if err := c.UpdateErrors[identityID]; err != nil {
+		return nil, err
+	}
+
+	var updated *admina.Identity
+	for _, identity := range c.Identities {
+		if identity.ID == identityID {
+			identity := identity
+			updated = &identity
+			break
+		}
+	}
+	if updated == nil {
+		return nil, fmt.Errorf("identity %s not found", identityID)
+	}
+	if c.UpdateRequests == nil {
+		c.UpdateRequests = make(map[string]*admina.UpdateIdentityRequest)
+	}
+	c.UpdateRequests[identityID] = req
+
+	if req.DisplayName != nil {
+		updated.DisplayName = *req.DisplayName
+	}
+	if req.EmployeeType != nil {
+		updated.EmployeeType = *req.EmployeeType
+	}
+	if req.EmployeeStatus != nil {
+		updated.EmployeeStatus = *req.EmployeeStatus
+	}
+	return updated, nil
+}
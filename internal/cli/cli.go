@@ -7,15 +7,20 @@ import (
 	"os"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
 	"github.com/moneyforward-i/admina-sysutils/internal/organization"
 )
 
+// Version は manifest.json などに記録するツールのバージョンです
+var Version = "dev"
+
 // Run executes the CLI application with the given arguments
 func Run(args []string) error {
 	flags := flag.NewFlagSet("admina-sysutils", flag.ExitOnError)
 	helpFlag := flags.Bool("help", false, "Show help")
 	debugFlag := flags.Bool("debug", false, "Enable debug mode")
+	offlineFlag := flags.Bool("offline", false, "Use the local identity snapshot instead of the API")
 
 	if err := flags.Parse(args); err != nil {
 		return err
@@ -31,6 +36,22 @@ func Run(args []string) error {
 		return nil
 	}
 
+	// --output help は組織情報を取得せずに出力フォーマットの一覧を表示する
+	if isOutputHelp(flags.Args()) {
+		logger.Print("%s", identity.FormatHelp())
+		return nil
+	}
+
+	// compare は組織ごとのAPIキーで2つの組織を参照するため、既定の組織情報は取得しない
+	if isCompareCommand(flags.Args()) {
+		return executeCommand(flags, args, nil, *offlineFlag)
+	}
+
+	if *offlineFlag {
+		logger.LogInfo("Offline mode: organization lookup is skipped")
+		return executeCommand(flags, args, nil, true)
+	}
+
 	client := admina.NewClient()
 	if client == nil {
 		return fmt.Errorf("failed to initialize client")
@@ -44,7 +65,7 @@ func Run(args []string) error {
 
 	organization.PrintInfo(org)
 
-	if err := executeCommand(flags, client); err != nil {
+	if err := executeCommand(flags, args, org, false); err != nil {
 		return err
 	}
 	organization.PrintInfo(org)
@@ -52,22 +73,46 @@ func Run(args []string) error {
 }
 
 // executeCommand handles subcommand execution
-func executeCommand(flags *flag.FlagSet, client *admina.Client) error {
+func executeCommand(flags *flag.FlagSet, args []string, org *admina.Organization, offline bool) error {
 	switch flags.Arg(0) {
 	case "identity":
 		cmd := NewIdentityCommand()
+		cmd.organization = org
+		cmd.offline = offline
+		cmd.args = args
 		return cmd.Run(flags.Args()[1:])
 	default:
 		return fmt.Errorf("unknown command: %s\nRun 'admina-sysutils --help' for usage", flags.Arg(0))
 	}
 }
 
+// isCompareCommand は引数が identity compare かを返します
+func isCompareCommand(args []string) bool {
+	return len(args) >= 2 && args[0] == "identity" && args[1] == "compare"
+}
+
+// isOutputHelp は引数に --output help が含まれているかを返します
+func isOutputHelp(args []string) bool {
+	for i, arg := range args {
+		switch arg {
+		case "--output=help", "-output=help":
+			return true
+		case "--output", "-output":
+			if i+1 < len(args) && args[i+1] == "help" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func printHelp() {
-	logger.Print(`Usage: admina-sysutils [--help] [--debug] <command> [subcommand]
+	logger.Print(`Usage: admina-sysutils [--help] [--debug] [--offline] <command> [subcommand]
 
 Options:
   --help     Show help
   --debug    Enable debug mode
+  --offline  Use the local identity snapshot instead of the API
 
 Commands:
   identity   Identity management commands`)
@@ -5,7 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
 	"github.com/moneyforward-i/admina-sysutils/internal/identity"
@@ -20,8 +23,56 @@ type IdentityCommand struct {
 	childDomains *string
 	dryRun       *bool
 	autoApprove  *bool
+	review       *bool
 	noMask       *bool
 	outDir       *string
+	outDirMode   *string
+	cacheDir     *string
+	cacheTTL     *time.Duration
+	sameLocal    *bool
+	where        *string
+	offline      bool
+	organization *admina.Organization
+	// args は manifest.json に記録する実行時の引数です
+	args []string
+
+	domains            *string
+	managementTypes    *string
+	employeeTypes      *string
+	employeeStatuses   *string
+	search             *string
+	peopleID           *int
+	hasSecondaryEmails *string
+	hasMergedPeople    *string
+	sort               *string
+	fields             *string
+	limit              *int
+
+	rows       *string
+	columns    *string
+	group      *string
+	percent    *string
+	outputFile *string
+	template   *string
+
+	csvColumns   *string
+	csvEncoding  *string
+	csvDelimiter *string
+	fromCSV      *string
+	interval     *time.Duration
+	force        *bool
+	confirmCount *int
+	set          *string
+	afterMerge   *string
+
+	exportDecisions *string
+	decisions       *string
+
+	leftOrg  *string
+	rightOrg *string
+
+	minConfidence     *float64
+	minNameSimilarity *float64
 }
 
 // NewIdentityCommand creates a new identity command handler
@@ -30,13 +81,51 @@ func NewIdentityCommand() *IdentityCommand {
 		flags: flag.NewFlagSet("identity", flag.ExitOnError),
 	}
 
-	cmd.outputFormat = cmd.flags.String("output", "json", "出力フォーマット (json, markdown, pretty)")
+	cmd.outputFormat = cmd.flags.String("output", "json", "出力フォーマット (json, markdown, pretty, html, template, matrix では csv, tsv, xlsx も指定可能)")
+	cmd.template = cmd.flags.String("template", "", "--output template で使用するテンプレートファイル (builtin:<名前> で同梱のテンプレート)")
+	cmd.outputFile = cmd.flags.String("output-file", "", "結果を標準出力ではなく指定したファイルに書き出す (matrix)")
 	cmd.parentDomain = cmd.flags.String("parent-domain", "", "マージ先となる親ドメイン (例: example.com)")
 	cmd.childDomains = cmd.flags.String("child-domains", "", "マージ元となる子ドメイン（カンマ区切り）(例: sub1.example.com,sub2.example.com)")
 	cmd.dryRun = cmd.flags.Bool("dry-run", false, "マージ操作のシミュレーションを実行")
 	cmd.autoApprove = cmd.flags.Bool("y", false, "確認プロンプトをスキップ")
+	cmd.review = cmd.flags.Bool("review", false, "端末のレビュー画面でマージする候補を選ぶ")
 	cmd.noMask = cmd.flags.Bool("nomask", false, "ログとファイル出力でメールアドレスをマスクしない")
 	cmd.outDir = cmd.flags.String("outdir", "out", "出力ディレクトリのパス")
+	cmd.outDirMode = cmd.flags.String("outdir-mode", identity.DefaultOutdirMode, "出力ディレクトリへの書き込み方法 (timestamped, overwrite, append)")
+	cmd.fromCSV = cmd.flags.String("from-csv", "", "入力のCSVファイル。merge: マージペア (child, parent 列), create: 作成するアイデンティティ, delete, update: 対象のアイデンティティ (id 列)")
+	cmd.interval = cmd.flags.Duration("request-interval", identity.DefaultRequestInterval, "作成・削除・更新APIを連続して呼び出す際の最小間隔 (例: 500ms, 1s)")
+	cmd.force = cmd.flags.Bool("force", false, "delete と --after-merge delete で managed のアイデンティティも削除する")
+	cmd.leftOrg = cmd.flags.String("left-org", "", "compare で比較する一方の組織ID")
+	cmd.rightOrg = cmd.flags.String("right-org", "", "compare で比較するもう一方の組織ID")
+	cmd.minConfidence = cmd.flags.Float64("min-confidence", 0, "duplicates で出力するクラスタの最小の確からしさ (0〜1)")
+	cmd.minNameSimilarity = cmd.flags.Float64("min-name-similarity", 0, "親子の表示名の類似度がこの値 (0〜1) 未満の候補をマージせず NeedsReview にする")
+	cmd.afterMerge = cmd.flags.String("after-merge", identity.AfterMergeNone, "マージに成功した子アイデンティティに行う処理 (none, delete, set-status=<status>)")
+	cmd.exportDecisions = cmd.flags.String("export-decisions", "", "samemerge でマージせずに候補を判断ファイル (CSV) に出力する")
+	cmd.decisions = cmd.flags.String("decisions", "", "samemerge で判断ファイルの Decision が approve の候補のみをマージする")
+	cmd.set = cmd.flags.String("set", "", "update で設定する値（field=value のカンマ区切り）(例: employeeStatus=retired)")
+	cmd.confirmCount = cmd.flags.Int("confirm-count", 0, "delete の確認で入力する削除件数を事前に指定する (対話的な確認を省略)")
+	cmd.csvColumns = cmd.flags.String("csv-columns", "", "samemerge が出力するCSVの列（カンマ区切り）。指定しない場合はすべての列")
+	cmd.csvEncoding = cmd.flags.String("csv-encoding", "utf8", "samemerge が出力するCSVの文字コード (utf8, utf8bom, sjis)")
+	cmd.csvDelimiter = cmd.flags.String("csv-delimiter", ",", "samemerge が出力するCSVの区切り文字 (1文字、または tab)")
+	cmd.cacheDir = cmd.flags.String("cache-dir", identity.DefaultCacheDir, "アイデンティティのスナップショットを保存するディレクトリ")
+	cmd.domains = cmd.flags.String("domain", "", "ドメインで絞り込み（カンマ区切り）")
+	cmd.managementTypes = cmd.flags.String("management-type", "", "管理タイプで絞り込み（カンマ区切り）(例: managed,external)")
+	cmd.employeeTypes = cmd.flags.String("employee-type", "", "従業員タイプで絞り込み（カンマ区切り）")
+	cmd.employeeStatuses = cmd.flags.String("employee-status", "", "従業員ステータスで絞り込み（カンマ区切り）(例: active,retired)")
+	cmd.search = cmd.flags.String("search", "", "表示名またはメールアドレスの部分一致で絞り込み")
+	cmd.peopleID = cmd.flags.Int("people-id", 0, "People IDで絞り込み")
+	cmd.hasSecondaryEmails = cmd.flags.String("has-secondary-emails", "", "セカンダリーメールの有無で絞り込み (true, false)")
+	cmd.hasMergedPeople = cmd.flags.String("has-merged-people", "", "統合済みPeopleの有無で絞り込み (true, false)")
+	cmd.sort = cmd.flags.String("sort", "", "並び替え順。list: フィールド名、先頭に-を付けると降順 (例: -peopleId), matrix: label, count")
+	cmd.fields = cmd.flags.String("fields", "", "表示するフィールド（カンマ区切り）")
+	cmd.limit = cmd.flags.Int("limit", 0, "表示する最大件数 (0: 無制限)")
+	cmd.where = cmd.flags.String("where", "", "絞り込み条件式 (例: managementType == \"managed\" && domain in [\"a.com\",\"b.com\"])")
+	cmd.sameLocal = cmd.flags.Bool("same-local-part", false, "同じローカルパートを持つ組織ドメインのアイデンティティも表示")
+	cmd.rows = cmd.flags.String("rows", "managementType", "マトリックスの行にするフィールド")
+	cmd.columns = cmd.flags.String("cols", "employeeStatus", "マトリックスの列にするフィールド")
+	cmd.group = cmd.flags.String("group", "", "指定したフィールドの値ごとにマトリックスを作成")
+	cmd.percent = cmd.flags.String("percent", "", "マトリックスに割合を表示 (row, col, total)")
+	cmd.cacheTTL = cmd.flags.Duration("cache-ttl", 0, "スナップショットの有効期間 (例: 30m, 12h)。0の場合はスナップショットを使用しない")
 
 	return cmd
 }
@@ -53,22 +142,72 @@ func (c *IdentityCommand) Run(args []string) error {
 	c.flags.SetOutput(c.flags.Output())
 
 	switch subCmd {
-	case "matrix":
-		if err := c.flags.Parse(subArgs); err != nil {
-			return err
-		}
-		return c.runMatrix()
-	case "samemerge":
-		if err := c.flags.Parse(subArgs); err != nil {
-			return err
-		}
-		return c.runSameMerge()
 	case "help":
 		fmt.Fprintln(os.Stderr, c.Help())
 		return nil
+	case "matrix", "samemerge", "merge", "create", "delete", "update", "snapshot", "list", "duplicates", "compare", "show", "export", "diff":
 	default:
 		return fmt.Errorf("不明なサブコマンド: %s", subCmd)
 	}
+
+	// show, export, diff はフラグの前後に位置引数を取ります
+	var positionals []string
+	var err error
+	switch subCmd {
+	case "show", "export", "diff":
+		positionals, err = c.parseArgs(subArgs)
+	default:
+		err = c.flags.Parse(subArgs)
+	}
+	if err != nil {
+		return err
+	}
+	// --nomask はすべてのサブコマンドの出力とログに適用する
+	identity.SetNoMask(*c.noMask)
+
+	switch subCmd {
+	case "matrix":
+		return c.runMatrix()
+	case "samemerge":
+		return c.runSameMerge()
+	case "merge":
+		return c.runMerge()
+	case "create":
+		return c.runCreate()
+	case "delete":
+		return c.runDelete()
+	case "update":
+		return c.runUpdate()
+	case "snapshot":
+		return c.runSnapshot()
+	case "list":
+		return c.runList()
+	case "duplicates":
+		return c.runDuplicates()
+	case "compare":
+		return c.runCompare()
+	case "show":
+		return c.runShow(positionals)
+	case "export":
+		return c.runExport(positionals)
+	default:
+		return c.runDiff(positionals)
+	}
+}
+
+// parseArgs はフラグを解析し、フラグの前後に置かれた位置引数を返します
+func (c *IdentityCommand) parseArgs(args []string) ([]string, error) {
+	var positionals []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if c.flags.NArg() == 0 {
+			return positionals, nil
+		}
+		positionals = append(positionals, c.flags.Arg(0))
+		args = c.flags.Args()[1:]
+	}
 }
 
 // Help returns detailed usage information
@@ -85,15 +224,66 @@ func (c *IdentityCommand) Help() string {
   samemerge   同じメールローカルパートを持つアイデンティティをマージします
               異なるドメイン間で同一ユーザーのアイデンティティを統合します
 
+  merge       CSVファイルに記載したアイデンティティのペアをマージします
+              ドメインの照合では対応付けられないアカウントの統合に使用します
+
+  create      CSVファイルに記載したアイデンティティを一括で作成します
+
+  delete      条件またはCSVファイルで指定したアイデンティティを削除します
+              削除前の内容は deleted_identities.jsonl に保存されます
+
+  update      条件またはCSVファイルで指定したアイデンティティの属性を変更します
+              変更できる属性: displayName, employeeType, employeeStatus
+
+  list        条件に一致するアイデンティティの一覧を表示します
+
+  duplicates  ドメインに関係なく重複していると思われるアイデンティティをまとめて表示します
+              メールアドレス・表示名・セカンダリーメールの一致からクラスタと確からしさを求めます
+
+  compare     2つの組織のアイデンティティを比較します
+              両方に存在する人・一方にのみ存在する人・管理タイプの違いを表示します
+              組織ごとのAPIキーは ADMINA_API_KEY_<組織ID> で指定します
+
+  show        1件のアイデンティティの詳細を表示します
+              セカンダリーメールと統合済みPeopleの履歴を含みます
+              引数: <メールアドレス|アイデンティティID|People ID>
+
+  snapshot    全アイデンティティを取得してスナップショットを更新します
+              matrix などの参照系コマンドはスナップショットから実行できます
+
+  export      全アイデンティティをスナップショットファイルに保存します
+              引数: [出力ファイル] (デフォルト: <outdir>/identities-<組織ID>-<日時>.jsonl)
+
+  diff        2つのスナップショットファイルを比較します
+              追加・削除・統合・変更されたアイデンティティとマトリックスの差分を表示します
+              引数: <古いファイル> <新しいファイル>
+
   help        このヘルプメッセージを表示します
 
 グローバルオプション:
   --output format   出力フォーマットを指定します (デフォルト: json)
-                   指定可能な値: json, markdown, pretty
+                   --output help でコマンドごとに使用できるフォーマットを表示します
+                   指定可能な値: json, markdown, pretty, html
+                   matrix では csv, tsv, xlsx も指定できます
+                   html は外部ファイルを参照しない単一のHTMLレポートです
+                   samemerge では出力ディレクトリに merge_report.html を作成します
+
+  --template       --output template で使用する text/template 形式のファイルを指定します
+                   matrix と samemerge で使用できます
+                   同梱のテンプレート: builtin:matrix-summary, builtin:matrix-slack,
+                     builtin:merge-summary, builtin:merge-email
+                   メールアドレスは {{maskEmail .Child.Email}} のようにマスクして出力します
 
   --debug          デバッグモードを有効にします
                    詳細なログ出力が表示されます
 
+  --cache-dir      スナップショットの保存先を指定します (デフォルト: out/cache)
+
+  --cache-ttl      スナップショットの有効期間を指定します (例: 30m, 12h)
+                   期限内であれば参照系コマンドはAPIを呼び出しません
+                   0の場合はスナップショットを使用しません (デフォルト: 0)
+                   samemerge と merge では --dry-run の場合のみ使用されます
+
 Samemergeサブコマンドのオプション:
   --parent-domain  マージ先となる親ドメインを指定します
                    例: example.com
@@ -106,38 +296,503 @@ Samemergeサブコマンドのオプション:
 
   --y              マージの確認プロンプトをスキップします
                    自動化スクリプトでの使用に適しています
+                   確認プロンプトでは y: マージ, n: スキップ, a: 残りをすべてマージ,
+                   q: 中断して結果を出力, d: 親子の詳細を表示 と回答できます
+                   標準入力が端末でない場合、--y なしではエラーで終了します
+
+  --review        確認プロンプトの代わりに全画面のレビュー画面で候補を確認します
+                   親子のフィールドを並べて表示し、承認 (a)・却下 (r)・保留 (s)、
+                   子ドメイン (D)・管理タイプ (T) ごとの一括承認、検索 (/) ができます
+                   x で件数のサマリーを確認してから、承認した候補のみをマージします
+                   端末から実行する必要があり、--dry-run, --y とは併用できません
 
   --nomask        ログとファイル出力でメールアドレスをマスクしない
 
   --outdir        出力ディレクトリのパスを指定します
+                   既存のファイルやディレクトリは削除されません
+
+  --outdir-mode   出力ディレクトリへの書き込み方法を指定します (デフォルト: timestamped)
+                   timestamped: 実行ごとに data-<日時>-<実行ID> を作成し、
+                                <outdir>/latest に最新のディレクトリ名を記録します
+                   overwrite:   <outdir> に直接書き込み、同名のファイルのみ上書きします
+                   append:      <outdir> に直接書き込み、既存のCSVに行を追記します
+
+  --csv-columns   出力するCSVの列をカンマ区切りで指定します (デフォルト: すべての列)
+                   例: ChildEmail,Status,Reason
+
+  --csv-encoding  CSVの文字コードを指定します (デフォルト: utf8)
+                   utf8bom: Excel 用の BOM 付き UTF-8, sjis: Shift_JIS
+
+  --csv-delimiter CSVの区切り文字を指定します (デフォルト: ,)
+                   例: tab, ;
+
+  --after-merge   マージに成功した子アイデンティティに行う処理を指定します (デフォルト: none)
+                   set-status=<status>: 従業員ステータスを変更します (例: set-status=retired)
+                   delete: 削除します。削除前の内容を deleted_identities.jsonl に保存します
+                           managed の子は --force を指定しない限り削除しません
+                   マージしなかった候補には行いません。結果は identity_mappings.csv に出力されます
+
+  --min-name-similarity 親子の表示名の類似度 (0〜1) がこの値未満の候補をマージせず、
+                   NeedsReview として出力します (デフォルト: 0 = 判定しない)
+                   類似度は全角・半角、大文字小文字、空白、かなとローマ字、姓名の順序の
+                   違いを除いて求めます。漢字とローマ字の組は低い値になります
+
+  --export-decisions 候補をマージせず、判断ファイル (CSV) に出力します
+                   Decision 列 (初期値 defer) を approve, reject, defer に編集して
+                   --decisions で読み込みます。--csv-encoding, --csv-delimiter に従います
+
+  --decisions      判断ファイルを読み込み、Decision が approve の候補のみをマージします
+                   --parent-domain, --child-domains は不要です。--review とは併用できません
+                   アイデンティティが見つからない、または出力後に People ID が変わった行は
+                   マージせず unresolved_pairs.csv に出力します
+
+Mergeサブコマンドのオプション:
+  --from-csv       マージするアイデンティティのペアを記載したCSVファイルを指定します
+                   ヘッダー行に child と parent の列が必要です
+                   値にはメールアドレス・アイデンティティID・People IDを指定できます
+                   特定できなかった行は unresolved_pairs.csv に出力されます
+                   --dry-run, --y, --outdir などは samemerge と同じです
+
+Createサブコマンドのオプション:
+  --from-csv       作成するアイデンティティを記載したCSVファイルを指定します
+                   列: primaryEmail (必須), firstName, lastName, displayName,
+                   employeeType, employeeStatus (# で始まる行は無視されます)
+                   メールアドレスの形式・値・既存のアイデンティティとの重複を検証し、
+                   結果を identity_create_results.csv に出力します
+
+  --request-interval
+                   作成APIを呼び出す最小間隔を指定します (デフォルト: 500ms)
+                   --dry-run, --y, --outdir などは samemerge と同じです
+
+Deleteサブコマンドのオプション:
+  --domain, --management-type, --where など
+                   list と同じ絞り込み条件で削除対象を指定します
+                   条件を指定しない全件の削除はできません
+
+  --from-csv       削除するアイデンティティを id 列に記載したCSVファイルを指定します
+                   値にはプライマリメールアドレス・アイデンティティID・People IDを指定できます
+                   セカンダリーメールや統合済みのメールアドレスにのみ一致する行は削除しません
+                   絞り込み条件とは同時に指定できません
+
+  --force          managed のアイデンティティも削除します
+                   指定しない場合、managed のアイデンティティは Refused として残ります
+
+  --confirm-count  削除件数を事前に指定し、件数の入力による確認を省略します
+                   実際の削除件数と一致しない場合は削除しません (--y では省略できません)
+                   標準入力が端末でない場合、--confirm-count なしではエラーで終了します
+
+  --request-interval
+                   削除APIを呼び出す最小間隔を指定します (デフォルト: 500ms)
+                   削除前の内容を deleted_identities.jsonl に、結果を
+                   identity_delete_results.csv に出力します
+
+Updateサブコマンドのオプション:
+  --domain, --management-type, --where など
+                   list と同じ絞り込み条件で変更対象を指定します
+                   条件を指定しない全件の変更はできません
+
+  --from-csv       変更するアイデンティティを id 列に記載したCSVファイルを指定します
+                   値にはプライマリメールアドレス・アイデンティティID・People IDを指定できます
+                   セカンダリーメールや統合済みのメールアドレスにのみ一致する行は変更しません
+                   displayName, employeeType, employeeStatus の列があれば行ごとに値を変更します
+                   絞り込み条件とは同時に指定できません
+
+  --set            設定する値を field=value のカンマ区切りで指定します
+                   例: employeeStatus=retired,employeeType=other
+                   --from-csv の場合は値が空の列に適用されます
+
+                   変更前に差分を表示し、確認のうえで変更します
+                   結果を identity_update_results.csv に出力します
+                   --dry-run, --y, --request-interval, --outdir などは create と同じです
+
+Matrixサブコマンドのオプション:
+  --rows           行にするフィールドを指定します (デフォルト: managementType)
+  --cols           列にするフィールドを指定します (デフォルト: employeeStatus)
+  --group          指定したフィールドの値ごとにマトリックスを作成します
+                   指定可能な値: managementType, employeeType, employeeStatus, domain,
+                   merged (統合済みPeopleの有無)
+
+  --sort           行・列の並び順を指定します (デフォルト: label)
+                   label: 名前順, count: 件数の多い順
+
+  --percent        各セルに割合を併記します
+                   row: 行合計に対する割合, col: 列合計に対する割合, total: 総計に対する割合
+
+  --output-file    結果を標準出力ではなく指定したファイルに書き出します
+                   xlsx の場合は必須です
+
+Listサブコマンドのオプション:
+  --domain, --management-type, --employee-type, --employee-status
+                   指定した値のいずれかに一致するものに絞り込みます（カンマ区切り）
+
+  --search         表示名またはメールアドレスの部分一致で絞り込みます
+
+  --people-id      People IDで絞り込みます
+
+  --has-secondary-emails, --has-merged-people
+                   セカンダリーメール・統合済みPeopleの有無で絞り込みます (true, false)
+
+  --sort           並び替えるフィールドを指定します。先頭に-を付けると降順です
+
+  --fields         表示するフィールドをカンマ区切りで指定します
+                   指定可能な値: id, peopleId, displayName, email, domain, managementType,
+                   employeeType, employeeStatus, secondaryEmails, mergedPeople
+
+  --limit          表示する最大件数を指定します
+
+Compareサブコマンドのオプション:
+  --left-org       比較する一方の組織IDを指定します (必須)
+  --right-org      比較するもう一方の組織IDを指定します (必須)
+                   APIキーは ADMINA_API_KEY_<組織ID> から読み込み、設定されていない場合は
+                   ADMINA_API_KEY を使用します。ADMINA_ORGANIZATION_ID は使用しません
+                   メールアドレス (セカンダリーメールを含む) を正規化して一致するものを
+                   対応付け、残りは表示名が一致し、それぞれの組織で一意なものを対応付けます
+                   --offline, --cache-ttl では組織ごとのスナップショットを使用します
+
+絞り込み条件式 (matrix, list, duplicates, compare, samemerge):
+  --where          条件に一致するアイデンティティのみを対象にします
+                   samemerge では親・子ともに条件に一致するものだけが候補になります
+                   compare では両方の組織で条件に一致するものだけを比較します
+                   フィールド: id, peopleId, displayName, email, domain, localPart,
+                     managementType, employeeType, employeeStatus,
+                     secondaryEmails (リスト), mergedPeople (件数),
+                     hasSecondaryEmails, hasMergedPeople (真偽値)
+                   演算子: == != < <= > >= in, not in, contains, startsWith, endsWith,
+                     && || ! ( )
+                   文字列はダブルクォートで囲み、大文字小文字を区別せずに比較します
+                   例: managementType == "managed" && employeeStatus == "active"
+                       && domain in ["a.com", "b.com"] && !hasSecondaryEmails
+
+Duplicatesサブコマンドのオプション:
+  --min-confidence 指定した確からしさ (0〜1) 未満のクラスタを除外します (デフォルト: 0)
+                   手がかりと重み: email 0.95 (大文字小文字のみ異なる),
+                     normalized-email 0.85 (. と + 以降を除くと一致),
+                     secondary-email 0.8, display-name 0.5
+                   同じ組に複数の手がかりがある場合は 1 - (1 - 重み) の積で組み合わせ、
+                   クラスタの確からしさはクラスタをつなぐ最も弱い組のスコアです
+                   --where で対象を絞り込めます。出力: json, markdown, pretty, csv, html
+
+Showサブコマンドのオプション:
+  --same-local-part
+                   同じローカルパートを持つ組織ドメインのアイデンティティも表示します
 
 使用例:
   # マトリックスの表示
   admina-sysutils identity matrix --output markdown
 
+  # ドメインごとに従業員タイプ×ステータスを集計
+  admina-sysutils identity matrix --rows employeeType --cols employeeStatus --group domain --output pretty
+
+  # 監査用にExcelファイルで出力
+  admina-sysutils identity matrix --group domain --output xlsx --output-file out/matrix.xlsx
+
+  # 共有用のHTMLレポートを作成
+  admina-sysutils identity matrix --output html --output-file out/matrix.html
+
+  # 同梱のテンプレートでSlack向けの要約を出力
+  admina-sysutils identity matrix --output template --template builtin:matrix-slack
+
+  # スナップショットを更新し、オフラインでマトリックスを表示
+  admina-sysutils identity snapshot
+  admina-sysutils --offline identity matrix --output pretty
+
+  # 子ドメインの退職済みアイデンティティを一覧表示
+  admina-sysutils identity list --domain sub1.example.com --employee-status retired --sort email
+
+  # 重複の疑いがあるアイデンティティをレビュー用に出力
+  admina-sysutils identity duplicates --min-confidence 0.8 --output csv > out/duplicates.csv
+
+  # 買収した組織と両方に在籍する人を確認
+  ADMINA_API_KEY_12345=... ADMINA_API_KEY_67890=... \
+    admina-sysutils identity compare --left-org 12345 --right-org 67890 --output markdown
+
+  # マージ履歴の確認
+  admina-sysutils identity show taro@example.com --same-local-part
+
+  # 月次の棚卸し: スナップショットを保存して前月分と比較
+  admina-sysutils identity export out/2024-02.jsonl
+  admina-sysutils identity diff out/2024-01.jsonl out/2024-02.jsonl --output markdown
+
   # アイデンティティのマージ
   admina-sysutils identity samemerge \
     --parent-domain example.com \
     --child-domains sub1.example.com,sub2.example.com \
     --dry-run
 
+  # 候補を担当者に確認してもらい、承認した行のみをマージ
+  admina-sysutils identity samemerge \
+    --parent-domain example.com \
+    --child-domains sub1.example.com \
+    --export-decisions out/decisions.csv
+  admina-sysutils identity samemerge --decisions out/decisions.csv --dry-run
+
+  # 人事部から受け取った対応表でマージ
+  admina-sysutils identity merge --from-csv pairs.csv --dry-run
+
+  # CSVからアイデンティティを一括作成
+  admina-sysutils identity create --from-csv new_hires.csv --dry-run
+
+  # 退職済みの外部アイデンティティを削除
+  admina-sysutils identity delete --management-type external --employee-status retired --dry-run
+
+  # 退職者リストのアイデンティティを退職済みに変更
+  admina-sysutils identity update --from-csv leavers.csv --set employeeStatus=retired --dry-run
+
 環境変数:
   ADMINA_API_KEY          MoneyForward Admina APIキー
   ADMINA_ORGANIZATION_ID  組織ID
+  ADMINA_API_KEY_<組織ID>  compare で使用する組織ごとのAPIキー
 `
 	return helpText
 }
 
 func (c *IdentityCommand) runMatrix() error {
-	client := c.newIdentityClient()
-	if client == nil {
-		return fmt.Errorf("クライアントの初期化に失敗しました")
+	client, err := c.newReadOnlyClient()
+	if err != nil {
+		return err
+	}
+
+	where, err := c.parseWhere()
+	if err != nil {
+		return err
+	}
+
+	return identity.PrintIdentityMatrix(client, *c.outputFormat, &identity.MatrixOptions{
+		Where:        where,
+		Rows:         *c.rows,
+		Columns:      *c.columns,
+		Group:        *c.group,
+		Sort:         *c.sort,
+		Percent:      *c.percent,
+		OutputFile:   *c.outputFile,
+		Organization: c.organization,
+		Template:     *c.template,
+	})
+}
+
+func (c *IdentityCommand) runSnapshot() error {
+	if c.offline {
+		return fmt.Errorf("snapshot サブコマンドは --offline と併用できません")
+	}
+
+	client := admina.NewClient()
+	if err := client.Validate(); err != nil {
+		return fmt.Errorf("クライアントの初期化に失敗しました: %v", err)
+	}
+
+	store := identity.NewSnapshotStore(*c.cacheDir)
+	_, err := store.Refresh(&identityClientAdapter{client: client}, client.OrganizationID())
+	return err
+}
+
+func (c *IdentityCommand) runDuplicates() error {
+	if *c.minConfidence < 0 || *c.minConfidence > 1 {
+		return fmt.Errorf("--min-confidence には 0 から 1 の値を指定してください: %v", *c.minConfidence)
+	}
+
+	where, err := c.parseWhere()
+	if err != nil {
+		return err
+	}
+
+	client, err := c.newReadOnlyClient()
+	if err != nil {
+		return err
+	}
+
+	return identity.PrintDuplicates(client, &identity.DuplicateOptions{
+		Where:         where,
+		MinConfidence: *c.minConfidence,
+	}, *c.outputFormat, &identity.FormatContext{Organization: c.organization})
+}
+
+func (c *IdentityCommand) runCompare() error {
+	if *c.leftOrg == "" || *c.rightOrg == "" {
+		return fmt.Errorf("--left-org と --right-org オプションは必須です")
+	}
+	if *c.leftOrg == *c.rightOrg {
+		return fmt.Errorf("--left-org と --right-org には異なる組織IDを指定してください")
+	}
+
+	where, err := c.parseWhere()
+	if err != nil {
+		return err
+	}
+
+	left, err := c.newCompareTarget(*c.leftOrg)
+	if err != nil {
+		return err
+	}
+	right, err := c.newCompareTarget(*c.rightOrg)
+	if err != nil {
+		return err
+	}
+
+	return identity.PrintComparison(left, right, &identity.CompareOptions{Where: where}, *c.outputFormat, &identity.FormatContext{})
+}
+
+// newCompareTarget は組織ごとのAPIキーで compare の比較対象を作成します
+// --offline または --cache-ttl が指定されている場合は組織ごとのスナップショットを経由します
+func (c *IdentityCommand) newCompareTarget(organizationID string) (*identity.CompareTarget, error) {
+	target := &identity.CompareTarget{OrganizationID: organizationID}
+	store := identity.NewSnapshotStore(*c.cacheDir)
+	if c.offline {
+		target.Client = identity.NewCachedClient(nil, store, organizationID, 0, true)
+		return target, nil
+	}
+
+	client := admina.NewOrganizationClient(organizationID)
+	if err := client.Validate(); err != nil {
+		return nil, fmt.Errorf("組織 %s のクライアントの初期化に失敗しました: %v (%s を設定してください)", organizationID, err, admina.OrganizationAPIKeyEnv(organizationID))
+	}
+	org, err := client.GetOrganization(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("組織 %s の情報を取得できませんでした: %v", organizationID, err)
+	}
+	target.Organization = org
+
+	var identityClient identity.Client = &identityClientAdapter{client: client}
+	if *c.cacheTTL > 0 {
+		identityClient = identity.NewCachedClient(identityClient, store, organizationID, *c.cacheTTL, false)
+	}
+	target.Client = identityClient
+	return target, nil
+}
+
+func (c *IdentityCommand) runList() error {
+	options, err := c.listOptions()
+	if err != nil {
+		return err
+	}
+
+	client, err := c.newReadOnlyClient()
+	if err != nil {
+		return err
+	}
+
+	return identity.PrintIdentityList(client, options, *c.outputFormat)
+}
+
+// listOptions はフラグから一覧の絞り込み条件を組み立てます
+func (c *IdentityCommand) listOptions() (*identity.ListOptions, error) {
+	hasSecondaryEmails, err := parseOptionalBool("has-secondary-emails", *c.hasSecondaryEmails)
+	if err != nil {
+		return nil, err
+	}
+	hasMergedPeople, err := parseOptionalBool("has-merged-people", *c.hasMergedPeople)
+	if err != nil {
+		return nil, err
+	}
+
+	where, err := c.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity.ListOptions{
+		Where:              where,
+		Domains:            splitList(*c.domains),
+		ManagementTypes:    splitList(*c.managementTypes),
+		EmployeeTypes:      splitList(*c.employeeTypes),
+		EmployeeStatuses:   splitList(*c.employeeStatuses),
+		Search:             *c.search,
+		PeopleID:           *c.peopleID,
+		HasSecondaryEmails: hasSecondaryEmails,
+		HasMergedPeople:    hasMergedPeople,
+		Sort:               *c.sort,
+		Fields:             splitList(*c.fields),
+		Limit:              *c.limit,
+	}, nil
+}
+
+// parseWhere は --where の条件式を解析します。未指定の場合は nil を返します
+func (c *IdentityCommand) parseWhere() (*identity.Where, error) {
+	if strings.TrimSpace(*c.where) == "" {
+		return nil, nil
+	}
+	return identity.ParseWhere(*c.where)
+}
+
+// splitList はカンマ区切りの値を分割します。空の要素は除外します
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseOptionalBool は空文字の場合に nil を返す真偽値の解析を行います
+func parseOptionalBool(name, value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("--%s には true または false を指定してください: %s", name, value)
 	}
+	return &b, nil
+}
+
+func (c *IdentityCommand) runShow(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show にはメールアドレス、アイデンティティID、People IDのいずれかを1つ指定してください")
+	}
+
+	client, err := c.newReadOnlyClient()
+	if err != nil {
+		return err
+	}
+
+	options := &identity.ShowOptions{SameLocalPart: *c.sameLocal}
+	if c.organization != nil {
+		options.Domains = c.organization.Domains
+	}
+	return identity.PrintIdentityDetail(client, args[0], options, *c.outputFormat)
+}
+
+func (c *IdentityCommand) runExport(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("export の引数が多すぎます: %v", args)
+	}
+
+	client, err := c.newReadOnlyClient()
+	if err != nil {
+		return err
+	}
+
+	organizationID := admina.NewClient().OrganizationID()
+	path := filepath.Join(*c.outDir, fmt.Sprintf("identities-%s-%s.jsonl", organizationID, time.Now().Format("20060102-150405")))
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	_, err = identity.ExportSnapshot(client, organizationID, path)
+	return err
+}
 
-	return identity.PrintIdentityMatrix(client, *c.outputFormat)
+func (c *IdentityCommand) runDiff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff には比較する2つのスナップショットファイルを指定してください")
+	}
+
+	return identity.PrintSnapshotDiff(args[0], args[1], *c.outputFormat)
 }
 
 func (c *IdentityCommand) runSameMerge() error {
+	if *c.decisions != "" {
+		if *c.exportDecisions != "" {
+			return fmt.Errorf("--decisions と --export-decisions は同時に指定できません")
+		}
+		mergeConfig, err := c.newMergeConfig()
+		if err != nil {
+			return err
+		}
+		mergeConfig.DecisionsFile = *c.decisions
+		return c.mergeIdentities(mergeConfig)
+	}
 	if *c.parentDomain == "" {
 		return fmt.Errorf("--parent-domain オプションは必須です")
 	}
@@ -145,25 +800,206 @@ func (c *IdentityCommand) runSameMerge() error {
 		return fmt.Errorf("--child-domains オプションは必須です")
 	}
 
-	childDomainList := strings.Split(*c.childDomains, ",")
-	for i := range childDomainList {
-		childDomainList[i] = strings.TrimSpace(childDomainList[i])
+	mergeConfig, err := c.newMergeConfig()
+	if err != nil {
+		return err
+	}
+	mergeConfig.ParentDomain = *c.parentDomain
+	mergeConfig.ChildDomains = splitList(*c.childDomains)
+	mergeConfig.ExportDecisions = *c.exportDecisions
+	return c.mergeIdentities(mergeConfig)
+}
+
+func (c *IdentityCommand) runMerge() error {
+	if *c.fromCSV == "" {
+		return fmt.Errorf("--from-csv オプションは必須です")
 	}
 
+	mergeConfig, err := c.newMergeConfig()
+	if err != nil {
+		return err
+	}
+	mergeConfig.PairsFile = *c.fromCSV
+	return c.mergeIdentities(mergeConfig)
+}
+
+func (c *IdentityCommand) runCreate() error {
+	if *c.fromCSV == "" {
+		return fmt.Errorf("--from-csv オプションは必須です")
+	}
+
+	delimiter, err := identity.ParseCSVDelimiter(*c.csvDelimiter)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.newWriteClient("create")
+	if err != nil {
+		return err
+	}
+
+	return identity.CreateIdentities(client, &identity.CreateConfig{
+		InputFile:     *c.fromCSV,
+		DryRun:        *c.dryRun,
+		AutoApprove:   *c.autoApprove,
+		Interval:      *c.interval,
+		OutputDir:     *c.outDir,
+		OutputDirMode: *c.outDirMode,
+		CSV:           identity.CSVOptions{Encoding: *c.csvEncoding, Delimiter: delimiter},
+		Organization:  c.organization,
+		Version:       Version,
+		Args:          c.args,
+	})
+}
+
+func (c *IdentityCommand) runDelete() error {
+	filter, err := c.listOptions()
+	if err != nil {
+		return err
+	}
+
+	delimiter, err := identity.ParseCSVDelimiter(*c.csvDelimiter)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.newWriteClient("delete")
+	if err != nil {
+		return err
+	}
+
+	return identity.DeleteIdentities(client, &identity.DeleteConfig{
+		Filter:        filter,
+		InputFile:     *c.fromCSV,
+		Force:         *c.force,
+		DryRun:        *c.dryRun,
+		ConfirmCount:  *c.confirmCount,
+		Interval:      *c.interval,
+		OutputDir:     *c.outDir,
+		OutputDirMode: *c.outDirMode,
+		CSV:           identity.CSVOptions{Encoding: *c.csvEncoding, Delimiter: delimiter},
+		Organization:  c.organization,
+		Version:       Version,
+		Args:          c.args,
+	})
+}
+
+func (c *IdentityCommand) runUpdate() error {
+	filter, err := c.listOptions()
+	if err != nil {
+		return err
+	}
+
+	set, err := identity.ParseUpdateSet(splitList(*c.set))
+	if err != nil {
+		return err
+	}
+
+	delimiter, err := identity.ParseCSVDelimiter(*c.csvDelimiter)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.newWriteClient("update")
+	if err != nil {
+		return err
+	}
+
+	return identity.UpdateIdentities(client, &identity.UpdateConfig{
+		Filter:        filter,
+		InputFile:     *c.fromCSV,
+		Set:           set,
+		DryRun:        *c.dryRun,
+		AutoApprove:   *c.autoApprove,
+		Interval:      *c.interval,
+		OutputDir:     *c.outDir,
+		OutputDirMode: *c.outDirMode,
+		CSV:           identity.CSVOptions{Encoding: *c.csvEncoding, Delimiter: delimiter},
+		Organization:  c.organization,
+		Version:       Version,
+		Args:          c.args,
+	})
+}
+
+// newWriteClient は更新系のサブコマンド用のクライアントを作成します
+// dry-run の場合は参照系のクライアントを使用し、--offline では dry-run 以外を拒否します
+func (c *IdentityCommand) newWriteClient(subCmd string) (identity.Client, error) {
+	if *c.dryRun {
+		return c.newReadOnlyClient()
+	}
+	if c.offline {
+		return nil, fmt.Errorf("--offline では --dry-run なしの %s は実行できません", subCmd)
+	}
 	client := c.newIdentityClient()
 	if client == nil {
-		return fmt.Errorf("クライアントの初期化に失敗しました")
+		return nil, fmt.Errorf("クライアントの初期化に失敗しました")
 	}
+	return client, nil
+}
 
-	mergeConfig := &identity.MergeConfig{
-		ParentDomain: *c.parentDomain,
-		ChildDomains: childDomainList,
-		DryRun:       *c.dryRun,
-		AutoApprove:  *c.autoApprove,
-		OutputFormat: *c.outputFormat,
-		OutputDir:    *c.outDir,
+// newMergeConfig は samemerge と merge に共通のオプションから MergeConfig を作成します
+func (c *IdentityCommand) newMergeConfig() (*identity.MergeConfig, error) {
+	where, err := c.parseWhere()
+	if err != nil {
+		return nil, err
 	}
-	identity.SetNoMask(*c.noMask)
+
+	delimiter, err := identity.ParseCSVDelimiter(*c.csvDelimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	afterMerge, err := identity.ParseAfterMergeAction(*c.afterMerge)
+	if err != nil {
+		return nil, err
+	}
+
+	if *c.minNameSimilarity < 0 || *c.minNameSimilarity > 1 {
+		return nil, fmt.Errorf("--min-name-similarity には 0 から 1 の値を指定してください: %v", *c.minNameSimilarity)
+	}
+
+	return &identity.MergeConfig{
+		DryRun:        *c.dryRun,
+		AutoApprove:   *c.autoApprove,
+		Review:        *c.review,
+		OutputFormat:  *c.outputFormat,
+		OutputDir:     *c.outDir,
+		OutputDirMode: *c.outDirMode,
+		Where:         where,
+		Organization:  c.organization,
+		Template:      *c.template,
+		CSV: identity.CSVOptions{
+			Columns:   splitList(*c.csvColumns),
+			Encoding:  *c.csvEncoding,
+			Delimiter: delimiter,
+		},
+		AfterMerge:        afterMerge,
+		Force:             *c.force,
+		MinNameSimilarity: *c.minNameSimilarity,
+		Version:           Version,
+		Args:              c.args,
+	}, nil
+}
+
+// mergeIdentities は dry-run と判断ファイルの出力の場合は参照系のクライアントで、それ以外は API でマージを実行します
+func (c *IdentityCommand) mergeIdentities(mergeConfig *identity.MergeConfig) error {
+	var client identity.Client
+	if mergeConfig.DryRun || mergeConfig.ExportDecisions != "" {
+		readOnlyClient, err := c.newReadOnlyClient()
+		if err != nil {
+			return err
+		}
+		client = readOnlyClient
+	} else {
+		if c.offline {
+			return fmt.Errorf("--offline では --dry-run なしのマージは実行できません")
+		}
+		client = c.newIdentityClient()
+		if client == nil {
+			return fmt.Errorf("クライアントの初期化に失敗しました")
+		}
+	}
+
 	return identity.MergeIdentities(client, mergeConfig)
 }
 
@@ -184,6 +1020,18 @@ func (a *identityClientAdapter) MergeIdentities(ctx context.Context, fromPeopleI
 	return result, nil
 }
 
+func (a *identityClientAdapter) CreateIdentity(ctx context.Context, req *admina.CreateIdentityRequest) (*admina.Identity, error) {
+	return a.client.CreateIdentity(ctx, req)
+}
+
+func (a *identityClientAdapter) DeleteIdentity(ctx context.Context, identityID string) error {
+	return a.client.DeleteIdentity(ctx, identityID)
+}
+
+func (a *identityClientAdapter) UpdateIdentity(ctx context.Context, identityID string, req *admina.UpdateIdentityRequest) (*admina.Identity, error) {
+	return a.client.UpdateIdentity(ctx, identityID, req)
+}
+
 func (c *IdentityCommand) newIdentityClient() identity.Client {
 	client := admina.NewClient()
 	if client == nil {
@@ -196,3 +1044,30 @@ func (c *IdentityCommand) newIdentityClient() identity.Client {
 
 	return &identityClientAdapter{client: client}
 }
+
+// newReadOnlyClient は参照系コマンド用のクライアントを作成します
+// --offline または --cache-ttl が指定されている場合はスナップショットを経由します
+func (c *IdentityCommand) newReadOnlyClient() (identity.Client, error) {
+	if !c.offline && *c.cacheTTL <= 0 {
+		client := c.newIdentityClient()
+		if client == nil {
+			return nil, fmt.Errorf("クライアントの初期化に失敗しました")
+		}
+		return client, nil
+	}
+
+	client := admina.NewClient()
+	if client.OrganizationID() == "" {
+		return nil, fmt.Errorf("ADMINA_ORGANIZATION_ID is not set")
+	}
+
+	store := identity.NewSnapshotStore(*c.cacheDir)
+	if c.offline {
+		return identity.NewCachedClient(nil, store, client.OrganizationID(), 0, true), nil
+	}
+
+	if err := client.Validate(); err != nil {
+		return nil, fmt.Errorf("クライアントの初期化に失敗しました: %v", err)
+	}
+	return identity.NewCachedClient(&identityClientAdapter{client: client}, store, client.OrganizationID(), *c.cacheTTL, false), nil
+}
@@ -0,0 +1,182 @@
+package identity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+)
+
+// CSVSchemaVersion は identity_mappings.csv と unmapped_child_identities.csv の列定義のバージョンです
+// 列の追加・変更を行った場合は値を上げ、README の「CSVスキーマ」を更新してください
+//
+//	1  ParentEmail, ParentIdentityID, ChildEmail, ChildIdentityID, Status / ChildEmail, ChildIdentityID
+//	2  スキップ理由・People ID・管理タイプ・従業員ステータス・表示名・ドメインを追加
+//	3  identity_mappings.csv にマージ後の処理 (AfterMerge, AfterMergeStatus, AfterMergeReason) を追加
+//	4  identity_mappings.csv に親子の表示名の類似度 (NameSimilarity) を追加
+const CSVSchemaVersion = 4
+
+// CSVEncodings は --csv-encoding で指定できる文字コードです
+//
+//	utf8     BOM なしの UTF-8 (デフォルト)
+//	utf8bom  BOM 付きの UTF-8。Excel で開いても文字化けしません
+//	sjis     Shift_JIS。表現できない文字は ? に置き換えます
+var CSVEncodings = []string{"utf8", "utf8bom", "sjis"}
+
+// CSVColumn はCSVファイルの1列の定義です
+type CSVColumn[T any] struct {
+	Name        string
+	Description string
+	Value       func(T) string
+}
+
+// MappingColumns は identity_mappings.csv の列です。先頭の5列はバージョン1と同じ並びです
+var MappingColumns = []CSVColumn[MergeCandidate]{
+	{"ParentEmail", "親アイデンティティのメールアドレス", func(c MergeCandidate) string { return MaskEmail(c.Parent.Email) }},
+	{"ParentIdentityID", "親アイデンティティの ID", func(c MergeCandidate) string { return c.Parent.ID }},
+	{"ChildEmail", "子アイデンティティのメールアドレス", func(c MergeCandidate) string { return MaskEmail(c.Child.Email) }},
+	{"ChildIdentityID", "子アイデンティティの ID", func(c MergeCandidate) string { return c.Child.ID }},
+	{"Status", "マージの状態 (Success, Skip, NeedsReview, Error)", func(c MergeCandidate) string { return c.Status }},
+	{"Reason", "スキップまたはエラーの理由", func(c MergeCandidate) string { return c.Reason }},
+	{"ParentPeopleID", "親アイデンティティの People ID", func(c MergeCandidate) string { return peopleIDValue(c.Parent) }},
+	{"ParentDisplayName", "親アイデンティティの表示名", func(c MergeCandidate) string { return c.Parent.DisplayName }},
+	{"ParentManagementType", "親アイデンティティの管理タイプ", func(c MergeCandidate) string { return c.Parent.ManagementType }},
+	{"ParentEmployeeStatus", "親アイデンティティの従業員ステータス", func(c MergeCandidate) string { return c.Parent.EmployeeStatus }},
+	{"ChildPeopleID", "子アイデンティティの People ID", func(c MergeCandidate) string { return peopleIDValue(c.Child) }},
+	{"ChildDisplayName", "子アイデンティティの表示名", func(c MergeCandidate) string { return c.Child.DisplayName }},
+	{"ChildManagementType", "子アイデンティティの管理タイプ", func(c MergeCandidate) string { return c.Child.ManagementType }},
+	{"ChildEmployeeStatus", "子アイデンティティの従業員ステータス", func(c MergeCandidate) string { return c.Child.EmployeeStatus }},
+	{"ChildDomain", "子アイデンティティのドメイン", func(c MergeCandidate) string { return ExtractDomain(c.Child.Email) }},
+	{"AfterMerge", "マージ後の処理 (--after-merge)", func(c MergeCandidate) string { return c.AfterMerge }},
+	{"AfterMergeStatus", "マージ後の処理の状態 (Success, Skip, Planned, Error)", func(c MergeCandidate) string { return c.AfterMergeStatus }},
+	{"AfterMergeReason", "マージ後の処理をスキップした理由またはエラー", func(c MergeCandidate) string { return c.AfterMergeReason }},
+	{"NameSimilarity", "親子の表示名の類似度 (0〜1)", func(c MergeCandidate) string { return formatScore(c.NameSimilarity) }},
+}
+
+// UnmappedColumns は unmapped_child_identities.csv の列です。先頭の2列はバージョン1と同じ並びです
+var UnmappedColumns = []CSVColumn[admina.Identity]{
+	{"ChildEmail", "アイデンティティのメールアドレス", func(i admina.Identity) string { return MaskEmail(i.Email) }},
+	{"ChildIdentityID", "アイデンティティの ID", func(i admina.Identity) string { return i.ID }},
+	{"ChildPeopleID", "People ID", peopleIDValue},
+	{"ChildDisplayName", "表示名", func(i admina.Identity) string { return i.DisplayName }},
+	{"ChildDomain", "ドメイン", func(i admina.Identity) string { return ExtractDomain(i.Email) }},
+	{"ChildManagementType", "管理タイプ", func(i admina.Identity) string { return i.ManagementType }},
+	{"ChildEmployeeType", "従業員タイプ", func(i admina.Identity) string { return i.EmployeeType }},
+	{"ChildEmployeeStatus", "従業員ステータス", func(i admina.Identity) string { return i.EmployeeStatus }},
+}
+
+func peopleIDValue(identity admina.Identity) string {
+	if identity.PeopleID == 0 {
+		return ""
+	}
+	return strconv.Itoa(identity.PeopleID)
+}
+
+// CSVOptions は samemerge が出力するCSVファイルの形式です
+type CSVOptions struct {
+	// Columns は出力する列名です。空の場合はすべての列を出力します
+	// ファイルに存在しない列名は無視し、1列も選ばれないファイルはすべての列を出力します
+	// どちらのファイルにも存在しない列名はエラーになります
+	Columns []string
+	// Encoding は文字コードです (utf8, utf8bom, sjis)
+	Encoding string
+	// Delimiter は区切り文字です。0 の場合はカンマを使用します
+	Delimiter rune
+}
+
+// Validate は列名・文字コードが正しいかを確認します
+func (o *CSVOptions) Validate() error {
+	if o.Encoding != "" && !contains(CSVEncodings, o.Encoding) {
+		return fmt.Errorf("unknown csv encoding: %s (available: %s)", o.Encoding, strings.Join(CSVEncodings, ", "))
+	}
+	if o.Delimiter == '"' || o.Delimiter == '\r' || o.Delimiter == '\n' || o.Delimiter == utf8.RuneError {
+		return fmt.Errorf("invalid csv delimiter: %q", o.Delimiter)
+	}
+
+	known := append(columnNames(MappingColumns), columnNames(UnmappedColumns)...)
+	for _, name := range o.Columns {
+		if !contains(known, name) {
+			return fmt.Errorf("unknown csv column: %s (available: %s)", name, strings.Join(uniqueStrings(known), ", "))
+		}
+	}
+	return nil
+}
+
+// ParseCSVDelimiter は --csv-delimiter の値を区切り文字に変換します
+// 1文字のほか、tab・\t・comma・semicolon を指定できます
+func ParseCSVDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	case "comma":
+		return ',', nil
+	case "semicolon":
+		return ';', nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("csv delimiter must be a single character: %q", value)
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
+
+// selectCSVColumns は names に含まれる列を定義の順に返します
+// names に含まれる列がない場合は、片方のファイルだけの列を指定したものとしてすべての列を返します
+func selectCSVColumns[T any](columns []CSVColumn[T], names []string) []CSVColumn[T] {
+	var selected []CSVColumn[T]
+	for _, column := range columns {
+		if contains(names, column.Name) {
+			selected = append(selected, column)
+		}
+	}
+	if len(selected) == 0 {
+		return columns
+	}
+	return selected
+}
+
+// csvTable は列の定義に従ってヘッダーと行を作成します
+func csvTable[T any](columns []CSVColumn[T], items []T) ([]string, [][]string) {
+	headers := columnNames(columns)
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		row := make([]string, 0, len(columns))
+		for _, column := range columns {
+			row = append(row, column.Value(item))
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+func columnNames[T any](columns []CSVColumn[T]) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// mappingTable は identity_mappings.csv のヘッダーと行を作成します
+func mappingTable(result *MergeResult, options *CSVOptions) ([]string, [][]string) {
+	return csvTable(selectCSVColumns(MappingColumns, options.Columns), result.Candidates)
+}
+
+// unmappedTable は unmapped_child_identities.csv のヘッダーと行を作成します
+func unmappedTable(result *MergeResult, options *CSVOptions) ([]string, [][]string) {
+	return csvTable(selectCSVColumns(UnmappedColumns, options.Columns), result.Unmapped)
+}
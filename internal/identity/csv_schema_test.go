@@ -0,0 +1,162 @@
+package identity_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// mergeCSV は dry-run で samemerge を実行し、出力されたCSVファイルの内容を返します
+func mergeCSV(t *testing.T, identities []admina.Identity, options identity.CSVOptions) (mappings, unmapped []byte) {
+	t.Helper()
+	logger.Init()
+	identity.SetNoMask(false)
+
+	outputDir := t.TempDir()
+	err := identity.MergeIdentities(&mock.Client{Identities: identities}, &identity.MergeConfig{
+		ParentDomain:  "parent.domain.com",
+		ChildDomains:  []string{"child.domain.com"},
+		DryRun:        true,
+		AutoApprove:   true,
+		OutputFormat:  "json",
+		OutputDir:     outputDir,
+		OutputDirMode: "overwrite",
+		CSV:           options,
+	})
+	require.NoError(t, err)
+
+	mappings, err = os.ReadFile(filepath.Join(outputDir, "identity_mappings.csv"))
+	require.NoError(t, err)
+	unmapped, err = os.ReadFile(filepath.Join(outputDir, "unmapped_child_identities.csv"))
+	require.NoError(t, err)
+	return mappings, unmapped
+}
+
+func readCSV(t *testing.T, content []byte) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestMergeCSVSchema(t *testing.T) {
+	identities := []admina.Identity{
+		{ID: "100", PeopleID: 101, DisplayName: "User One", ManagementType: "managed", EmployeeStatus: "active", Email: "user1@parent.domain.com"},
+		{ID: "200", PeopleID: 202, DisplayName: "User One (child)", ManagementType: "managed", EmployeeStatus: "retired", Email: "user1@child.domain.com"},
+		{ID: "300", DisplayName: "Unmapped", ManagementType: "external", EmployeeType: "contractor", EmployeeStatus: "active", Email: "unmapped@child.domain.com"},
+	}
+
+	t.Run("すべての列を出力する", func(t *testing.T) {
+		mappings, unmapped := mergeCSV(t, identities, identity.CSVOptions{})
+
+		assert.Equal(t, [][]string{
+			{"ParentEmail", "ParentIdentityID", "ChildEmail", "ChildIdentityID", "Status", "Reason",
+				"ParentPeopleID", "ParentDisplayName", "ParentManagementType", "ParentEmployeeStatus",
+				"ChildPeopleID", "ChildDisplayName", "ChildManagementType", "ChildEmployeeStatus", "ChildDomain",
+				"AfterMerge", "AfterMergeStatus", "AfterMergeReason", "NameSimilarity"},
+			{"use**@parent.domain.com", "100", "use**@child.domain.com", "200", "Skip", "",
+				"101", "User One", "managed", "active",
+				"202", "User One (child)", "managed", "retired", "child.domain.com",
+				"", "", "", "1.00"},
+		}, readCSV(t, mappings))
+
+		assert.Equal(t, [][]string{
+			{"ChildEmail", "ChildIdentityID", "ChildPeopleID", "ChildDisplayName", "ChildDomain", "ChildManagementType", "ChildEmployeeType", "ChildEmployeeStatus"},
+			{"unm*****@child.domain.com", "300", "", "Unmapped", "child.domain.com", "external", "contractor", "active"},
+		}, readCSV(t, unmapped))
+	})
+
+	t.Run("スキップ理由を出力する", func(t *testing.T) {
+		skipped := []admina.Identity{identities[0], identities[1]}
+		skipped[0].ManagementType = "external"
+		mappings, _ := mergeCSV(t, append(skipped, identities[2]), identity.CSVOptions{Columns: []string{"ChildEmail", "Status", "Reason"}})
+
+		assert.Equal(t, [][]string{
+			{"ChildEmail", "Status", "Reason"},
+			{"use**@child.domain.com", "Skip", "cannot merge from managed to external"},
+		}, readCSV(t, mappings))
+	})
+
+	t.Run("列の指定は定義の順に出力する", func(t *testing.T) {
+		mappings, unmapped := mergeCSV(t, identities, identity.CSVOptions{Columns: []string{"ChildDomain", "ChildEmail"}})
+
+		assert.Equal(t, []string{"ChildEmail", "ChildDomain"}, readCSV(t, mappings)[0])
+		assert.Equal(t, []string{"ChildEmail", "ChildDomain"}, readCSV(t, unmapped)[0])
+	})
+
+	t.Run("片方のファイルだけの列を指定した場合、もう片方はすべての列を出力する", func(t *testing.T) {
+		mappings, unmapped := mergeCSV(t, identities, identity.CSVOptions{Columns: []string{"ParentEmail", "Status"}})
+
+		assert.Equal(t, []string{"ParentEmail", "Status"}, readCSV(t, mappings)[0])
+		assert.Equal(t, []string{"ChildEmail", "ChildIdentityID", "ChildPeopleID", "ChildDisplayName", "ChildDomain", "ChildManagementType", "ChildEmployeeType", "ChildEmployeeStatus"}, readCSV(t, unmapped)[0])
+	})
+
+	t.Run("区切り文字を変更できる", func(t *testing.T) {
+		mappings, _ := mergeCSV(t, identities, identity.CSVOptions{Columns: []string{"ChildEmail", "ChildIdentityID"}, Delimiter: ';'})
+
+		assert.Equal(t, "ChildEmail;ChildIdentityID\nuse**@child.domain.com;200\n", string(mappings))
+	})
+
+	t.Run("utf8bom は先頭に BOM を付ける", func(t *testing.T) {
+		mappings, _ := mergeCSV(t, identities, identity.CSVOptions{Encoding: "utf8bom"})
+
+		assert.True(t, bytes.HasPrefix(mappings, []byte{0xEF, 0xBB, 0xBF, 'P'}))
+	})
+
+	t.Run("sjis は Shift_JIS で出力する", func(t *testing.T) {
+		japaneseNames := append([]admina.Identity(nil), identities...)
+		japaneseNames[1].DisplayName = "鈴木 花子"
+		mappings, _ := mergeCSV(t, japaneseNames, identity.CSVOptions{Columns: []string{"ChildDisplayName"}, Encoding: "sjis"})
+
+		assert.NotContains(t, string(mappings), "鈴木")
+		decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(mappings)
+		require.NoError(t, err)
+		assert.Equal(t, "ChildDisplayName\n鈴木 花子\n", string(decoded))
+	})
+}
+
+func TestCSVOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options identity.CSVOptions
+		wantErr string
+	}{
+		{"デフォルト", identity.CSVOptions{}, ""},
+		{"片方のファイルにだけある列", identity.CSVOptions{Columns: []string{"ChildEmail", "Reason"}}, ""},
+		{"不明な列", identity.CSVOptions{Columns: []string{"Email"}}, "unknown csv column: Email"},
+		{"片方のファイルだけの列", identity.CSVOptions{Columns: []string{"ParentEmail", "Status"}}, ""},
+		{"不明な文字コード", identity.CSVOptions{Encoding: "euc-jp"}, "unknown csv encoding: euc-jp"},
+		{"引用符は区切り文字にできない", identity.CSVOptions{Delimiter: '"'}, "invalid csv delimiter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCSVDelimiter(t *testing.T) {
+	for value, want := range map[string]rune{"": 0, ",": ',', "tab": '\t', `\t`: '\t', ";": ';', "|": '|', "semicolon": ';'} {
+		got, err := identity.ParseCSVDelimiter(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	_, err := identity.ParseCSVDelimiter("||")
+	assert.Error(t, err)
+}
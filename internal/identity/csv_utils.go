@@ -3,70 +3,90 @@ package identity
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
 )
 
+// utf8BOM は Excel に UTF-8 として認識させるためのバイト列です
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
 // CSVWriter はCSVファイルの書き込みを行うための構造体
+// 出力ディレクトリの既存のファイルは削除しません
 type CSVWriter struct {
 	outputDir string
-	isInit    bool
+	// appendRows が true の場合、既存のファイルに行を追記します
+	appendRows bool
+	options    CSVOptions
 }
 
 // NewCSVWriter は新しいCSVWriterを作成します
-func NewCSVWriter(outputDir string) (*CSVWriter, error) {
-	return &CSVWriter{
-		outputDir: outputDir,
-		isInit:    false,
-	}, nil
-}
-
-// initOutputDir は出力ディレクトリを初期化します
-func (w *CSVWriter) initOutputDir() error {
-	if w.isInit {
-		return nil
+// options が nil の場合は BOM なしの UTF-8、カンマ区切りで書き込みます
+func NewCSVWriter(outputDir string, appendRows bool, options *CSVOptions) (*CSVWriter, error) {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
 	}
-
-	// 出力ディレクトリが存在する場合は削除
-	if _, err := os.Stat(w.outputDir); err == nil {
-		if err := os.RemoveAll(w.outputDir); err != nil {
-			return fmt.Errorf("failed to remove existing directory: %v", err)
-		}
+	writer := &CSVWriter{
+		outputDir:  outputDir,
+		appendRows: appendRows,
 	}
-
-	// 出力ディレクトリの作成
-	if err := os.MkdirAll(w.outputDir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+	if options != nil {
+		writer.options = *options
 	}
-
-	w.isInit = true
-	return nil
+	return writer, nil
 }
 
 // WriteCSV はCSVファイルを書き込みます
+// 追記の場合、既にデータがあるファイルにはヘッダーと BOM を書き込みません
 func (w *CSVWriter) WriteCSV(filename string, headers []string, rows [][]string) error {
-	// 初回書き込み時にディレクトリを初期化
-	if err := w.initOutputDir(); err != nil {
-		return err
-	}
-
 	// ファイルパスの作成
 	filePath := filepath.Join(w.outputDir, filename)
 
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if w.appendRows {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
 	// ファイルの作成
-	file, err := os.Create(filePath)
+	file, err := os.OpenFile(filePath, flags, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %v", err)
 	}
 	defer file.Close()
 
+	writeHeaders := true
+	if w.appendRows {
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %v", err)
+		}
+		writeHeaders = info.Size() == 0
+	}
+
+	if writeHeaders && w.options.Encoding == "utf8bom" {
+		if _, err := file.Write(utf8BOM); err != nil {
+			return fmt.Errorf("failed to write BOM: %v", err)
+		}
+	}
+
 	// CSVライターの作成
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	var out io.Writer = file
+	if w.options.Encoding == "sjis" {
+		out = encoding.ReplaceUnsupported(japanese.ShiftJIS.NewEncoder()).Writer(file)
+	}
+	writer := csv.NewWriter(out)
+	if w.options.Delimiter != 0 {
+		writer.Comma = w.options.Delimiter
+	}
 
 	// ヘッダーの書き込み
-	if err := writer.Write(headers); err != nil {
-		return fmt.Errorf("failed to write headers: %v", err)
+	if writeHeaders {
+		if err := writer.Write(headers); err != nil {
+			return fmt.Errorf("failed to write headers: %v", err)
+		}
 	}
 
 	// データの書き込み
@@ -76,5 +96,9 @@ func (w *CSVWriter) WriteCSV(filename string, headers []string, rows [][]string)
 		}
 	}
 
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %v", err)
+	}
 	return nil
 }
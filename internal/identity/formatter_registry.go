@@ -0,0 +1,194 @@
+package identity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+)
+
+// FormatContext はフォーマッタの作成に必要な設定です
+type FormatContext struct {
+	// Organization は html・template 出力のヘッダーに表示する組織情報です
+	Organization *admina.Organization
+	// Template は template 出力で使用するテンプレートのファイルまたは同梱のテンプレート名です
+	Template string
+}
+
+// FormatInfo は登録されている出力フォーマットの説明です
+type FormatInfo struct {
+	Name        string
+	Description string
+	// RequiresFile が true のフォーマットは標準出力に出力できません
+	RequiresFile bool
+}
+
+type formatEntry[T any] struct {
+	info    FormatInfo
+	factory func(ctx *FormatContext) (T, error)
+}
+
+// FormatRegistry は出力フォーマットを名前で登録・検索します
+type FormatRegistry[T any] struct {
+	command string
+	entries map[string]formatEntry[T]
+	order   []string
+}
+
+// NewFormatRegistry はコマンドの出力フォーマットの登録先を作成します
+func NewFormatRegistry[T any](command string) *FormatRegistry[T] {
+	return &FormatRegistry[T]{command: command, entries: make(map[string]formatEntry[T])}
+}
+
+// Register は出力フォーマットを登録します。同じ名前を2回登録すると panic します
+func (r *FormatRegistry[T]) Register(info FormatInfo, factory func(ctx *FormatContext) (T, error)) {
+	if _, exists := r.entries[info.Name]; exists {
+		panic(fmt.Sprintf("output format %q is already registered for %s", info.Name, r.command))
+	}
+	r.entries[info.Name] = formatEntry[T]{info: info, factory: factory}
+	r.order = append(r.order, info.Name)
+}
+
+// New は名前に対応するフォーマッタを作成します
+func (r *FormatRegistry[T]) New(name string, ctx *FormatContext) (T, error) {
+	entry, exists := r.entries[name]
+	if !exists {
+		var zero T
+		return zero, fmt.Errorf("unknown output format: %s (available for %s: %s)", name, r.command, strings.Join(r.order, ", "))
+	}
+	if ctx == nil {
+		ctx = &FormatContext{}
+	}
+	return entry.factory(ctx)
+}
+
+// Lookup は名前に対応するフォーマットの説明を返します
+func (r *FormatRegistry[T]) Lookup(name string) (FormatInfo, bool) {
+	entry, exists := r.entries[name]
+	return entry.info, exists
+}
+
+// Command は登録先のコマンド名を返します
+func (r *FormatRegistry[T]) Command() string {
+	return r.command
+}
+
+// Formats は登録順に出力フォーマットの説明を返します
+func (r *FormatRegistry[T]) Formats() []FormatInfo {
+	formats := make([]FormatInfo, 0, len(r.order))
+	for _, name := range r.order {
+		formats = append(formats, r.entries[name].info)
+	}
+	return formats
+}
+
+// formatLister は型パラメータの異なる登録先をまとめて扱うためのインターフェースです
+type formatLister interface {
+	Command() string
+	Formats() []FormatInfo
+}
+
+// 各コマンドの出力フォーマットの登録先
+var (
+	MatrixFormats    = NewFormatRegistry[MatrixFormatter]("matrix")
+	MergeFormats     = NewFormatRegistry[Formatter]("samemerge")
+	ListFormats      = NewFormatRegistry[ListFormatter]("list")
+	DetailFormats    = NewFormatRegistry[DetailFormatter]("show")
+	DiffFormats      = NewFormatRegistry[DiffFormatter]("diff")
+	DuplicateFormats = NewFormatRegistry[DuplicateFormatter]("duplicates")
+	CompareFormats   = NewFormatRegistry[CompareFormatter]("compare")
+)
+
+func allFormatRegistries() []formatLister {
+	return []formatLister{MatrixFormats, MergeFormats, ListFormats, DetailFormats, DiffFormats, DuplicateFormats, CompareFormats}
+}
+
+// FormatHelp は --output help で表示する、コマンドごとの出力フォーマットの一覧を返します
+func FormatHelp() string {
+	var output strings.Builder
+	output.WriteString("Available output formats:\n")
+	for _, registry := range allFormatRegistries() {
+		output.WriteString(fmt.Sprintf("\n%s:\n", registry.Command()))
+		for _, format := range registry.Formats() {
+			description := format.Description
+			if format.RequiresFile {
+				description += " (requires --output-file)"
+			}
+			output.WriteString(fmt.Sprintf("  %-10s %s\n", format.Name, description))
+		}
+	}
+
+	names := BuiltinTemplateNames()
+	sort.Strings(names)
+	output.WriteString(fmt.Sprintf("\nBuiltin templates for --template: %s\n", strings.Join(names, ", ")))
+	return output.String()
+}
+
+// static は設定を必要としないフォーマッタの factory を作成します
+func static[T any](formatter T) func(*FormatContext) (T, error) {
+	return func(*FormatContext) (T, error) {
+		return formatter, nil
+	}
+}
+
+func init() {
+	MatrixFormats.Register(FormatInfo{Name: "json", Description: "JSON including totals and percentages"}, static[MatrixFormatter](&JSONMatrixFormatter{}))
+	MatrixFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown table"}, static[MatrixFormatter](&MarkdownMatrixFormatter{}))
+	MatrixFormats.Register(FormatInfo{Name: "pretty", Description: "aligned plain-text table"}, static[MatrixFormatter](&PrettyMatrixFormatter{}))
+	MatrixFormats.Register(FormatInfo{Name: "csv", Description: "comma-separated values"}, static[MatrixFormatter](&CSVMatrixFormatter{}))
+	MatrixFormats.Register(FormatInfo{Name: "tsv", Description: "tab-separated values"}, static[MatrixFormatter](&CSVMatrixFormatter{Delimiter: '\t'}))
+	MatrixFormats.Register(FormatInfo{Name: "xlsx", Description: "Excel workbook, one sheet per group", RequiresFile: true}, static[MatrixFormatter](&XLSXMatrixFormatter{}))
+	MatrixFormats.Register(FormatInfo{Name: "html", Description: "self-contained HTML report"}, func(ctx *FormatContext) (MatrixFormatter, error) {
+		return &HTMLMatrixFormatter{Organization: ctx.Organization}, nil
+	})
+	MatrixFormats.Register(FormatInfo{Name: "template", Description: "user-defined text/template (--template)"}, func(ctx *FormatContext) (MatrixFormatter, error) {
+		tmpl, err := LoadTemplate(ctx.Template)
+		if err != nil {
+			return nil, err
+		}
+		return &TemplateMatrixFormatter{Template: tmpl, Organization: ctx.Organization}, nil
+	})
+
+	MergeFormats.Register(FormatInfo{Name: "json", Description: "one JSON object per candidate"}, static[Formatter](&JSONFormatter{}))
+	MergeFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown table of candidates"}, static[Formatter](&MarkdownFormatter{}))
+	MergeFormats.Register(FormatInfo{Name: "pretty", Description: "plain-text list of candidates"}, static[Formatter](&PrettyFormatter{}))
+	MergeFormats.Register(FormatInfo{Name: "csv", Description: "candidates as CSV"}, static[Formatter](&CSVFormatter{}))
+	MergeFormats.Register(FormatInfo{Name: "html", Description: "self-contained HTML report written to the output directory"}, func(ctx *FormatContext) (Formatter, error) {
+		return &HTMLFormatter{Organization: ctx.Organization}, nil
+	})
+	MergeFormats.Register(FormatInfo{Name: "template", Description: "user-defined text/template (--template)"}, func(ctx *FormatContext) (Formatter, error) {
+		tmpl, err := LoadTemplate(ctx.Template)
+		if err != nil {
+			return nil, err
+		}
+		return &TemplateFormatter{Template: tmpl, Organization: ctx.Organization}, nil
+	})
+
+	ListFormats.Register(FormatInfo{Name: "json", Description: "JSON array of identities"}, static[ListFormatter](&JSONListFormatter{}))
+	ListFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown table"}, static[ListFormatter](&MarkdownListFormatter{}))
+	ListFormats.Register(FormatInfo{Name: "pretty", Description: "aligned plain-text table"}, static[ListFormatter](&PrettyListFormatter{}))
+
+	DetailFormats.Register(FormatInfo{Name: "json", Description: "JSON array of identity details"}, static[DetailFormatter](&JSONDetailFormatter{}))
+	DetailFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown sections"}, static[DetailFormatter](&MarkdownDetailFormatter{}))
+	DetailFormats.Register(FormatInfo{Name: "pretty", Description: "plain-text details"}, static[DetailFormatter](&PrettyDetailFormatter{}))
+
+	DiffFormats.Register(FormatInfo{Name: "json", Description: "JSON diff including the matrix delta"}, static[DiffFormatter](&JSONDiffFormatter{}))
+	DiffFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown report"}, static[DiffFormatter](&MarkdownDiffFormatter{}))
+	DiffFormats.Register(FormatInfo{Name: "pretty", Description: "plain-text report"}, static[DiffFormatter](&PrettyDiffFormatter{}))
+	DiffFormats.Register(FormatInfo{Name: "csv", Description: "one change per row"}, static[DiffFormatter](&CSVDiffFormatter{}))
+
+	DuplicateFormats.Register(FormatInfo{Name: "json", Description: "JSON clusters with links and scores"}, static[DuplicateFormatter](&JSONDuplicateFormatter{}))
+	DuplicateFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown table per cluster"}, static[DuplicateFormatter](&MarkdownDuplicateFormatter{}))
+	DuplicateFormats.Register(FormatInfo{Name: "pretty", Description: "plain-text list of clusters"}, static[DuplicateFormatter](&PrettyDuplicateFormatter{}))
+	DuplicateFormats.Register(FormatInfo{Name: "csv", Description: "one identity per row"}, static[DuplicateFormatter](&CSVDuplicateFormatter{}))
+	DuplicateFormats.Register(FormatInfo{Name: "html", Description: "self-contained HTML report"}, func(ctx *FormatContext) (DuplicateFormatter, error) {
+		return &HTMLDuplicateFormatter{Organization: ctx.Organization}, nil
+	})
+
+	CompareFormats.Register(FormatInfo{Name: "json", Description: "JSON with overlaps, mismatches and one-sided identities"}, static[CompareFormatter](&JSONCompareFormatter{}))
+	CompareFormats.Register(FormatInfo{Name: "markdown", Description: "Markdown report"}, static[CompareFormatter](&MarkdownCompareFormatter{}))
+	CompareFormats.Register(FormatInfo{Name: "pretty", Description: "plain-text report"}, static[CompareFormatter](&PrettyCompareFormatter{}))
+	CompareFormats.Register(FormatInfo{Name: "csv", Description: "one pair or one-sided identity per row"}, static[CompareFormatter](&CSVCompareFormatter{}))
+	CompareFormats.Register(FormatInfo{Name: "html", Description: "self-contained HTML report"}, static[CompareFormatter](&HTMLCompareFormatter{}))
+}
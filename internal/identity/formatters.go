@@ -1,10 +1,10 @@
 package identity
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
@@ -18,15 +18,23 @@ func (f *JSONFormatter) Format(result *MergeResult, mergedCount, skippedCount in
 
 	for i, candidate := range result.Candidates {
 		data := struct {
-			Index  int             `json:"index"`
-			Status string          `json:"status"`
-			Parent admina.Identity `json:"parent"`
-			Child  admina.Identity `json:"child"`
+			Index            int             `json:"index"`
+			Status           string          `json:"status"`
+			Reason           string          `json:"reason,omitempty"`
+			Parent           admina.Identity `json:"parent"`
+			Child            admina.Identity `json:"child"`
+			NameSimilarity   float64         `json:"nameSimilarity"`
+			AfterMerge       string          `json:"afterMerge,omitempty"`
+			AfterMergeStatus string          `json:"afterMergeStatus,omitempty"`
 		}{
-			Index:  i + 1,
-			Status: candidate.Status,
-			Parent: candidate.Parent,
-			Child:  candidate.Child,
+			Index:            i + 1,
+			Status:           candidate.Status,
+			Reason:           candidate.Reason,
+			Parent:           candidate.Parent,
+			Child:            candidate.Child,
+			NameSimilarity:   candidate.NameSimilarity,
+			AfterMerge:       candidate.AfterMerge,
+			AfterMergeStatus: candidate.AfterMergeStatus,
 		}
 
 		data.Parent.Email = MaskEmail(data.Parent.Email)
@@ -51,14 +59,27 @@ func (f *MarkdownFormatter) Format(result *MergeResult, mergedCount, skippedCoun
 
 	output.WriteString("# Merge Result\n\n")
 	output.WriteString("## Candidates\n\n")
-	output.WriteString("| No. | Status | Parent | Child |\n")
-	output.WriteString("|-----|--------|---------|--------|\n")
+	// マージ後の処理が指定されている場合のみ列を追加する
+	withAfterMerge := hasAfterMerge(result)
+	if withAfterMerge {
+		output.WriteString("| No. | Status | Parent | Child | Name Similarity | After Merge |\n")
+		output.WriteString("|-----|--------|---------|--------|-----------------|-------------|\n")
+	} else {
+		output.WriteString("| No. | Status | Parent | Child | Name Similarity |\n")
+		output.WriteString("|-----|--------|---------|--------|-----------------|\n")
+	}
 
 	for i, candidate := range result.Candidates {
 		parentEmail := MaskEmail(candidate.Parent.Email)
 		childEmail := MaskEmail(candidate.Child.Email)
-		output.WriteString(fmt.Sprintf("| %d | %s | %s | %s |\n",
-			i+1, candidate.Status, parentEmail, childEmail))
+		similarity := formatScore(candidate.NameSimilarity)
+		if withAfterMerge {
+			output.WriteString(fmt.Sprintf("| %d | %s | %s | %s | %s | %s (%s) |\n",
+				i+1, candidate.Status, parentEmail, childEmail, similarity, candidate.AfterMerge, candidate.AfterMergeStatus))
+			continue
+		}
+		output.WriteString(fmt.Sprintf("| %d | %s | %s | %s | %s |\n",
+			i+1, candidate.Status, parentEmail, childEmail, similarity))
 	}
 
 	return output.String(), nil
@@ -76,71 +97,49 @@ func (f *PrettyFormatter) Format(result *MergeResult, mergedCount, skippedCount
 	for i, candidate := range result.Candidates {
 		parentEmail := MaskEmail(candidate.Parent.Email)
 		childEmail := MaskEmail(candidate.Child.Email)
-		output.WriteString(fmt.Sprintf("%d. %s -> %s\n",
-			i+1, childEmail, parentEmail))
+		output.WriteString(fmt.Sprintf("%d. %s -> %s (name similarity %s)",
+			i+1, childEmail, parentEmail, formatScore(candidate.NameSimilarity)))
+		if candidate.Status == "NeedsReview" {
+			output.WriteString(" [needs review]")
+		}
+		if candidate.AfterMerge != "" {
+			output.WriteString(fmt.Sprintf(" [after merge: %s (%s)]", candidate.AfterMerge, candidate.AfterMergeStatus))
+		}
+		output.WriteString("\n")
 	}
 
 	return output.String(), nil
 }
 
-// CSVFormatter の実装
-type CSVFormatter struct {
-	OutputDir string
-}
-
-func (f *CSVFormatter) Format(result *MergeResult, mergedCount, skippedCount int) (string, error) {
-	// 環境変数が設定されているか確認
-	projectRoot := os.Getenv("ADMINA_CLI_ROOT")
-	if projectRoot == "" {
-		// 環境変数が設定されていない場合、プロジェクトルートのディレクトリを取得
-		var err error
-		projectRoot, err = os.Getwd()
-		if err != nil {
-			return "", fmt.Errorf("failed to get working directory: %v", err)
+// hasAfterMerge はマージ後の処理が記録された候補があるかを返します
+func hasAfterMerge(result *MergeResult) bool {
+	for _, candidate := range result.Candidates {
+		if candidate.AfterMerge != "" {
+			return true
 		}
 	}
-	f.OutputDir = filepath.Join(projectRoot, "out", "data")
-
-	csvWriter, err := NewCSVWriter(f.OutputDir)
-	if err != nil {
-		return "", err
-	}
+	return false
+}
 
-	// マッピングファイルの作成
-	mappingRows := make([][]string, 0, len(result.Candidates))
-	for _, candidate := range result.Candidates {
-		parentEmail := MaskEmail(candidate.Parent.Email)
-		childEmail := MaskEmail(candidate.Child.Email)
-		mappingRows = append(mappingRows, []string{
-			parentEmail,
-			candidate.Parent.ID,
-			childEmail,
-			candidate.Child.ID,
-			candidate.Status,
-		})
-	}
+// CSVFormatter の実装
+// identity_mappings.csv と同じ列を返します。ファイルは出力ディレクトリに書き込まれます
+type CSVFormatter struct{}
 
-	if err := csvWriter.WriteCSV("identity_mappings.csv",
-		[]string{"ParentEmail", "ParentIdentityID", "ChildEmail", "ChildIdentityID", "Status"},
-		mappingRows); err != nil {
+func (f *CSVFormatter) Format(result *MergeResult, mergedCount, skippedCount int) (string, error) {
+	headers, rows := mappingTable(result, &CSVOptions{})
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(headers); err != nil {
 		return "", err
 	}
-
-	// アンマップファイルの作成
-	unmappedRows := make([][]string, 0, len(result.Unmapped))
-	for _, unmapped := range result.Unmapped {
-		childEmail := MaskEmail(unmapped.Email)
-		unmappedRows = append(unmappedRows, []string{
-			childEmail,
-			unmapped.ID,
-		})
-	}
-
-	if err := csvWriter.WriteCSV("unmapped_child_identities.csv",
-		[]string{"ChildEmail", "ChildIdentityID"},
-		unmappedRows); err != nil {
+	if err := writer.WriteAll(rows); err != nil {
 		return "", err
 	}
-
-	return fmt.Sprintf("CSV files written to %s\n", f.OutputDir), nil
+	return buf.String(), nil
 }
+
+// マージ結果のCSVファイル名
+const (
+	mappingsFileName = "identity_mappings.csv"
+	unmappedFileName = "unmapped_child_identities.csv"
+)
@@ -0,0 +1,131 @@
+package identity_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formatterTestContext は template フォーマットでも使用できるように同梱のテンプレートを指定します
+func formatterTestContext(templateName string) *identity.FormatContext {
+	return &identity.FormatContext{Organization: htmlTestOrganization, Template: templateName}
+}
+
+func TestMatrixFormats(t *testing.T) {
+	matrix, err := identity.GetIdentityMatrix(&mock.Client{Identities: listTestIdentities}, &identity.MatrixOptions{Group: "domain", Percent: "total"})
+	require.NoError(t, err)
+
+	for _, format := range identity.MatrixFormats.Formats() {
+		t.Run(format.Name, func(t *testing.T) {
+			formatter, err := identity.MatrixFormats.New(format.Name, formatterTestContext("builtin:matrix-summary"))
+			require.NoError(t, err)
+
+			output, err := formatter.Format(matrix)
+			require.NoError(t, err)
+			assert.NotEmpty(t, output)
+			if !format.RequiresFile {
+				// テキストのフォーマットはすべて行の値を含む
+				assert.Contains(t, output, "managed")
+			}
+		})
+	}
+}
+
+func TestMergeFormats(t *testing.T) {
+	result := &identity.MergeResult{
+		Candidates: []identity.MergeCandidate{{Parent: testIdentities[0], Child: testIdentities[1], Status: "Skip", Reason: "dry-run"}},
+		Unmapped:   testIdentities[2:],
+		Summary:    &identity.MergeSummary{TotalIdentities: 3, MergeCandidates: 1, UnmappedIdentities: 1},
+	}
+
+	for _, format := range identity.MergeFormats.Formats() {
+		t.Run(format.Name, func(t *testing.T) {
+			formatter, err := identity.MergeFormats.New(format.Name, formatterTestContext("builtin:merge-summary"))
+			require.NoError(t, err)
+
+			output, err := formatter.Format(result, 0, 1)
+			require.NoError(t, err)
+			assert.Contains(t, output, "use**@child.domain.com")
+			assert.NotContains(t, output, "user1@child.domain.com")
+		})
+	}
+}
+
+func TestReadOnlyCommandFormats(t *testing.T) {
+	list, err := identity.ListIdentities(listTestIdentities, &identity.ListOptions{})
+	require.NoError(t, err)
+	for _, format := range identity.ListFormats.Formats() {
+		formatter, err := identity.ListFormats.New(format.Name, nil)
+		require.NoError(t, err)
+		output, err := formatter.Format(list)
+		require.NoError(t, err, format.Name)
+		assert.Contains(t, output, "Hanako Suzuki", format.Name)
+	}
+
+	details := identity.GetIdentityDetails(listTestIdentities, "200", &identity.ShowOptions{})
+	for _, format := range identity.DetailFormats.Formats() {
+		formatter, err := identity.DetailFormats.New(format.Name, nil)
+		require.NoError(t, err)
+		output, err := formatter.Format(details)
+		require.NoError(t, err, format.Name)
+		assert.Contains(t, output, "Hanako Suzuki", format.Name)
+	}
+
+	snapshot := func(identities ...int) *identity.Snapshot {
+		s := &identity.Snapshot{SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Now()}}
+		for _, i := range identities {
+			s.Identities = append(s.Identities, listTestIdentities[i])
+		}
+		return s
+	}
+	diff := identity.DiffSnapshots(snapshot(0, 1), snapshot(0, 2))
+	for _, format := range identity.DiffFormats.Formats() {
+		formatter, err := identity.DiffFormats.New(format.Name, nil)
+		require.NoError(t, err)
+		output, err := formatter.Format(diff)
+		require.NoError(t, err, format.Name)
+		assert.Contains(t, output, "jir*@parent.domain.com", format.Name)
+	}
+}
+
+func TestFormatRegistry(t *testing.T) {
+	t.Run("不明なフォーマットは使用できる値を表示する", func(t *testing.T) {
+		_, err := identity.MatrixFormats.New("yaml", nil)
+		require.Error(t, err)
+		assert.Equal(t, "unknown output format: yaml (available for matrix: json, markdown, pretty, csv, tsv, xlsx, html, template)", err.Error())
+	})
+
+	t.Run("template はテンプレートの指定が必須", func(t *testing.T) {
+		_, err := identity.MergeFormats.New("template", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("xlsx はファイル出力のみ", func(t *testing.T) {
+		info, ok := identity.MatrixFormats.Lookup("xlsx")
+		require.True(t, ok)
+		assert.True(t, info.RequiresFile)
+	})
+
+	t.Run("同じ名前の登録は panic する", func(t *testing.T) {
+		registry := identity.NewFormatRegistry[identity.MatrixFormatter]("test")
+		factory := func(*identity.FormatContext) (identity.MatrixFormatter, error) {
+			return &identity.JSONMatrixFormatter{}, nil
+		}
+		registry.Register(identity.FormatInfo{Name: "json"}, factory)
+		assert.Panics(t, func() { registry.Register(identity.FormatInfo{Name: "json"}, factory) })
+	})
+
+	t.Run("--output help はすべてのコマンドのフォーマットを表示する", func(t *testing.T) {
+		help := identity.FormatHelp()
+		for _, command := range []string{"matrix:", "samemerge:", "list:", "show:", "diff:"} {
+			assert.Contains(t, help, command)
+		}
+		assert.Contains(t, help, "xlsx       Excel workbook, one sheet per group (requires --output-file)")
+		assert.True(t, strings.Contains(help, "builtin:merge-email"))
+	})
+}
@@ -15,6 +15,24 @@ type Client interface {
 	MergeIdentities(ctx context.Context, fromPeopleID, toPeopleID int) (admina.MergeIdentity, error)
 }
 
+// IdentityCreator はアイデンティティの作成に対応したクライアントです
+type IdentityCreator interface {
+	Client
+	CreateIdentity(ctx context.Context, req *admina.CreateIdentityRequest) (*admina.Identity, error)
+}
+
+// IdentityDeleter はアイデンティティの削除に対応したクライアントです
+type IdentityDeleter interface {
+	Client
+	DeleteIdentity(ctx context.Context, identityID string) error
+}
+
+// IdentityUpdater はアイデンティティの属性の変更に対応したクライアントです
+type IdentityUpdater interface {
+	Client
+	UpdateIdentity(ctx context.Context, identityID string, req *admina.UpdateIdentityRequest) (*admina.Identity, error)
+}
+
 // Common utility functions
 func FetchAllIdentities(client Client) ([]admina.Identity, error) {
 	var allIdentities []admina.Identity
@@ -0,0 +1,157 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// マージ後に子アイデンティティへ行う処理の種類
+const (
+	AfterMergeNone      = "none"
+	AfterMergeSetStatus = "set-status"
+	AfterMergeDelete    = "delete"
+)
+
+// AfterMergeAction はマージに成功した子アイデンティティに行う処理です
+// ゼロ値は何もしない (none) を表します
+type AfterMergeAction struct {
+	Kind string
+	// Status は set-status で設定する従業員ステータスです
+	Status string
+}
+
+// ParseAfterMergeAction は --after-merge の値を解析します
+// 指定できる値: none, delete, set-status=<従業員ステータス>
+func ParseAfterMergeAction(value string) (AfterMergeAction, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "" || value == AfterMergeNone:
+		return AfterMergeAction{}, nil
+	case value == AfterMergeDelete:
+		return AfterMergeAction{Kind: AfterMergeDelete}, nil
+	case strings.HasPrefix(value, AfterMergeSetStatus+"="):
+		status := strings.TrimSpace(strings.TrimPrefix(value, AfterMergeSetStatus+"="))
+		if !contains(CreateEmployeeStatuses, status) {
+			return AfterMergeAction{}, fmt.Errorf("unknown employeeStatus for --after-merge: %q (must be one of %s)", status, strings.Join(CreateEmployeeStatuses, ", "))
+		}
+		return AfterMergeAction{Kind: AfterMergeSetStatus, Status: status}, nil
+	}
+	return AfterMergeAction{}, fmt.Errorf("invalid --after-merge value %q: must be none, delete or set-status=<status>", value)
+}
+
+// IsNone は処理が指定されていないかを返します
+func (a AfterMergeAction) IsNone() bool {
+	return a.Kind == "" || a.Kind == AfterMergeNone
+}
+
+// String は --after-merge と同じ形式で処理を返します
+func (a AfterMergeAction) String() string {
+	switch {
+	case a.IsNone():
+		return AfterMergeNone
+	case a.Kind == AfterMergeSetStatus:
+		return AfterMergeSetStatus + "=" + a.Status
+	}
+	return a.Kind
+}
+
+// checkClient はクライアントが処理に必要な API に対応しているかを確認します
+func (a AfterMergeAction) checkClient(client Client) error {
+	switch a.Kind {
+	case AfterMergeSetStatus:
+		if _, ok := client.(IdentityUpdater); !ok {
+			return fmt.Errorf("client does not support updating identities required by --after-merge %s", a)
+		}
+	case AfterMergeDelete:
+		if _, ok := client.(IdentityDeleter); !ok {
+			return fmt.Errorf("client does not support deleting identities required by --after-merge %s", a)
+		}
+	}
+	return nil
+}
+
+// afterMergeRunner はマージ後の処理を実行し、削除した子アイデンティティを復元用ファイルに記録します
+type afterMergeRunner struct {
+	action       AfterMergeAction
+	force        bool
+	client       Client
+	run          *OutputRun
+	organization *admina.Organization
+	recovery     *recoveryFile
+	// deleted は復元用ファイルに記録した子アイデンティティの件数です
+	deleted int
+}
+
+// plan はマージ候補に処理内容を記録します。マージに成功しなかった候補は Skip になります
+// delete では identity delete と同じく、--force なしでは managed の子を Skip にします
+func (r *afterMergeRunner) plan(candidate *MergeCandidate, dryRun bool) {
+	if r.action.IsNone() {
+		return
+	}
+	candidate.AfterMerge = r.action.String()
+	planned := dryRun && candidate.Status == "Skip" && candidate.Reason == ""
+	if !planned && candidate.Status != "Success" {
+		candidate.AfterMergeStatus = "Skip"
+		candidate.AfterMergeReason = "not merged"
+		return
+	}
+	if r.action.Kind == AfterMergeDelete {
+		if reason := deleteRefusedReason(candidate.Child, r.force); reason != "" {
+			candidate.AfterMergeStatus = "Skip"
+			candidate.AfterMergeReason = reason
+			return
+		}
+	}
+	if planned {
+		candidate.AfterMergeStatus = "Planned"
+		candidate.AfterMergeReason = "dry-run"
+	}
+}
+
+// apply はマージに成功した候補に処理を行います。失敗した場合はエラーを返します
+func (r *afterMergeRunner) apply(ctx context.Context, candidate *MergeCandidate) error {
+	if r.action.IsNone() || candidate.Status != "Success" || candidate.AfterMergeStatus == "Skip" {
+		return nil
+	}
+
+	child := candidate.Child
+	var err error
+	switch r.action.Kind {
+	case AfterMergeSetStatus:
+		status := r.action.Status
+		_, err = r.client.(IdentityUpdater).UpdateIdentity(ctx, child.ID, &admina.UpdateIdentityRequest{EmployeeStatus: &status})
+	case AfterMergeDelete:
+		// 削除の前に復元用ファイルを更新しておく
+		if err = r.writeRecovery(child); err == nil {
+			err = r.client.(IdentityDeleter).DeleteIdentity(ctx, child.ID)
+		}
+	}
+
+	if err != nil {
+		logger.LogInfo("Failed to apply %s to %s: %v", r.action, MaskEmail(child.Email), err)
+		candidate.AfterMergeStatus = "Error"
+		candidate.AfterMergeReason = fmt.Sprintf("Failed to apply %s: %v", r.action, err)
+		return err
+	}
+	logger.LogInfo("Applied %s to %s (%s)", r.action, MaskEmail(child.Email), child.ID)
+	candidate.AfterMergeStatus = "Success"
+	return nil
+}
+
+func (r *afterMergeRunner) writeRecovery(child admina.Identity) error {
+	if err := r.run.Prepare(); err != nil {
+		return err
+	}
+	if r.recovery == nil {
+		r.recovery = newRecoveryFile(r.run.Dir, r.organization)
+	}
+	if err := r.recovery.add(child); err != nil {
+		return err
+	}
+	r.deleted++
+	return nil
+}
@@ -0,0 +1,178 @@
+package identity_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAfterMergeAction(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    identity.AfterMergeAction
+		wantErr string
+	}{
+		{value: "", want: identity.AfterMergeAction{}},
+		{value: "none", want: identity.AfterMergeAction{}},
+		{value: "delete", want: identity.AfterMergeAction{Kind: identity.AfterMergeDelete}},
+		{value: "set-status=retired", want: identity.AfterMergeAction{Kind: identity.AfterMergeSetStatus, Status: "retired"}},
+		{value: "set-status=sleeping", wantErr: `unknown employeeStatus for --after-merge: "sleeping"`},
+		{value: "archive", wantErr: `invalid --after-merge value "archive"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			action, err := identity.ParseAfterMergeAction(tt.value)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, action)
+		})
+	}
+	assert.Equal(t, "set-status=retired", identity.AfterMergeAction{Kind: identity.AfterMergeSetStatus, Status: "retired"}.String())
+	assert.Equal(t, "none", identity.AfterMergeAction{}.String())
+}
+
+func TestMergeIdentitiesAfterMerge(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	newConfig := func(t *testing.T, action string) *identity.MergeConfig {
+		afterMerge, err := identity.ParseAfterMergeAction(action)
+		require.NoError(t, err)
+		return &identity.MergeConfig{
+			ParentDomain:  "parent.domain.com",
+			ChildDomains:  []string{"child.domain.com"},
+			AutoApprove:   true,
+			OutputFormat:  "json",
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+			CSV:           identity.CSVOptions{Columns: []string{"ChildIdentityID", "Status", "AfterMerge", "AfterMergeStatus", "AfterMergeReason"}},
+			AfterMerge:    afterMerge,
+		}
+	}
+	readMappings := func(t *testing.T, outputDir string) [][]string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_mappings.csv"))
+		require.NoError(t, err)
+		return readCSV(t, content)
+	}
+
+	t.Run("dry-run では予定として出力する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t, "set-status=retired")
+		config.DryRun = true
+		require.NoError(t, identity.MergeIdentities(client, config))
+		assert.Empty(t, client.UpdateRequests)
+		assert.Equal(t, []string{"200", "Skip", "set-status=retired", "Planned", "dry-run"}, readMappings(t, config.OutputDir)[1])
+	})
+
+	t.Run("マージに成功した子のステータスを変更する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t, "set-status=retired")
+		require.NoError(t, identity.MergeIdentities(client, config))
+		require.Contains(t, client.UpdateRequests, "200")
+		assert.Equal(t, "retired", *client.UpdateRequests["200"].EmployeeStatus)
+		assert.Nil(t, client.UpdateRequests["200"].DisplayName)
+		assert.Equal(t, []string{"200", "Success", "set-status=retired", "Success", ""}, readMappings(t, config.OutputDir)[1])
+
+		manifest, err := identity.ReadManifest(config.OutputDir)
+		require.NoError(t, err)
+		assert.Equal(t, "set-status=retired", manifest.AfterMerge)
+	})
+
+	t.Run("マージに成功した子を削除し、復元用ファイルを出力する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t, "delete")
+		require.NoError(t, identity.MergeIdentities(client, config))
+		assert.Equal(t, []string{"200"}, client.DeletedIDs)
+
+		recovery, err := identity.ReadSnapshotFile(filepath.Join(config.OutputDir, identity.RecoveryFileName))
+		require.NoError(t, err)
+		assert.Equal(t, testIdentities[1:2], recovery.Identities)
+
+		manifest, err := identity.ReadManifest(config.OutputDir)
+		require.NoError(t, err)
+		assert.Equal(t, identity.RecoveryFileName, manifest.Files[1].Name)
+	})
+
+	t.Run("同じ出力先では以前の復元用ファイルに追記する", func(t *testing.T) {
+		outputDir := t.TempDir()
+		for i := 0; i < 2; i++ {
+			config := newConfig(t, "delete")
+			config.OutputDir = outputDir
+			require.NoError(t, identity.MergeIdentities(&mock.Client{Identities: testIdentities}, config))
+		}
+
+		recovery, err := identity.ReadSnapshotFile(filepath.Join(outputDir, identity.RecoveryFileName))
+		require.NoError(t, err)
+		assert.Equal(t, []admina.Identity{testIdentities[1], testIdentities[1]}, recovery.Identities)
+	})
+
+	t.Run("managed の子は --force なしでは削除しない", func(t *testing.T) {
+		identities := []admina.Identity{
+			{ID: "100", PeopleID: 101, DisplayName: "Parent", ManagementType: "managed", Email: "a@parent.domain.com"},
+			{ID: "200", PeopleID: 201, DisplayName: "Child", ManagementType: "managed", Email: "a@child.domain.com"},
+		}
+		for _, tt := range []struct {
+			name    string
+			force   bool
+			dryRun  bool
+			want    []string
+			deleted []string
+		}{
+			{name: "skip", want: []string{"200", "Success", "delete", "Skip", "managed identity requires --force"}},
+			{name: "dry-run", dryRun: true, want: []string{"200", "Skip", "delete", "Skip", "managed identity requires --force"}},
+			{name: "force", force: true, want: []string{"200", "Success", "delete", "Success", ""}, deleted: []string{"200"}},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				client := &mock.Client{Identities: identities}
+				config := newConfig(t, "delete")
+				config.Force = tt.force
+				config.DryRun = tt.dryRun
+				require.NoError(t, identity.MergeIdentities(client, config))
+				assert.Equal(t, tt.deleted, client.DeletedIDs)
+				assert.Equal(t, tt.want, readMappings(t, config.OutputDir)[1])
+				if tt.deleted == nil {
+					assert.NoFileExists(t, filepath.Join(config.OutputDir, identity.RecoveryFileName))
+				}
+			})
+		}
+	})
+
+	t.Run("マージ後の処理の失敗はエラーとして記録する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities, DeleteErrors: map[string]error{"200": fmt.Errorf("409 conflict")}}
+		config := newConfig(t, "delete")
+		err := identity.MergeIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 1 errors, 1 merged, 0 skipped")
+		assert.Equal(t, []string{"200", "Success", "delete", "Error", "Failed to apply delete: 409 conflict"}, readMappings(t, config.OutputDir)[1])
+	})
+
+	t.Run("マージしなかったペアには行わない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t, "delete")
+		// managed の子は external の親にマージできない
+		config.PairsFile = writeCSVFile(t, "child,parent\n100,200\n")
+		require.NoError(t, identity.MergeIdentities(client, config))
+		assert.Empty(t, client.MergeResults)
+		assert.Empty(t, client.DeletedIDs)
+		assert.Equal(t, []string{"100", "Skip", "delete", "Skip", "not merged"}, readMappings(t, config.OutputDir)[1])
+		assert.NoFileExists(t, filepath.Join(config.OutputDir, identity.RecoveryFileName))
+	})
+
+	t.Run("処理に対応していないクライアントではマージしない", func(t *testing.T) {
+		offline := identity.NewCachedClient(nil, identity.NewSnapshotStore(t.TempDir()), "123", 0, true)
+		err := identity.MergeIdentities(offline, newConfig(t, "set-status=retired"))
+		assert.ErrorContains(t, err, "client does not support updating identities")
+	})
+}
@@ -0,0 +1,399 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// 2つの組織のアイデンティティを対応付けた手がかり
+const (
+	// CompareByEmail はメールアドレス (セカンダリーメールを含む) を NormalizeEmail で正規化した値が一致することを表します
+	CompareByEmail = "email"
+	// CompareByDisplayName は正規化した表示名が一致し、それぞれの組織で一意であることを表します
+	CompareByDisplayName = "display-name"
+)
+
+// CompareTarget は比較する組織とアイデンティティの取得先です
+type CompareTarget struct {
+	OrganizationID string
+	// Organization は組織情報です。--offline の場合は nil です
+	Organization *admina.Organization
+	Client       Client
+}
+
+// CompareOptions は compare コマンドのオプションです
+type CompareOptions struct {
+	// Where に一致するアイデンティティのみを両方の組織で比較します
+	Where *Where
+}
+
+// CompareSide は比較した一方の組織の情報です
+type CompareSide struct {
+	OrganizationID  string `json:"organizationId"`
+	Name            string `json:"name,omitempty"`
+	TotalIdentities int    `json:"totalIdentities"`
+}
+
+// Label は組織名と ID を表示用に返します
+func (s CompareSide) Label() string {
+	if s.Name == "" {
+		return s.OrganizationID
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, s.OrganizationID)
+}
+
+// CompareMatch は両方の組織に存在すると思われる人のアイデンティティの組です
+type CompareMatch struct {
+	Left      admina.Identity `json:"left"`
+	Right     admina.Identity `json:"right"`
+	MatchedBy string          `json:"matchedBy"`
+	// ManagementTypeMismatch は両方の組織で管理タイプが異なるかです
+	ManagementTypeMismatch bool `json:"managementTypeMismatch"`
+}
+
+// CompareReport は compare コマンドの結果です
+type CompareReport struct {
+	Left     CompareSide    `json:"left"`
+	Right    CompareSide    `json:"right"`
+	Overlaps []CompareMatch `json:"overlaps"`
+	// Mismatches は Overlaps のうち管理タイプが異なるものです
+	Mismatches []CompareMatch    `json:"managementTypeMismatches"`
+	OnlyLeft   []admina.Identity `json:"onlyLeft"`
+	OnlyRight  []admina.Identity `json:"onlyRight"`
+}
+
+// CompareFormatter は組織間の比較結果のフォーマット方法を定義するインターフェース
+type CompareFormatter interface {
+	Format(report *CompareReport) (string, error)
+}
+
+// PrintComparison は2つの組織のアイデンティティを取得して比較結果を出力します
+func PrintComparison(left, right *CompareTarget, options *CompareOptions, outputFormat string, ctx *FormatContext) error {
+	formatter, err := CompareFormats.New(outputFormat, ctx)
+	if err != nil {
+		return err
+	}
+
+	leftIdentities, err := fetchCompareIdentities(left, options)
+	if err != nil {
+		return err
+	}
+	rightIdentities, err := fetchCompareIdentities(right, options)
+	if err != nil {
+		return err
+	}
+
+	report := CompareIdentitySets(leftIdentities, rightIdentities)
+	report.Left = newCompareSide(left, len(leftIdentities))
+	report.Right = newCompareSide(right, len(rightIdentities))
+
+	output, err := formatter.Format(report)
+	if err != nil {
+		return fmt.Errorf("failed to format comparison: %v", err)
+	}
+
+	logger.LogInfo("Compared %d and %d identities: %d in both, %d only in %s, %d only in %s",
+		len(leftIdentities), len(rightIdentities), len(report.Overlaps),
+		len(report.OnlyLeft), left.OrganizationID, len(report.OnlyRight), right.OrganizationID)
+	logger.Print("%s", output)
+	return nil
+}
+
+func fetchCompareIdentities(target *CompareTarget, options *CompareOptions) ([]admina.Identity, error) {
+	identities, err := FetchAllIdentities(target.Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identities of organization %s: %v", target.OrganizationID, err)
+	}
+	if options != nil && options.Where != nil {
+		identities = FilterIdentities(identities, options.Where)
+	}
+	return identities, nil
+}
+
+func newCompareSide(target *CompareTarget, total int) CompareSide {
+	side := CompareSide{OrganizationID: target.OrganizationID, TotalIdentities: total}
+	if target.Organization != nil {
+		side.Name = target.Organization.Name
+	}
+	return side
+}
+
+// CompareIdentitySets は2つの組織のアイデンティティを対応付けます
+// まず正規化したメールアドレスで対応付け、残りを正規化した表示名で対応付けます
+// 表示名はどちらかの組織で同じ値のアイデンティティが複数ある場合は対応付けません
+func CompareIdentitySets(left, right []admina.Identity) *CompareReport {
+	report := &CompareReport{
+		Left:       CompareSide{TotalIdentities: len(left)},
+		Right:      CompareSide{TotalIdentities: len(right)},
+		Overlaps:   []CompareMatch{},
+		Mismatches: []CompareMatch{},
+		OnlyLeft:   []admina.Identity{},
+		OnlyRight:  []admina.Identity{},
+	}
+
+	matchedLeft := make([]int, len(left))
+	for i := range matchedLeft {
+		matchedLeft[i] = -1
+	}
+	matchedRight := make([]bool, len(right))
+	matchedBy := make([]string, len(left))
+
+	rightByEmail := make(map[string][]int)
+	for j, identity := range right {
+		for _, key := range compareEmailKeys(identity) {
+			rightByEmail[key] = append(rightByEmail[key], j)
+		}
+	}
+	for i, identity := range left {
+	emails:
+		for _, key := range compareEmailKeys(identity) {
+			for _, j := range rightByEmail[key] {
+				if !matchedRight[j] {
+					matchedLeft[i], matchedRight[j], matchedBy[i] = j, true, CompareByEmail
+					break emails
+				}
+			}
+		}
+	}
+
+	// 同姓同名の別人を対応付けないよう、残りのうち一意な表示名のみを使う
+	leftByName := uniqueDisplayNames(left, func(i int) bool { return matchedLeft[i] >= 0 })
+	rightByName := uniqueDisplayNames(right, func(j int) bool { return matchedRight[j] })
+	for name, i := range leftByName {
+		if j, ok := rightByName[name]; ok {
+			matchedLeft[i], matchedRight[j], matchedBy[i] = j, true, CompareByDisplayName
+		}
+	}
+
+	for i, identity := range left {
+		if matchedLeft[i] < 0 {
+			report.OnlyLeft = append(report.OnlyLeft, identity)
+			continue
+		}
+		match := CompareMatch{Left: identity, Right: right[matchedLeft[i]], MatchedBy: matchedBy[i]}
+		match.ManagementTypeMismatch = match.Left.ManagementType != match.Right.ManagementType
+		report.Overlaps = append(report.Overlaps, match)
+		if match.ManagementTypeMismatch {
+			report.Mismatches = append(report.Mismatches, match)
+		}
+	}
+	for j, identity := range right {
+		if !matchedRight[j] {
+			report.OnlyRight = append(report.OnlyRight, identity)
+		}
+	}
+	return report
+}
+
+// compareEmailKeys はプライマリメールとセカンダリーメールを正規化した値を返します
+func compareEmailKeys(identity admina.Identity) []string {
+	var keys []string
+	for _, email := range append([]string{identity.Email}, identity.SecondaryEmails...) {
+		if key := NormalizeEmail(email); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// uniqueDisplayNames は対応付けていないアイデンティティのうち、正規化した表示名が一意なものの位置を返します
+func uniqueDisplayNames(identities []admina.Identity, matched func(int) bool) map[string]int {
+	positions := make(map[string]int)
+	duplicated := make(map[string]bool)
+	for i, identity := range identities {
+		if matched(i) {
+			continue
+		}
+		name := NormalizeDisplayName(identity.DisplayName)
+		if name == "" {
+			continue
+		}
+		if _, exists := positions[name]; exists {
+			duplicated[name] = true
+		}
+		positions[name] = i
+	}
+	for name := range duplicated {
+		delete(positions, name)
+	}
+	return positions
+}
+
+func maskedMatches(matches []CompareMatch) []CompareMatch {
+	masked := make([]CompareMatch, len(matches))
+	for i, match := range matches {
+		pair := maskedIdentities([]admina.Identity{match.Left, match.Right})
+		match.Left, match.Right = pair[0], pair[1]
+		masked[i] = match
+	}
+	return masked
+}
+
+// JSONCompareFormatter の実装
+type JSONCompareFormatter struct{}
+
+func (f *JSONCompareFormatter) Format(report *CompareReport) (string, error) {
+	masked := *report
+	masked.Overlaps = maskedMatches(report.Overlaps)
+	masked.Mismatches = maskedMatches(report.Mismatches)
+	masked.OnlyLeft = maskedIdentities(report.OnlyLeft)
+	masked.OnlyRight = maskedIdentities(report.OnlyRight)
+	output, err := json.MarshalIndent(masked, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal comparison: %v", err)
+	}
+	return string(output) + "\n", nil
+}
+
+// MarkdownCompareFormatter の実装
+type MarkdownCompareFormatter struct{}
+
+func (f *MarkdownCompareFormatter) Format(report *CompareReport) (string, error) {
+	var output strings.Builder
+	output.WriteString("# Organization Comparison\n\n")
+	output.WriteString("| | Organization | Identities |\n")
+	output.WriteString("|-|--------------|------------|\n")
+	output.WriteString(fmt.Sprintf("| Left | %s | %d |\n", report.Left.Label(), report.Left.TotalIdentities))
+	output.WriteString(fmt.Sprintf("| Right | %s | %d |\n\n", report.Right.Label(), report.Right.TotalIdentities))
+	output.WriteString(fmt.Sprintf("In both: %d, management type mismatches: %d, only in left: %d, only in right: %d\n\n",
+		len(report.Overlaps), len(report.Mismatches), len(report.OnlyLeft), len(report.OnlyRight)))
+
+	writeMatches := func(title string, matches []CompareMatch) {
+		output.WriteString(fmt.Sprintf("## %s (%d)\n\n", title, len(matches)))
+		if len(matches) == 0 {
+			output.WriteString("None.\n\n")
+			return
+		}
+		output.WriteString("| Left Email | Left Display Name | Left Type | Right Email | Right Display Name | Right Type | Matched By |\n")
+		output.WriteString("|------------|-------------------|-----------|-------------|--------------------|------------|------------|\n")
+		for _, match := range matches {
+			output.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s |\n",
+				MaskEmail(match.Left.Email), match.Left.DisplayName, match.Left.ManagementType,
+				MaskEmail(match.Right.Email), match.Right.DisplayName, match.Right.ManagementType, match.MatchedBy))
+		}
+		output.WriteString("\n")
+	}
+	writeIdentities := func(title string, identities []admina.Identity) {
+		output.WriteString(fmt.Sprintf("## %s (%d)\n\n", title, len(identities)))
+		if len(identities) == 0 {
+			output.WriteString("None.\n\n")
+			return
+		}
+		output.WriteString("| ID | Email | Display Name | Management Type | Employee Status |\n")
+		output.WriteString("|----|-------|--------------|-----------------|-----------------|\n")
+		for _, identity := range identities {
+			output.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				identity.ID, MaskEmail(identity.Email), identity.DisplayName, identity.ManagementType, identity.EmployeeStatus))
+		}
+		output.WriteString("\n")
+	}
+
+	writeMatches("In Both", report.Overlaps)
+	writeMatches("Management Type Mismatches", report.Mismatches)
+	writeIdentities("Only in "+report.Left.Label(), report.OnlyLeft)
+	writeIdentities("Only in "+report.Right.Label(), report.OnlyRight)
+	return output.String(), nil
+}
+
+// PrettyCompareFormatter の実装
+type PrettyCompareFormatter struct{}
+
+func (f *PrettyCompareFormatter) Format(report *CompareReport) (string, error) {
+	var output strings.Builder
+	output.WriteString("=== Organization Comparison ===\n\n")
+	output.WriteString(fmt.Sprintf("Left:  %s, %d identities\n", report.Left.Label(), report.Left.TotalIdentities))
+	output.WriteString(fmt.Sprintf("Right: %s, %d identities\n", report.Right.Label(), report.Right.TotalIdentities))
+	output.WriteString(fmt.Sprintf("In both: %d (management type mismatches: %d)\n", len(report.Overlaps), len(report.Mismatches)))
+	output.WriteString(fmt.Sprintf("Only in left: %d\n", len(report.OnlyLeft)))
+	output.WriteString(fmt.Sprintf("Only in right: %d\n", len(report.OnlyRight)))
+
+	if len(report.Overlaps) > 0 {
+		output.WriteString("\nIn both:\n")
+		for _, match := range report.Overlaps {
+			mismatch := ""
+			if match.ManagementTypeMismatch {
+				mismatch = " [management type mismatch]"
+			}
+			output.WriteString(fmt.Sprintf("  - %s (%s, %s) <-> %s (%s, %s) by %s%s\n",
+				MaskEmail(match.Left.Email), match.Left.DisplayName, match.Left.ManagementType,
+				MaskEmail(match.Right.Email), match.Right.DisplayName, match.Right.ManagementType, match.MatchedBy, mismatch))
+		}
+	}
+	for _, section := range []struct {
+		title      string
+		identities []admina.Identity
+	}{{"Only in left", report.OnlyLeft}, {"Only in right", report.OnlyRight}} {
+		if len(section.identities) == 0 {
+			continue
+		}
+		output.WriteString(fmt.Sprintf("\n%s:\n", section.title))
+		for _, identity := range section.identities {
+			output.WriteString(fmt.Sprintf("  - %s %s (%s, %s, %s)\n",
+				identity.ID, MaskEmail(identity.Email), identity.DisplayName, identity.ManagementType, identity.EmployeeStatus))
+		}
+	}
+	return output.String(), nil
+}
+
+// CSVCompareFormatter の実装
+// 対応付けた組、または一方にのみ存在するアイデンティティごとに1行を出力します
+// Presence は both, left-only, right-only のいずれかです
+type CSVCompareFormatter struct{}
+
+func (f *CSVCompareFormatter) Format(report *CompareReport) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	identityColumns := func(identity *admina.Identity) []string {
+		if identity == nil {
+			return []string{"", "", "", "", ""}
+		}
+		return []string{identity.ID, peopleIDValue(*identity), MaskEmail(identity.Email), identity.DisplayName, identity.ManagementType}
+	}
+	row := func(presence, matchedBy string, mismatch bool, left, right *admina.Identity) []string {
+		columns := []string{presence, matchedBy, strconv.FormatBool(mismatch)}
+		columns = append(columns, identityColumns(left)...)
+		return append(columns, identityColumns(right)...)
+	}
+
+	rows := [][]string{{"Presence", "MatchedBy", "ManagementTypeMismatch",
+		"LeftIdentityID", "LeftPeopleID", "LeftEmail", "LeftDisplayName", "LeftManagementType",
+		"RightIdentityID", "RightPeopleID", "RightEmail", "RightDisplayName", "RightManagementType"}}
+	for i := range report.Overlaps {
+		match := &report.Overlaps[i]
+		rows = append(rows, row("both", match.MatchedBy, match.ManagementTypeMismatch, &match.Left, &match.Right))
+	}
+	for i := range report.OnlyLeft {
+		rows = append(rows, row("left-only", "", false, &report.OnlyLeft[i], nil))
+	}
+	for i := range report.OnlyRight {
+		rows = append(rows, row("right-only", "", false, nil, &report.OnlyRight[i]))
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return "", fmt.Errorf("failed to write csv: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// HTMLCompareFormatter の実装
+// 両方の組織の件数と、対応付けた組・一方にのみ存在するアイデンティティの表を単一の HTML ファイルにします
+type HTMLCompareFormatter struct{}
+
+func (f *HTMLCompareFormatter) Format(report *CompareReport) (string, error) {
+	data := struct {
+		htmlPage
+		*CompareReport
+	}{
+		htmlPage:      newHTMLPage("Organization Comparison", nil),
+		CompareReport: report,
+	}
+	return executeHTML("compare", data)
+}
@@ -0,0 +1,100 @@
+package identity_test
+
+import (
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	compareLeftIdentities = []admina.Identity{
+		{ID: "L1", DisplayName: "Hanako Suzuki", ManagementType: "managed", Email: "hanako.suzuki@parent.example.com"},
+		{ID: "L2", DisplayName: "Taro Yamada", ManagementType: "managed", Email: "taro@parent.example.com"},
+		{ID: "L3", DisplayName: "Jiro Sato", ManagementType: "managed", Email: "jiro@parent.example.com"},
+		{ID: "L4", DisplayName: "Ichiro Ito", ManagementType: "managed", Email: "ichiro@parent.example.com"},
+		{ID: "L5", DisplayName: "Saburo Kato", ManagementType: "managed", Email: "saburo@parent.example.com"},
+	}
+	compareRightIdentities = []admina.Identity{
+		{ID: "R1", DisplayName: "H. Suzuki", ManagementType: "managed", Email: "HanakoSuzuki@parent.example.com"},
+		{ID: "R2", DisplayName: "山田 太郎", ManagementType: "external", Email: "t.yamada@acquired.example.com", SecondaryEmails: []string{"taro@parent.example.com"}},
+		{ID: "R3", DisplayName: "Sato Jiro", ManagementType: "external", Email: "jsato@acquired.example.com"},
+		{ID: "R4", DisplayName: "Ichiro Ito", ManagementType: "managed", Email: "ito1@acquired.example.com"},
+		{ID: "R5", DisplayName: "Ichiro Ito", ManagementType: "managed", Email: "ito2@acquired.example.com"},
+		{ID: "R6", DisplayName: "Shiro Kimura", ManagementType: "managed", Email: "shiro@acquired.example.com"},
+	}
+)
+
+func compareMatchIDs(matches []identity.CompareMatch) [][3]string {
+	ids := make([][3]string, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, [3]string{match.Left.ID, match.Right.ID, match.MatchedBy})
+	}
+	return ids
+}
+
+func TestCompareIdentitySets(t *testing.T) {
+	report := identity.CompareIdentitySets(compareLeftIdentities, compareRightIdentities)
+
+	assert.Equal(t, [][3]string{
+		{"L1", "R1", identity.CompareByEmail},
+		{"L2", "R2", identity.CompareByEmail},       // セカンダリーメール
+		{"L3", "R3", identity.CompareByDisplayName}, // 姓名の順序が異なる
+	}, compareMatchIDs(report.Overlaps))
+	assert.Equal(t, [][3]string{
+		{"L2", "R2", identity.CompareByEmail},
+		{"L3", "R3", identity.CompareByDisplayName},
+	}, compareMatchIDs(report.Mismatches))
+
+	// 同じ表示名が複数ある場合は対応付けない
+	require.Len(t, report.OnlyLeft, 2)
+	assert.Equal(t, "L4", report.OnlyLeft[0].ID)
+	assert.Equal(t, "L5", report.OnlyLeft[1].ID)
+	require.Len(t, report.OnlyRight, 3)
+	assert.Equal(t, []string{"R4", "R5", "R6"}, []string{report.OnlyRight[0].ID, report.OnlyRight[1].ID, report.OnlyRight[2].ID})
+}
+
+func TestCompareFormats(t *testing.T) {
+	identity.SetNoMask(false)
+	report := identity.CompareIdentitySets(compareLeftIdentities, compareRightIdentities)
+	report.Left.OrganizationID, report.Left.Name = "100", "Parent Inc."
+	report.Right.OrganizationID = "200"
+
+	for _, format := range identity.CompareFormats.Formats() {
+		t.Run(format.Name, func(t *testing.T) {
+			formatter, err := identity.CompareFormats.New(format.Name, formatterTestContext(""))
+			require.NoError(t, err)
+
+			output, err := formatter.Format(report)
+			require.NoError(t, err)
+			assert.Contains(t, output, "Shiro Kimura")
+			assert.Contains(t, output, identity.CompareByDisplayName)
+			assert.NotContains(t, output, "taro@parent.example.com")
+			switch format.Name {
+			case "json":
+				assert.Contains(t, output, `"managementTypeMismatches"`)
+			case "csv":
+				assert.Contains(t, output, "right-only")
+			default:
+				assert.Contains(t, output, "Parent Inc. (100)")
+			}
+		})
+	}
+}
+
+func TestPrintComparison(t *testing.T) {
+	logger.Init()
+	left := &identity.CompareTarget{OrganizationID: "100", Client: &mock.Client{Identities: compareLeftIdentities}}
+	right := &identity.CompareTarget{OrganizationID: "200", Client: &mock.Client{Identities: compareRightIdentities}}
+
+	where, err := identity.ParseWhere(`managementType == "managed"`)
+	require.NoError(t, err)
+	assert.NoError(t, identity.PrintComparison(left, right, &identity.CompareOptions{Where: where}, "json", &identity.FormatContext{}))
+
+	err = identity.PrintComparison(left, right, nil, "xlsx", &identity.FormatContext{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"golang.org/x/term"
+)
+
+// 確認プロンプトの回答
+const (
+	confirmYes  = "yes"
+	confirmNo   = "no"
+	confirmQuit = "quit"
+)
+
+// mergePrompt は samemerge の候補ごとの確認プロンプトです
+// 入力は実行の間で1つの Reader を共有し、パイプからの先読みが失われないようにします
+type mergePrompt struct {
+	reader *bufio.Reader
+	output io.Writer
+	// approveAll は a の回答で以降の候補をすべて承認したかです
+	approveAll bool
+	// quit は q の回答で以降の候補を確認せずにスキップするかです
+	quit bool
+	// closed は入力が終了したかです。以降の候補は no として扱います
+	closed bool
+}
+
+// openPrompt は確認プロンプトの入力を開きます
+// input が nil の場合は標準入力を使い、端末でない場合は確認できないため usage を含めたエラーを返します
+func openPrompt(input io.Reader, usage string) (*bufio.Reader, error) {
+	if input == nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("stdin is not a terminal: %s", usage)
+		}
+		input = os.Stdin
+	}
+	return bufio.NewReader(input), nil
+}
+
+// readAnswer は質問を表示して回答を1行読み込みます。入力が終了した場合は false を返します
+func readAnswer(reader *bufio.Reader, output io.Writer, question string) (string, bool) {
+	fmt.Fprint(output, question)
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(output)
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+// confirmOnce は create・update・delete の一度きりの確認を行い、回答が accept のいずれかと一致するかを返します
+// 入力が終了した場合は確認されなかったものとして扱います
+func confirmOnce(reader *bufio.Reader, question string, accept ...string) bool {
+	answer, ok := readAnswer(reader, os.Stdout, question)
+	if !ok {
+		logger.LogWarning("stdin was closed; treating as not confirmed")
+		return false
+	}
+	return contains(accept, strings.ToLower(answer))
+}
+
+// newMergePrompt は確認プロンプトを作成します
+// input が nil の場合は標準入力を使い、端末でない場合は確認できないためエラーを返します
+func newMergePrompt(input io.Reader) (*mergePrompt, error) {
+	reader, err := openPrompt(input, "use --y to merge without confirmation, or --dry-run to preview")
+	if err != nil {
+		return nil, err
+	}
+	return &mergePrompt{reader: reader, output: os.Stdout}, nil
+}
+
+// ask は候補をマージするかを確認し、confirmYes, confirmNo, confirmQuit のいずれかを返します
+func (p *mergePrompt) ask(candidate *MergeCandidate) string {
+	switch {
+	case p.quit:
+		return confirmQuit
+	case p.approveAll:
+		return confirmYes
+	case p.closed:
+		return confirmNo
+	}
+
+	for {
+		question := fmt.Sprintf("Merge %s -> %s? [y]es/[N]o/[a]ll/[q]uit/[d]etails: ", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
+		answer, ok := readAnswer(p.reader, p.output, question)
+		if !ok {
+			logger.LogWarning("stdin was closed; treating this and remaining candidates as no")
+			p.closed = true
+			return confirmNo
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return confirmYes
+		case "", "n", "no":
+			return confirmNo
+		case "a", "all":
+			p.approveAll = true
+			return confirmYes
+		case "q", "quit":
+			p.quit = true
+			return confirmQuit
+		case "d", "details":
+			p.printDetails(candidate)
+		default:
+			fmt.Fprintln(p.output, "Please answer y, n, a, q or d.")
+		}
+	}
+}
+
+// printDetails は親子のフィールドと表示名の類似度を並べて表示します
+func (p *mergePrompt) printDetails(candidate *MergeCandidate) {
+	column := 0
+	for _, row := range candidateFields(candidate) {
+		column = max(column, displayWidth(row[1]))
+	}
+	for _, row := range candidateFields(candidate) {
+		fmt.Fprintf(p.output, "  %-14s %s  %s\n", row[0], padWidth(row[1], column), row[2])
+	}
+	fmt.Fprintf(p.output, "  %-14s %s\n", "Similarity", formatScore(candidate.NameSimilarity))
+}
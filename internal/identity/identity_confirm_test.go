@@ -0,0 +1,101 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var confirmTestIdentities = []admina.Identity{
+	{ID: "100", PeopleID: 101, ManagementType: "managed", Email: "a@parent.domain.com"},
+	{ID: "110", PeopleID: 111, ManagementType: "managed", Email: "b@parent.domain.com"},
+	{ID: "120", PeopleID: 121, ManagementType: "managed", Email: "c@parent.domain.com"},
+	{ID: "200", PeopleID: 201, ManagementType: "external", Email: "a@child.domain.com"},
+	{ID: "210", PeopleID: 211, ManagementType: "external", Email: "b@child.domain.com"},
+	{ID: "220", PeopleID: 221, ManagementType: "external", Email: "c@child.domain.com"},
+}
+
+func TestMergeIdentitiesConfirm(t *testing.T) {
+	logger.Init()
+
+	run := func(t *testing.T, input string) (*mock.Client, [][]string, error) {
+		t.Helper()
+		client := &mock.Client{Identities: confirmTestIdentities}
+		config := &identity.MergeConfig{
+			ParentDomain:  "parent.domain.com",
+			ChildDomains:  []string{"child.domain.com"},
+			OutputFormat:  "json",
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+			CSV:           identity.CSVOptions{Columns: []string{"ChildIdentityID", "Status", "Reason"}},
+			Stdin:         strings.NewReader(input),
+		}
+		err := identity.MergeIdentities(client, config)
+		content, readErr := os.ReadFile(filepath.Join(config.OutputDir, "identity_mappings.csv"))
+		require.NoError(t, readErr)
+		return client, readCSV(t, content)[1:], err
+	}
+	mergedFrom := func(client *mock.Client) []int {
+		var ids []int
+		for _, result := range client.MergeResults {
+			ids = append(ids, result.FromPeopleID)
+		}
+		return ids
+	}
+
+	t.Run("y と n で候補ごとに確認する", func(t *testing.T) {
+		client, rows, err := run(t, "y\nN\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, []int{201}, mergedFrom(client))
+		assert.Equal(t, [][]string{{"200", "Success", ""}, {"210", "Skip", "not confirmed"}, {"220", "Skip", "not confirmed"}}, rows)
+	})
+
+	t.Run("a で残りの候補をすべて承認する", func(t *testing.T) {
+		client, _, err := run(t, "n\nall\n")
+		require.NoError(t, err)
+		assert.Equal(t, []int{211, 221}, mergedFrom(client))
+	})
+
+	t.Run("q で中断して結果を出力する", func(t *testing.T) {
+		client, rows, err := run(t, "y\nq\n")
+		require.NoError(t, err)
+		assert.Equal(t, []int{201}, mergedFrom(client))
+		assert.Equal(t, []string{"210", "Skip", "stopped by user"}, rows[1])
+		assert.Equal(t, []string{"220", "Skip", "stopped by user"}, rows[2])
+	})
+
+	t.Run("d で詳細を表示してから再度確認する", func(t *testing.T) {
+		client, _, err := run(t, "d\nmaybe\ny\nn\nn\n")
+		require.NoError(t, err)
+		assert.Equal(t, []int{201}, mergedFrom(client))
+	})
+
+	t.Run("入力が終了した場合は以降を no として扱う", func(t *testing.T) {
+		client, rows, err := run(t, "y")
+		require.NoError(t, err)
+		assert.Equal(t, []int{201}, mergedFrom(client))
+		assert.Equal(t, []string{"220", "Skip", "not confirmed"}, rows[2])
+	})
+
+	t.Run("端末でない標準入力では --y なしで実行しない", func(t *testing.T) {
+		client := &mock.Client{Identities: confirmTestIdentities}
+		withStdin(t, "y\ny\ny\n")
+		err := identity.MergeIdentities(client, &identity.MergeConfig{
+			ParentDomain:  "parent.domain.com",
+			ChildDomains:  []string{"child.domain.com"},
+			OutputFormat:  "json",
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+		})
+		assert.ErrorContains(t, err, "stdin is not a terminal")
+		assert.Empty(t, client.MergeResults)
+	})
+}
@@ -0,0 +1,338 @@
+package identity
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// createResultsFileName は identity create の結果を出力するファイル名です
+const createResultsFileName = "identity_create_results.csv"
+
+// CreateEmployeeTypes は identity create で指定できる従業員タイプです
+var CreateEmployeeTypes = []string{
+	"full_time_employee", "part_time_employee", "contract_employee", "temporary_employee",
+	"dispatched_worker", "secondee", "board_member", "collaborator", "other",
+}
+
+// CreateEmployeeStatuses は identity create で指定できる従業員ステータスです
+var CreateEmployeeStatuses = []string{"active", "on_leave", "retired", "untracked"}
+
+// CreateConfig は identity create の設定です
+type CreateConfig struct {
+	// InputFile は作成するアイデンティティを記載したCSVファイルです
+	InputFile   string
+	DryRun      bool
+	AutoApprove bool
+	// Interval は作成APIを連続して呼び出す際の最小間隔です
+	Interval      time.Duration
+	OutputDir     string
+	OutputDirMode string
+	// CSV は結果ファイルの文字コード・区切り文字です。列の指定は使用しません
+	CSV          CSVOptions
+	Organization *admina.Organization
+	// Stdin は確認プロンプトの入力です。nil の場合は標準入力を使い、端末でない場合は --y なしでは実行できません
+	Stdin   io.Reader
+	Version string
+	Args    []string
+}
+
+// CreateRow は作成するアイデンティティのCSVの1行です
+type CreateRow struct {
+	Line    int
+	Request admina.CreateIdentityRequest
+}
+
+// CreateResult は1行分の作成結果です
+// Status は Success, Skip (dry-run), Invalid (入力の誤り), Error (APIのエラー) のいずれかです
+type CreateResult struct {
+	Row      CreateRow
+	Status   string
+	Reason   string
+	Identity *admina.Identity
+}
+
+// createColumns はCSVのヘッダー名と CreateIdentityRequest の項目の対応です（大文字小文字は区別しません）
+var createColumns = map[string]func(req *admina.CreateIdentityRequest, value string){
+	"primaryemail":   func(req *admina.CreateIdentityRequest, value string) { req.PrimaryEmail = value },
+	"firstname":      func(req *admina.CreateIdentityRequest, value string) { req.FirstName = value },
+	"lastname":       func(req *admina.CreateIdentityRequest, value string) { req.LastName = value },
+	"displayname":    func(req *admina.CreateIdentityRequest, value string) { req.DisplayName = value },
+	"employeetype":   func(req *admina.CreateIdentityRequest, value string) { req.EmployeeType = value },
+	"employeestatus": func(req *admina.CreateIdentityRequest, value string) { req.EmployeeStatus = value },
+}
+
+// ReadCreateRows は作成するアイデンティティのCSVを読み込みます
+// ヘッダー行に primaryEmail の列が必要です。# で始まる行と未対応の列は無視します
+func ReadCreateRows(path string) ([]CreateRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identities: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("identities file is empty: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identities header: %v", err)
+	}
+
+	setters := make([]func(*admina.CreateIdentityRequest, string), len(headers))
+	hasEmailColumn := false
+	for i, header := range headers {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+		setters[i] = createColumns[name]
+		hasEmailColumn = hasEmailColumn || name == "primaryemail"
+	}
+	if !hasEmailColumn {
+		return nil, fmt.Errorf("identities header must contain %q column: %s", "primaryEmail", strings.Join(headers, ","))
+	}
+
+	var rows []CreateRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identities: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := CreateRow{Line: line}
+		empty := true
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if i < len(setters) && setters[i] != nil {
+				setters[i](&row.Request, value)
+			}
+			empty = empty && value == ""
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// ValidateCreateRows は各行を検証し、作成できない行の結果を返します
+// メールアドレスの形式、従業員タイプ・ステータスの値、既存のアイデンティティとファイル内での重複を確認します
+func ValidateCreateRows(rows []CreateRow, existing []admina.Identity) map[int]string {
+	invalid := make(map[int]string)
+	seen := make(map[string]int)
+	for _, row := range rows {
+		req := row.Request
+		email := strings.ToLower(req.PrimaryEmail)
+		var reasons []string
+
+		if address, err := mail.ParseAddress(req.PrimaryEmail); err != nil || address.Address != req.PrimaryEmail || ExtractDomain(email) == "" {
+			reasons = append(reasons, fmt.Sprintf("invalid email: %q", MaskEmail(req.PrimaryEmail)))
+		}
+		if req.EmployeeType != "" && !contains(CreateEmployeeTypes, req.EmployeeType) {
+			reasons = append(reasons, fmt.Sprintf("unknown employeeType: %s", req.EmployeeType))
+		}
+		if req.EmployeeStatus != "" && !contains(CreateEmployeeStatuses, req.EmployeeStatus) {
+			reasons = append(reasons, fmt.Sprintf("unknown employeeStatus: %s", req.EmployeeStatus))
+		}
+		if matched := FindIdentities(existing, req.PrimaryEmail); len(matched) > 0 && email != "" {
+			reasons = append(reasons, fmt.Sprintf("already exists as identity %s", matched[0].ID))
+		}
+		if line, ok := seen[email]; ok && email != "" {
+			reasons = append(reasons, fmt.Sprintf("duplicate of line %d", line))
+		} else {
+			seen[email] = row.Line
+		}
+
+		if len(reasons) > 0 {
+			invalid[row.Line] = strings.Join(reasons, "; ")
+		}
+	}
+	return invalid
+}
+
+// CreateIdentities は CSV に記載されたアイデンティティを作成し、行ごとの結果を出力ディレクトリに書き出します
+func CreateIdentities(client Client, config *CreateConfig) error {
+	logger.LogInfo("Starting identity create process")
+
+	if err := config.CSV.Validate(); err != nil {
+		return err
+	}
+	run, err := NewOutputRun(config.OutputDir, config.OutputDirMode, time.Now())
+	if err != nil {
+		return err
+	}
+	creator, canCreate := client.(IdentityCreator)
+	if !config.DryRun && !canCreate {
+		return fmt.Errorf("client does not support creating identities")
+	}
+	var prompt *bufio.Reader
+	if !config.DryRun && !config.AutoApprove {
+		// 応答できない入力で待ち続けないよう、読み込みの前に確認する
+		if prompt, err = openPrompt(config.Stdin, "use --y to create without confirmation, or --dry-run to preview"); err != nil {
+			return err
+		}
+	}
+
+	rows, err := ReadCreateRows(config.InputFile)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("Read %d identities from %s", len(rows), config.InputFile)
+
+	existing, err := FetchAllIdentities(client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch identities: %v", err)
+	}
+	invalid := ValidateCreateRows(rows, existing)
+
+	results := make([]CreateResult, 0, len(rows))
+	for _, row := range rows {
+		result := CreateResult{Row: row, Status: "Skip"}
+		if reason, ok := invalid[row.Line]; ok {
+			result.Status = "Invalid"
+			result.Reason = reason
+			logger.LogInfo("Line %d is invalid: %s", row.Line, reason)
+		} else if config.DryRun {
+			result.Reason = "dry-run"
+			logger.LogInfo("Dry-run: Would create %s", MaskEmail(row.Request.PrimaryEmail))
+		}
+		results = append(results, result)
+	}
+
+	valid := len(rows) - len(invalid)
+	logger.PrintErr("=== Identity Create Summary ===\n")
+	logger.PrintErr("Rows in file: %d\n", len(rows))
+	logger.PrintErr("Valid rows: %d\n", valid)
+	logger.PrintErr("Invalid rows: %d\n", len(invalid))
+
+	declined := false
+	if !config.DryRun && valid > 0 && (config.AutoApprove || confirmCreate(prompt, valid)) {
+		createValidRows(creator, config, results)
+	} else if !config.DryRun {
+		declined = valid > 0
+		for i := range results {
+			if results[i].Status == "Skip" {
+				results[i].Reason = "not confirmed"
+			}
+		}
+	}
+
+	createdCount, skippedCount, errorCount := countCreateResults(results)
+	if err := outputCreateResults(results, config, run, createdCount, skippedCount, errorCount); err != nil {
+		return err
+	}
+
+	if declined {
+		return fmt.Errorf("create was not confirmed: %d valid rows were not created", valid)
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("completed with %d errors (%d invalid rows), %d created, %d skipped", errorCount, len(invalid), createdCount, skippedCount)
+	}
+	return nil
+}
+
+func createValidRows(creator IdentityCreator, config *CreateConfig, results []CreateResult) {
+	ctx := context.Background()
+	throttle := newRequestThrottle(config.Interval)
+	for i := range results {
+		result := &results[i]
+		if result.Status != "Skip" {
+			continue
+		}
+
+		throttle.Wait()
+		req := result.Row.Request
+		created, err := creator.CreateIdentity(ctx, &req)
+		if err != nil {
+			logger.LogInfo("Failed to create %s: %v", MaskEmail(req.PrimaryEmail), err)
+			result.Status = "Error"
+			result.Reason = fmt.Sprintf("Failed to create: %v", err)
+			continue
+		}
+
+		logger.LogInfo("Successfully created %s (%s)", MaskEmail(req.PrimaryEmail), created.ID)
+		result.Status = "Success"
+		result.Identity = created
+	}
+}
+
+func confirmCreate(prompt *bufio.Reader, count int) bool {
+	return confirmOnce(prompt, fmt.Sprintf("Create %d identities? (y/n): ", count), "y", "yes")
+}
+
+func countCreateResults(results []CreateResult) (createdCount, skippedCount, errorCount int) {
+	for _, result := range results {
+		switch result.Status {
+		case "Success":
+			createdCount++
+		case "Skip":
+			skippedCount++
+		case "Error", "Invalid":
+			errorCount++
+		}
+	}
+	return
+}
+
+// createResultHeaders は identity_create_results.csv のヘッダーです
+var createResultHeaders = []string{"Line", "PrimaryEmail", "DisplayName", "EmployeeType", "EmployeeStatus", "Status", "Reason", "IdentityID", "PeopleID"}
+
+func createResultRows(results []CreateResult) [][]string {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		req := result.Row.Request
+		identityID, peopleID := "", ""
+		if result.Identity != nil {
+			identityID = result.Identity.ID
+			peopleID = peopleIDValue(*result.Identity)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(result.Row.Line),
+			MaskEmail(req.PrimaryEmail),
+			req.DisplayName,
+			req.EmployeeType,
+			req.EmployeeStatus,
+			result.Status,
+			result.Reason,
+			identityID,
+			peopleID,
+		})
+	}
+	return rows
+}
+
+func outputCreateResults(results []CreateResult, config *CreateConfig, run *OutputRun, createdCount, skippedCount, errorCount int) error {
+	if err := run.Prepare(); err != nil {
+		return err
+	}
+	csvWriter, err := NewCSVWriter(run.Dir, run.Append(), &config.CSV)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV writer: %v", err)
+	}
+	if err := csvWriter.WriteCSV(createResultsFileName, createResultHeaders, createResultRows(results)); err != nil {
+		return fmt.Errorf("failed to write create results CSV: %v", err)
+	}
+	logger.LogInfo("Create results written to %s", run.Dir)
+
+	manifest := newManifest("create", config.Version, config.Args, config.Organization, run, config.DryRun)
+	manifest.InputFile = config.InputFile
+	manifest.Created = createdCount
+	manifest.Skipped = skippedCount
+	manifest.Errors = errorCount
+	return WriteManifest(run.Dir, manifest, []string{createResultsFileName})
+}
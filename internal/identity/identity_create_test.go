@@ -0,0 +1,161 @@
+package identity_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const createTestCSV = `primaryEmail,firstName,lastName,displayName,employeeType,employeeStatus,memo
+# 正常
+hanako@parent.domain.com,Hanako,Suzuki,Hanako Suzuki,full_time_employee,active,new hire
+jiro@child.domain.com,Jiro,Tanaka,Jiro Tanaka,collaborator,,
+# 不正な行
+not-an-email,Foo,Bar,Foo Bar,full_time_employee,active,
+taro@parent.domain.com,Taro,Yamada,Taro Yamada,ninja,sleeping,
+user1@parent.domain.com,User,One,User One,,,already exists
+HANAKO@parent.domain.com,Hanako,Suzuki,Hanako Suzuki,,,duplicate
+`
+
+func TestReadCreateRows(t *testing.T) {
+	rows, err := identity.ReadCreateRows(writeCSVFile(t, createTestCSV))
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+	assert.Equal(t, identity.CreateRow{Line: 3, Request: admina.CreateIdentityRequest{
+		PrimaryEmail:   "hanako@parent.domain.com",
+		FirstName:      "Hanako",
+		LastName:       "Suzuki",
+		DisplayName:    "Hanako Suzuki",
+		EmployeeType:   "full_time_employee",
+		EmployeeStatus: "active",
+	}}, rows[0])
+
+	_, err = identity.ReadCreateRows(writeCSVFile(t, "email,name\na@b.com,a\n"))
+	assert.ErrorContains(t, err, `identities header must contain "primaryEmail" column`)
+}
+
+func TestValidateCreateRows(t *testing.T) {
+	rows, err := identity.ReadCreateRows(writeCSVFile(t, createTestCSV))
+	require.NoError(t, err)
+
+	identity.SetNoMask(false)
+	invalid := identity.ValidateCreateRows(rows, testIdentities)
+	assert.Equal(t, map[int]string{
+		6: `invalid email: "not-an-email"`,
+		7: "unknown employeeType: ninja; unknown employeeStatus: sleeping",
+		8: "already exists as identity 100",
+		9: "duplicate of line 3",
+	}, invalid)
+}
+
+func TestCreateIdentities(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	inputFile := writeCSVFile(t, createTestCSV)
+	readResults := func(t *testing.T, outputDir string) [][]string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_create_results.csv"))
+		require.NoError(t, err)
+		return readCSV(t, content)
+	}
+
+	t.Run("dry-run では作成しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		outputDir := t.TempDir()
+		err := identity.CreateIdentities(client, &identity.CreateConfig{
+			InputFile:     inputFile,
+			DryRun:        true,
+			OutputDir:     outputDir,
+			OutputDirMode: "overwrite",
+		})
+		assert.ErrorContains(t, err, "completed with 4 errors (4 invalid rows), 0 created, 2 skipped")
+		assert.Empty(t, client.CreateRequests)
+
+		results := readResults(t, outputDir)
+		assert.Equal(t, []string{"Line", "PrimaryEmail", "DisplayName", "EmployeeType", "EmployeeStatus", "Status", "Reason", "IdentityID", "PeopleID"}, results[0])
+		assert.Equal(t, []string{"3", "hanako@parent.domain.com", "Hanako Suzuki", "full_time_employee", "active", "Skip", "dry-run", "", ""}, results[1])
+		assert.Equal(t, "Invalid", results[3][5])
+	})
+
+	t.Run("有効な行を作成し、新しい ID を出力する", func(t *testing.T) {
+		client := &mock.Client{
+			Identities:   testIdentities,
+			CreateErrors: map[string]error{"jiro@child.domain.com": fmt.Errorf("409 conflict")},
+		}
+		outputDir := t.TempDir()
+		err := identity.CreateIdentities(client, &identity.CreateConfig{
+			InputFile:     inputFile,
+			AutoApprove:   true,
+			OutputDir:     outputDir,
+			OutputDirMode: "overwrite",
+			Version:       "1.2.3",
+		})
+		assert.ErrorContains(t, err, "completed with 5 errors (4 invalid rows), 1 created, 0 skipped")
+		require.Len(t, client.CreateRequests, 1)
+		assert.Equal(t, "hanako@parent.domain.com", client.CreateRequests[0].PrimaryEmail)
+
+		results := readResults(t, outputDir)
+		assert.Equal(t, []string{"3", "hanako@parent.domain.com", "Hanako Suzuki", "full_time_employee", "active", "Success", "", "new-1", "9001"}, results[1])
+		assert.Equal(t, []string{"4", "jiro@child.domain.com", "Jiro Tanaka", "collaborator", "", "Error", "Failed to create: 409 conflict", "", ""}, results[2])
+
+		manifest, err := identity.ReadManifest(outputDir)
+		require.NoError(t, err)
+		assert.Equal(t, "create", manifest.Command)
+		assert.Equal(t, inputFile, manifest.InputFile)
+		assert.Equal(t, 1, manifest.Created)
+		assert.Equal(t, 5, manifest.Errors)
+	})
+
+	t.Run("確認の回答で作成するかを決める", func(t *testing.T) {
+		for _, tt := range []struct {
+			name    string
+			input   string
+			created int
+			status  string
+			err     string
+		}{
+			{name: "yes", input: "yes\n", created: 2, status: "Success", err: "4 invalid rows"},
+			{name: "no", input: "n\n", status: "Skip", err: "create was not confirmed: 2 valid rows were not created"},
+			{name: "入力の終了", input: "", status: "Skip", err: "create was not confirmed: 2 valid rows were not created"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				client := &mock.Client{Identities: testIdentities}
+				outputDir := t.TempDir()
+				err := identity.CreateIdentities(client, &identity.CreateConfig{
+					InputFile:     inputFile,
+					Stdin:         strings.NewReader(tt.input),
+					OutputDir:     outputDir,
+					OutputDirMode: "overwrite",
+				})
+				assert.ErrorContains(t, err, tt.err)
+				assert.Len(t, client.CreateRequests, tt.created)
+				assert.Equal(t, tt.status, readResults(t, outputDir)[1][5])
+			})
+		}
+	})
+
+	t.Run("端末でない標準入力では --y なしで実行しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		withStdin(t, "y\n")
+		err := identity.CreateIdentities(client, &identity.CreateConfig{InputFile: inputFile, OutputDir: t.TempDir()})
+		assert.ErrorContains(t, err, "stdin is not a terminal: use --y to create without confirmation")
+		assert.Empty(t, client.CreateRequests)
+	})
+
+	t.Run("作成に対応していないクライアント", func(t *testing.T) {
+		offline := identity.NewCachedClient(nil, identity.NewSnapshotStore(t.TempDir()), "123", 0, true)
+		err := identity.CreateIdentities(offline, &identity.CreateConfig{InputFile: inputFile, AutoApprove: true, OutputDir: t.TempDir()})
+		assert.ErrorContains(t, err, "client does not support creating identities")
+	})
+}
@@ -0,0 +1,234 @@
+package identity
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// ReviewDefer は判断ファイルで判断を保留した候補に記録します
+const ReviewDefer = "defer"
+
+// 判断ファイルの列
+const (
+	decisionColumn         = "Decision"
+	decisionChildIDColumn  = "ChildIdentityID"
+	decisionParentIDColumn = "ParentIdentityID"
+	decisionChildPeople    = "ChildPeopleID"
+	decisionParentPeople   = "ParentPeopleID"
+)
+
+// DecisionColumns は --export-decisions で出力する判断ファイルの列です
+// Decision 列を approve, reject, defer のいずれかに編集し、--decisions で読み込みます
+var DecisionColumns = []CSVColumn[MergeCandidate]{
+	{decisionColumn, "判断 (approve, reject, defer)", func(c MergeCandidate) string { return ReviewDefer }},
+	{decisionChildIDColumn, "子アイデンティティの ID", func(c MergeCandidate) string { return c.Child.ID }},
+	{decisionChildPeople, "子アイデンティティの People ID", func(c MergeCandidate) string { return peopleIDValue(c.Child) }},
+	{"ChildEmail", "子アイデンティティのメールアドレス", func(c MergeCandidate) string { return MaskEmail(c.Child.Email) }},
+	{"ChildDisplayName", "子アイデンティティの表示名", func(c MergeCandidate) string { return c.Child.DisplayName }},
+	{"ChildManagementType", "子アイデンティティの管理タイプ", func(c MergeCandidate) string { return c.Child.ManagementType }},
+	{decisionParentIDColumn, "親アイデンティティの ID", func(c MergeCandidate) string { return c.Parent.ID }},
+	{decisionParentPeople, "親アイデンティティの People ID", func(c MergeCandidate) string { return peopleIDValue(c.Parent) }},
+	{"ParentEmail", "親アイデンティティのメールアドレス", func(c MergeCandidate) string { return MaskEmail(c.Parent.Email) }},
+	{"ParentDisplayName", "親アイデンティティの表示名", func(c MergeCandidate) string { return c.Parent.DisplayName }},
+	{"ParentManagementType", "親アイデンティティの管理タイプ", func(c MergeCandidate) string { return c.Parent.ManagementType }},
+	{"NameSimilarity", "親子の表示名の類似度 (0〜1)", func(c MergeCandidate) string { return formatScore(c.NameSimilarity) }},
+	{"Note", "確認の参考情報", func(c MergeCandidate) string { return c.Reason }},
+}
+
+// MergeDecision は判断ファイルの1行です
+type MergeDecision struct {
+	MergePair
+	// Decision は approve, reject, defer のいずれかです。空の場合は defer として扱います
+	Decision string
+	// ChildPeopleID と ParentPeopleID は出力した時点の People ID です。空の場合は照合しません
+	ChildPeopleID  string
+	ParentPeopleID string
+}
+
+// exportMergeDecisions はマージ候補を探して判断ファイルに出力します。マージは行いません
+func exportMergeDecisions(client Client, config *MergeConfig) error {
+	result, err := prepareMergeResult(client, config, nil, nil)
+	if err != nil {
+		return err
+	}
+	return exportDecisions(result, config)
+}
+
+// exportDecisions はマージできる候補を判断ファイルに出力します
+// 表示名の類似度が MinNameSimilarity を下回る候補には Note に注意を記載します
+func exportDecisions(result *MergeResult, config *MergeConfig) error {
+	headers := make([]string, len(DecisionColumns))
+	for i, column := range DecisionColumns {
+		headers[i] = column.Name
+	}
+
+	var rows [][]string
+	for _, candidate := range result.Candidates {
+		if !IsMergeAllowed(candidate.Parent, candidate.Child) {
+			continue
+		}
+		if config.MinNameSimilarity > 0 && candidate.NameSimilarity < config.MinNameSimilarity {
+			candidate.Reason = "low name similarity"
+		}
+		row := make([]string, len(DecisionColumns))
+		for i, column := range DecisionColumns {
+			row[i] = column.Value(candidate)
+		}
+		rows = append(rows, row)
+	}
+
+	writer, err := NewCSVWriter(filepath.Dir(config.ExportDecisions), false, &CSVOptions{Encoding: config.CSV.Encoding, Delimiter: config.CSV.Delimiter})
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteCSV(filepath.Base(config.ExportDecisions), headers, rows); err != nil {
+		return fmt.Errorf("failed to write decisions file: %v", err)
+	}
+	logger.LogInfo("Exported %d merge candidates for review to %s", len(rows), config.ExportDecisions)
+	return nil
+}
+
+// ReadMergeDecisions は判断ファイルを読み込みます
+// ヘッダー行に Decision, ChildIdentityID, ParentIdentityID の列が必要です。それ以外の列は無視します
+// options の文字コードと区切り文字は出力した時と同じものを指定します
+func ReadMergeDecisions(path string, options *CSVOptions) ([]MergeDecision, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decisions file: %v", err)
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if options != nil && options.Encoding == "sjis" {
+		in = japanese.ShiftJIS.NewDecoder().Reader(file)
+	}
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	if options != nil && options.Delimiter != 0 {
+		reader.Comma = options.Delimiter
+	}
+
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decisions file is empty: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decisions header: %v", err)
+	}
+	index := make(map[string]int)
+	for i, header := range headers {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))] = i
+	}
+	for _, required := range []string{decisionColumn, decisionChildIDColumn, decisionParentIDColumn} {
+		if _, ok := index[strings.ToLower(required)]; !ok {
+			return nil, fmt.Errorf("decisions header must contain %q column: %s", required, strings.Join(headers, ","))
+		}
+	}
+
+	var decisions []MergeDecision
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read decisions: %v", err)
+		}
+		value := func(column string) string {
+			if i, ok := index[strings.ToLower(column)]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		line, _ := reader.FieldPos(0)
+		decision := MergeDecision{
+			MergePair:      MergePair{Line: line, Child: value(decisionChildIDColumn), Parent: value(decisionParentIDColumn)},
+			Decision:       strings.ToLower(value(decisionColumn)),
+			ChildPeopleID:  value(decisionChildPeople),
+			ParentPeopleID: value(decisionParentPeople),
+		}
+		if decision.Child == "" && decision.Parent == "" {
+			continue
+		}
+		if decision.Decision == "" {
+			decision.Decision = ReviewDefer
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// resolveDecisions は判断ファイルの行を現在のアイデンティティと照合し、判断を記録したマージ候補を作成します
+// アイデンティティが見つからない、または出力した時点から People ID が変わった行は Unresolved に含めます
+func resolveDecisions(identities []admina.Identity, decisions []MergeDecision) *MergeResult {
+	result := &MergeResult{
+		Candidates: []MergeCandidate{},
+		Unmapped:   []admina.Identity{},
+		Summary: &MergeSummary{
+			TotalIdentities: len(identities),
+			MatchCounts:     make(map[string]int),
+			UnmappedCounts:  make(map[string]int),
+			Decisions:       make(map[string]int),
+		},
+	}
+	byID := make(map[string]admina.Identity, len(identities))
+	for _, identity := range identities {
+		byID[identity.ID] = identity
+	}
+
+	for _, decision := range decisions {
+		child, childFound := byID[decision.Child]
+		parent, parentFound := byID[decision.Parent]
+		var reason string
+		switch {
+		case decision.Decision != ReviewApprove && decision.Decision != ReviewReject && decision.Decision != ReviewDefer:
+			reason = fmt.Sprintf("invalid decision %q (must be approve, reject or defer)", decision.Decision)
+		case !childFound:
+			reason = fmt.Sprintf("child identity %s not found", decision.Child)
+		case !parentFound:
+			reason = fmt.Sprintf("parent identity %s not found", decision.Parent)
+		case child.ID == parent.ID:
+			reason = "child and parent are the same identity"
+		case decision.ChildPeopleID != "" && decision.ChildPeopleID != peopleIDValue(child):
+			reason = fmt.Sprintf("child people ID changed since export: %s -> %s", decision.ChildPeopleID, peopleIDValue(child))
+		case decision.ParentPeopleID != "" && decision.ParentPeopleID != peopleIDValue(parent):
+			reason = fmt.Sprintf("parent people ID changed since export: %s -> %s", decision.ParentPeopleID, peopleIDValue(parent))
+		case child.PeopleID != 0 && child.PeopleID == parent.PeopleID:
+			reason = "already merged"
+		}
+		if reason != "" {
+			result.Unresolved = append(result.Unresolved, UnresolvedPair{MergePair: decision.MergePair, Reason: reason})
+			continue
+		}
+
+		candidate := newMergeCandidate(parent, child)
+		candidate.review = decision.Decision
+		result.Candidates = append(result.Candidates, candidate)
+		result.Summary.MatchCounts[ExtractDomain(child.Email)]++
+		result.Summary.Decisions[decision.Decision]++
+	}
+
+	result.Summary.MergeCandidates = len(result.Candidates)
+	result.Summary.UnresolvedPairs = len(result.Unresolved)
+
+	logger.PrintErr("=== Merge Decisions Summary ===\n")
+	logger.PrintErr("Rows in file: %d\n", len(decisions))
+	logger.PrintErr("Approved: %d, Rejected: %d, Deferred: %d\n",
+		result.Summary.Decisions[ReviewApprove], result.Summary.Decisions[ReviewReject], result.Summary.Decisions[ReviewDefer])
+	logger.PrintErr("Stale or invalid rows: %d\n", len(result.Unresolved))
+	for _, unresolved := range result.Unresolved {
+		logger.PrintErr("  - line %d: %s\n", unresolved.Line, unresolved.Reason)
+	}
+	logger.PrintErr("=== Analysis Complete ===\n")
+	return result
+}
@@ -0,0 +1,142 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMergeDecisions(t *testing.T) {
+	t.Run("空の判断は defer として読み込む", func(t *testing.T) {
+		path := writeCSVFile(t, "\ufeffdecision,ChildIdentityID,ChildPeopleID,ParentIdentityID\nAPPROVE,200,201,100\n,210,,110\n\n")
+
+		decisions, err := identity.ReadMergeDecisions(path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []identity.MergeDecision{
+			{MergePair: identity.MergePair{Line: 2, Child: "200", Parent: "100"}, Decision: identity.ReviewApprove, ChildPeopleID: "201"},
+			{MergePair: identity.MergePair{Line: 3, Child: "210", Parent: "110"}, Decision: identity.ReviewDefer},
+		}, decisions)
+	})
+
+	t.Run("区切り文字を指定して読み込む", func(t *testing.T) {
+		path := writeCSVFile(t, "Decision;ChildIdentityID;ParentIdentityID\nreject;200;100\n")
+
+		decisions, err := identity.ReadMergeDecisions(path, &identity.CSVOptions{Delimiter: ';'})
+		require.NoError(t, err)
+		require.Len(t, decisions, 1)
+		assert.Equal(t, identity.ReviewReject, decisions[0].Decision)
+	})
+
+	t.Run("必須の列が必要", func(t *testing.T) {
+		_, err := identity.ReadMergeDecisions(writeCSVFile(t, "Decision,ChildIdentityID\napprove,200\n"), nil)
+		assert.ErrorContains(t, err, `decisions header must contain "ParentIdentityID" column`)
+	})
+}
+
+func TestMergeIdentitiesDecisions(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(false)
+
+	// 候補を判断ファイルに出力する。マージは行わない
+	decisionsFile := filepath.Join(t.TempDir(), "decisions.csv")
+	client := &mock.Client{Identities: confirmTestIdentities}
+	require.NoError(t, identity.MergeIdentities(client, &identity.MergeConfig{
+		ParentDomain:    "parent.domain.com",
+		ChildDomains:    []string{"child.domain.com"},
+		OutputFormat:    "json",
+		OutputDir:       t.TempDir(),
+		ExportDecisions: decisionsFile,
+	}))
+	assert.Empty(t, client.MergeResults)
+
+	content, err := os.ReadFile(decisionsFile)
+	require.NoError(t, err)
+	rows := readCSV(t, content)
+	require.Len(t, rows, 4)
+	assert.Equal(t, []string{"Decision", "ChildIdentityID", "ChildPeopleID", "ChildEmail"}, rows[0][:4])
+	assert.Equal(t, []string{"defer", "200", "201", "a@child.domain.com"}, rows[1][:4])
+
+	// 担当者が Decision 列を編集する
+	rows[1][0] = "approve"
+	rows[2][0] = "reject"
+	var lines []string
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, ","))
+	}
+	lines = append(lines, "approve,999,,,,,100,101,,,,,")
+	require.NoError(t, os.WriteFile(decisionsFile, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+
+	run := func(t *testing.T, identities []admina.Identity, dryRun bool) (*mock.Client, string) {
+		t.Helper()
+		client := &mock.Client{Identities: identities}
+		outputDir := t.TempDir()
+		require.NoError(t, identity.MergeIdentities(client, &identity.MergeConfig{
+			DecisionsFile: decisionsFile,
+			DryRun:        dryRun,
+			OutputFormat:  "json",
+			OutputDir:     outputDir,
+			OutputDirMode: "overwrite",
+			CSV:           identity.CSVOptions{Columns: []string{"ChildIdentityID", "Status", "Reason"}},
+		}))
+		return client, outputDir
+	}
+
+	t.Run("approve の行のみをマージする", func(t *testing.T) {
+		client, outputDir := run(t, confirmTestIdentities, false)
+		require.Len(t, client.MergeResults, 1)
+		assert.Equal(t, 201, client.MergeResults[0].FromPeopleID)
+		assert.Equal(t, 101, client.MergeResults[0].ToPeopleID)
+
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_mappings.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"ChildIdentityID", "Status", "Reason"},
+			{"200", "Success", ""},
+			{"210", "Skip", "rejected in review"},
+			{"220", "Skip", "deferred in review"},
+		}, readCSV(t, content))
+
+		content, err = os.ReadFile(filepath.Join(outputDir, "unresolved_pairs.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"5", "999", "100", "child identity 999 not found"}, readCSV(t, content)[1])
+
+		manifest, err := os.ReadFile(filepath.Join(outputDir, identity.ManifestFileName))
+		require.NoError(t, err)
+		assert.Contains(t, string(manifest), `"decisions": {`)
+		assert.Contains(t, string(manifest), `"decisionsFile": "`+decisionsFile+`"`)
+	})
+
+	t.Run("dry-run ではマージしない", func(t *testing.T) {
+		client, _ := run(t, confirmTestIdentities, true)
+		assert.Empty(t, client.MergeResults)
+	})
+
+	t.Run("出力後に People ID が変わった行はマージしない", func(t *testing.T) {
+		identities := append([]admina.Identity{}, confirmTestIdentities...)
+		identities[3].PeopleID = 101 // 既に a@parent にマージ済み
+		client, outputDir := run(t, identities, false)
+		assert.Empty(t, client.MergeResults)
+
+		content, err := os.ReadFile(filepath.Join(outputDir, "unresolved_pairs.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "200", "100", "child people ID changed since export: 201 -> 101"}, readCSV(t, content)[1])
+	})
+
+	t.Run("--review とは併用できない", func(t *testing.T) {
+		err := identity.MergeIdentities(&mock.Client{Identities: confirmTestIdentities}, &identity.MergeConfig{
+			DecisionsFile: decisionsFile,
+			Review:        true,
+			OutputFormat:  "json",
+			OutputDir:     t.TempDir(),
+		})
+		assert.ErrorContains(t, err, "--review cannot be used with --decisions")
+	})
+}
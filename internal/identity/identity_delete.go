@@ -0,0 +1,453 @@
+package identity
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// 削除結果と復元用ファイルのファイル名
+const (
+	deleteResultsFileName = "identity_delete_results.csv"
+	// RecoveryFileName は削除前のアイデンティティをスナップショット形式で保存するファイルです
+	RecoveryFileName = "deleted_identities.jsonl"
+)
+
+// deleteIDColumn は削除対象のCSVの必須列です（大文字小文字は区別しません）
+const deleteIDColumn = "id"
+
+// DeleteConfig は identity delete の設定です
+type DeleteConfig struct {
+	// Filter に一致するアイデンティティを削除します。InputFile とは同時に指定できません
+	Filter *ListOptions
+	// InputFile は削除するアイデンティティを id 列に記載したCSVファイルです
+	InputFile string
+	// Force が true の場合のみ managed のアイデンティティを削除します
+	Force  bool
+	DryRun bool
+	// ConfirmCount が 0 より大きい場合、対話的な確認の代わりに削除件数と一致するかを確認します
+	ConfirmCount int
+	// Stdin は確認プロンプトの入力です。nil の場合は標準入力を使い、端末でない場合は --confirm-count なしでは実行できません
+	Stdin io.Reader
+	// Interval は削除APIを連続して呼び出す際の最小間隔です
+	Interval      time.Duration
+	OutputDir     string
+	OutputDirMode string
+	// CSV は結果ファイルの文字コード・区切り文字です。列の指定は使用しません
+	CSV          CSVOptions
+	Organization *admina.Organization
+	Version      string
+	Args         []string
+}
+
+// DeleteResult は1件分の削除結果です
+// Status は Success, Skip (dry-run・未確認), Refused (managed), NotFound, Error のいずれかです
+type DeleteResult struct {
+	// Query は CSV で指定された値です。フィルタで選んだ場合は空です
+	Query    string
+	Line     int
+	Identity admina.Identity
+	Status   string
+	Reason   string
+}
+
+// DeleteTarget は削除対象のCSVの1行です
+type DeleteTarget struct {
+	Line  int
+	Value string
+}
+
+// HasFilter は削除対象を絞り込む条件が指定されているかを返します
+// 並び替え・表示フィールド・件数の指定は絞り込みとみなしません
+func (o *ListOptions) HasFilter() bool {
+	return o.Where != nil || len(o.Domains) > 0 || len(o.ManagementTypes) > 0 ||
+		len(o.EmployeeTypes) > 0 || len(o.EmployeeStatuses) > 0 || o.Search != "" ||
+		o.PeopleID != 0 || o.HasSecondaryEmails != nil || o.HasMergedPeople != nil
+}
+
+// ReadDeleteIDs は削除対象のCSVを読み込み、行番号と値を返します
+// 値にはアイデンティティID・People ID・メールアドレスを指定できます
+func ReadDeleteIDs(path string) ([]DeleteTarget, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delete targets: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("delete targets file is empty: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delete targets header: %v", err)
+	}
+
+	idIndex := -1
+	for i, header := range headers {
+		if strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))) == deleteIDColumn {
+			idIndex = i
+		}
+	}
+	if idIndex < 0 {
+		return nil, fmt.Errorf("delete targets header must contain %q column: %s", deleteIDColumn, strings.Join(headers, ","))
+	}
+
+	var targets []DeleteTarget
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delete targets: %v", err)
+		}
+		if idIndex >= len(record) || strings.TrimSpace(record[idIndex]) == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		targets = append(targets, DeleteTarget{Line: line, Value: strings.TrimSpace(record[idIndex])})
+	}
+	return targets, nil
+}
+
+// selectDeleteTargets は削除対象を決定し、managed や見つからない対象の結果を設定します
+func selectDeleteTargets(identities []admina.Identity, config *DeleteConfig, targets []DeleteTarget) []DeleteResult {
+	var results []DeleteResult
+	if config.InputFile != "" {
+		seen := make(map[string]bool)
+		for _, target := range targets {
+			identity, err := resolveTargetIdentity(identities, target.Value)
+			result := DeleteResult{Query: target.Value, Line: target.Line, Identity: identity}
+			if errors.Is(err, errIndirectMatch) {
+				result.Status = "Refused"
+				result.Reason = err.Error()
+			} else if err != nil {
+				result.Status = "NotFound"
+				result.Reason = err.Error()
+			} else if seen[identity.ID] {
+				continue
+			}
+			seen[identity.ID] = true
+			results = append(results, result)
+		}
+	} else {
+		for _, identity := range identities {
+			if config.Filter.matches(identity) {
+				results = append(results, DeleteResult{Identity: identity})
+			}
+		}
+	}
+
+	for i := range results {
+		result := &results[i]
+		if result.Status != "" {
+			continue
+		}
+		if reason := deleteRefusedReason(result.Identity, config.Force); reason != "" {
+			result.Status = "Refused"
+			result.Reason = reason
+		}
+	}
+	return results
+}
+
+// errIndirectMatch は値がセカンダリーメールまたは統合済み People のメールアドレスにのみ一致したことを表します
+var errIndirectMatch = errors.New("matches only a secondary or merged email")
+
+// resolveTargetIdentity は削除・変更の対象をアイデンティティID、People ID、プライマリメールアドレスの完全一致で1件に決めます
+// セカンダリーメールや統合済み People のメールアドレスは統合先の別のアイデンティティを指すため、一致しても対象にしません
+func resolveTargetIdentity(identities []admina.Identity, value string) (admina.Identity, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return admina.Identity{}, fmt.Errorf("identity is empty")
+	}
+	peopleID, err := strconv.Atoi(value)
+	isPeopleID := err == nil && peopleID != 0
+
+	var matched []admina.Identity
+	for _, identity := range identities {
+		if identity.ID == value ||
+			(isPeopleID && identity.PeopleID == peopleID) ||
+			(strings.Contains(value, "@") && strings.EqualFold(identity.Email, value)) {
+			matched = append(matched, identity)
+		}
+	}
+	switch len(matched) {
+	case 1:
+		return matched[0], nil
+	case 0:
+		if indirect := FindIdentities(identities, value); len(indirect) > 0 {
+			return admina.Identity{}, fmt.Errorf("identity %s %w of %s (%s); specify its identity ID or primary email",
+				MaskEmail(value), errIndirectMatch, MaskEmail(indirect[0].Email), indirect[0].ID)
+		}
+		return admina.Identity{}, fmt.Errorf("identity %s not found", MaskEmail(value))
+	default:
+		return admina.Identity{}, fmt.Errorf("identity %s matches %d identities", MaskEmail(value), len(matched))
+	}
+}
+
+// deleteRefusedReason は --force なしでは削除しないアイデンティティの理由を返します。削除できる場合は空です
+func deleteRefusedReason(identity admina.Identity, force bool) string {
+	if identity.ManagementType == "managed" && !force {
+		return "managed identity requires --force"
+	}
+	return ""
+}
+
+// DeleteIdentities はフィルタまたはCSVで指定したアイデンティティを削除します
+// 削除の前に対象を復元用ファイルに保存し、件数の入力による確認を求めます
+func DeleteIdentities(client Client, config *DeleteConfig) error {
+	logger.LogInfo("Starting identity delete process")
+
+	if config.InputFile == "" && (config.Filter == nil || !config.Filter.HasFilter()) {
+		return fmt.Errorf("delete requires a filter or --from-csv; refusing to delete all identities")
+	}
+	if config.InputFile != "" && config.Filter != nil && config.Filter.HasFilter() {
+		return fmt.Errorf("specify either a filter or --from-csv for delete, not both")
+	}
+	if err := config.CSV.Validate(); err != nil {
+		return err
+	}
+	run, err := NewOutputRun(config.OutputDir, config.OutputDirMode, time.Now())
+	if err != nil {
+		return err
+	}
+	deleter, canDelete := client.(IdentityDeleter)
+	if !config.DryRun && !canDelete {
+		return fmt.Errorf("client does not support deleting identities")
+	}
+	var prompt *bufio.Reader
+	if !config.DryRun && config.ConfirmCount <= 0 {
+		// 応答できない入力で待ち続けないよう、取得の前に確認する
+		if prompt, err = openPrompt(config.Stdin, "use --confirm-count to delete without confirmation, or --dry-run to preview"); err != nil {
+			return err
+		}
+	}
+
+	var targets []DeleteTarget
+	if config.InputFile != "" {
+		if targets, err = ReadDeleteIDs(config.InputFile); err != nil {
+			return err
+		}
+		logger.LogInfo("Read %d delete targets from %s", len(targets), config.InputFile)
+	}
+
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch identities: %v", err)
+	}
+	results := selectDeleteTargets(identities, config, targets)
+
+	var pending []int
+	for i, result := range results {
+		if result.Status == "" {
+			pending = append(pending, i)
+		}
+	}
+	logger.PrintErr("=== Identity Delete Summary ===\n")
+	logger.PrintErr("Matched identities: %d\n", len(results))
+	logger.PrintErr("To be deleted: %d\n", len(pending))
+	for _, result := range results {
+		if result.Status != "" {
+			logger.PrintErr("  - %s %s: %s\n", result.Status, MaskEmail(deleteResultLabel(result)), result.Reason)
+		}
+	}
+
+	switch {
+	case len(pending) == 0:
+		logger.LogInfo("No identities to delete")
+	case config.DryRun:
+		for _, i := range pending {
+			results[i].Status = "Skip"
+			results[i].Reason = "dry-run"
+			logger.LogInfo("Dry-run: Would delete %s (%s)", MaskEmail(results[i].Identity.Email), results[i].Identity.ID)
+		}
+	case !confirmDelete(prompt, len(pending), config.ConfirmCount):
+		for _, i := range pending {
+			results[i].Status = "Skip"
+			results[i].Reason = "not confirmed"
+		}
+		if err := outputDeleteResults(results, config, run, false); err != nil {
+			return err
+		}
+		return fmt.Errorf("delete was not confirmed: expected %d", len(pending))
+	default:
+		// 削除前に対象を保存しておき、途中で失敗しても復元できるようにする
+		deleted := make([]admina.Identity, 0, len(pending))
+		for _, i := range pending {
+			deleted = append(deleted, results[i].Identity)
+		}
+		if err := run.Prepare(); err != nil {
+			return err
+		}
+		if err := newRecoveryFile(run.Dir, config.Organization).add(deleted...); err != nil {
+			return err
+		}
+		deleteTargets(deleter, config, results, pending)
+	}
+
+	if err := outputDeleteResults(results, config, run, !config.DryRun && len(pending) > 0); err != nil {
+		return err
+	}
+
+	deletedCount, skippedCount, errorCount := countDeleteResults(results)
+	if errorCount > 0 {
+		return fmt.Errorf("completed with %d errors, %d deleted, %d skipped", errorCount, deletedCount, skippedCount)
+	}
+	return nil
+}
+
+func deleteTargets(deleter IdentityDeleter, config *DeleteConfig, results []DeleteResult, pending []int) {
+	ctx := context.Background()
+	throttle := newRequestThrottle(config.Interval)
+	for _, i := range pending {
+		result := &results[i]
+		throttle.Wait()
+		if err := deleter.DeleteIdentity(ctx, result.Identity.ID); err != nil {
+			logger.LogInfo("Failed to delete %s (%s): %v", MaskEmail(result.Identity.Email), result.Identity.ID, err)
+			result.Status = "Error"
+			result.Reason = fmt.Sprintf("Failed to delete: %v", err)
+			continue
+		}
+		logger.LogInfo("Successfully deleted %s (%s)", MaskEmail(result.Identity.Email), result.Identity.ID)
+		result.Status = "Success"
+	}
+}
+
+// confirmDelete は削除件数の入力による確認を行います
+// confirmCount が指定されている場合は標準入力を読まずに件数と比較します
+func confirmDelete(prompt *bufio.Reader, count, confirmCount int) bool {
+	if confirmCount > 0 {
+		return confirmCount == count
+	}
+	return confirmOnce(prompt, fmt.Sprintf("This will permanently delete %d identities. Type the number of identities to confirm: ", count), strconv.Itoa(count))
+}
+
+// recoveryFile は削除するアイデンティティを出力先の復元用ファイルにスナップショット形式で記録します
+// overwrite・append では出力先を複数の実行で共有するため、既存のファイルの記録を残したまま追記します
+type recoveryFile struct {
+	path         string
+	organization *admina.Organization
+	identities   []admina.Identity
+	loaded       bool
+}
+
+func newRecoveryFile(dir string, organization *admina.Organization) *recoveryFile {
+	return &recoveryFile{path: filepath.Join(dir, RecoveryFileName), organization: organization}
+}
+
+// add は identities を記録に加えてファイルを書き直します
+// 書き直しは一時ファイルから置き換えるため、途中で失敗しても以前の記録は失われません
+func (f *recoveryFile) add(identities ...admina.Identity) error {
+	if !f.loaded {
+		existing, err := ReadSnapshotFile(f.path)
+		switch {
+		case err == nil:
+			f.identities = existing.Identities
+		case !errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("failed to read existing recovery file: %v", err)
+		}
+		f.loaded = true
+	}
+
+	f.identities = append(f.identities, identities...)
+	snapshot := &Snapshot{
+		SnapshotMeta: SnapshotMeta{FetchedAt: time.Now()},
+		Identities:   f.identities,
+	}
+	if f.organization != nil {
+		snapshot.OrganizationID = strconv.Itoa(f.organization.ID)
+	}
+	if err := WriteSnapshotFile(f.path, snapshot); err != nil {
+		return fmt.Errorf("failed to write recovery file: %v", err)
+	}
+	logger.LogInfo("Recovery file written to %s (%d identities)", f.path, len(f.identities))
+	return nil
+}
+
+func countDeleteResults(results []DeleteResult) (deletedCount, skippedCount, errorCount int) {
+	for _, result := range results {
+		switch result.Status {
+		case "Success":
+			deletedCount++
+		case "Skip", "Refused":
+			skippedCount++
+		case "Error", "NotFound":
+			errorCount++
+		}
+	}
+	return
+}
+
+func deleteResultLabel(result DeleteResult) string {
+	if result.Identity.ID == "" {
+		return result.Query
+	}
+	return result.Identity.Email
+}
+
+// deleteResultHeaders は identity_delete_results.csv のヘッダーです
+var deleteResultHeaders = []string{"Line", "Query", "IdentityID", "PeopleID", "Email", "DisplayName", "ManagementType", "EmployeeStatus", "Status", "Reason"}
+
+func deleteResultRows(results []DeleteResult) [][]string {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		line := ""
+		if result.Line > 0 {
+			line = strconv.Itoa(result.Line)
+		}
+		rows = append(rows, []string{
+			line,
+			MaskEmail(result.Query),
+			result.Identity.ID,
+			peopleIDValue(result.Identity),
+			MaskEmail(result.Identity.Email),
+			result.Identity.DisplayName,
+			result.Identity.ManagementType,
+			result.Identity.EmployeeStatus,
+			result.Status,
+			result.Reason,
+		})
+	}
+	return rows
+}
+
+func outputDeleteResults(results []DeleteResult, config *DeleteConfig, run *OutputRun, withRecovery bool) error {
+	if err := run.Prepare(); err != nil {
+		return err
+	}
+	csvWriter, err := NewCSVWriter(run.Dir, run.Append(), &config.CSV)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV writer: %v", err)
+	}
+	if err := csvWriter.WriteCSV(deleteResultsFileName, deleteResultHeaders, deleteResultRows(results)); err != nil {
+		return fmt.Errorf("failed to write delete results CSV: %v", err)
+	}
+	logger.LogInfo("Delete results written to %s", run.Dir)
+
+	files := []string{deleteResultsFileName}
+	if withRecovery {
+		files = append(files, RecoveryFileName)
+	}
+	deletedCount, skippedCount, errorCount := countDeleteResults(results)
+	manifest := newManifest("delete", config.Version, config.Args, config.Organization, run, config.DryRun)
+	manifest.InputFile = config.InputFile
+	manifest.Deleted = deletedCount
+	manifest.Skipped = skippedCount
+	manifest.Errors = errorCount
+	return WriteManifest(run.Dir, manifest, files)
+}
@@ -0,0 +1,209 @@
+package identity_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDeleteIDs(t *testing.T) {
+	targets, err := identity.ReadDeleteIDs(writeCSVFile(t, "\ufeffID,memo\n# コメント\n100,a\n,empty\nunmapped@child.domain.com,b\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []identity.DeleteTarget{{Line: 3, Value: "100"}, {Line: 5, Value: "unmapped@child.domain.com"}}, targets)
+
+	_, err = identity.ReadDeleteIDs(writeCSVFile(t, "email\na@b.com\n"))
+	assert.ErrorContains(t, err, `delete targets header must contain "id" column`)
+}
+
+func TestDeleteIdentities(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	readResults := func(t *testing.T, outputDir string) [][]string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_delete_results.csv"))
+		require.NoError(t, err)
+		return readCSV(t, content)
+	}
+	newConfig := func(t *testing.T) *identity.DeleteConfig {
+		return &identity.DeleteConfig{
+			Filter:        &identity.ListOptions{Domains: []string{"parent.domain.com", "child.domain.com"}},
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+		}
+	}
+
+	t.Run("条件の指定がない場合は削除しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{Sort: "email", Limit: 1}
+		err := identity.DeleteIdentities(client, config)
+		assert.ErrorContains(t, err, "refusing to delete all identities")
+
+		config.Filter.Search = "user1"
+		config.InputFile = writeCSVFile(t, "id\n100\n")
+		err = identity.DeleteIdentities(client, config)
+		assert.ErrorContains(t, err, "not both")
+		assert.Empty(t, client.DeletedIDs)
+	})
+
+	t.Run("dry-run では削除せず、managed は Refused になる", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.DryRun = true
+		require.NoError(t, identity.DeleteIdentities(client, config))
+		assert.Empty(t, client.DeletedIDs)
+
+		results := readResults(t, config.OutputDir)
+		assert.Equal(t, []string{"Line", "Query", "IdentityID", "PeopleID", "Email", "DisplayName", "ManagementType", "EmployeeStatus", "Status", "Reason"}, results[0])
+		assert.Equal(t, []string{"", "", "100", "101", "user1@parent.domain.com", "", "managed", "active", "Refused", "managed identity requires --force"}, results[1])
+		assert.Equal(t, []string{"Skip", "dry-run"}, results[2][8:])
+		assert.NoFileExists(t, filepath.Join(config.OutputDir, identity.RecoveryFileName))
+	})
+
+	t.Run("件数が一致しない場合は削除しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.ConfirmCount = 3
+		err := identity.DeleteIdentities(client, config)
+		assert.ErrorContains(t, err, "delete was not confirmed: expected 2")
+		assert.Empty(t, client.DeletedIDs)
+		assert.Equal(t, []string{"Skip", "not confirmed"}, readResults(t, config.OutputDir)[2][8:])
+	})
+
+	t.Run("入力した件数で確認する", func(t *testing.T) {
+		for _, tt := range []struct {
+			name    string
+			input   string
+			deleted []string
+		}{
+			{name: "一致", input: "2\n", deleted: []string{"200", "300"}},
+			{name: "不一致", input: "y\n"},
+			{name: "入力の終了", input: ""},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				client := &mock.Client{Identities: testIdentities}
+				config := newConfig(t)
+				config.Stdin = strings.NewReader(tt.input)
+				err := identity.DeleteIdentities(client, config)
+				assert.Equal(t, tt.deleted, client.DeletedIDs)
+				if tt.deleted == nil {
+					assert.ErrorContains(t, err, "delete was not confirmed: expected 2")
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	})
+
+	t.Run("端末でない標準入力では --confirm-count なしで実行しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		withStdin(t, "2\n")
+		err := identity.DeleteIdentities(client, newConfig(t))
+		assert.ErrorContains(t, err, "stdin is not a terminal: use --confirm-count to delete without confirmation")
+		assert.Empty(t, client.DeletedIDs)
+	})
+
+	t.Run("削除前に復元用ファイルを保存し、結果を出力する", func(t *testing.T) {
+		client := &mock.Client{
+			Identities:   testIdentities,
+			DeleteErrors: map[string]error{"300": fmt.Errorf("404 not found")},
+		}
+		config := newConfig(t)
+		config.Force = true
+		config.ConfirmCount = 3
+		config.Version = "1.2.3"
+		err := identity.DeleteIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 1 errors, 2 deleted, 0 skipped")
+		assert.Equal(t, []string{"100", "200"}, client.DeletedIDs)
+
+		recovery, err := identity.ReadSnapshotFile(filepath.Join(config.OutputDir, identity.RecoveryFileName))
+		require.NoError(t, err)
+		assert.Equal(t, testIdentities, recovery.Identities)
+
+		results := readResults(t, config.OutputDir)
+		assert.Equal(t, "Success", results[1][8])
+		assert.Equal(t, []string{"Error", "Failed to delete: 404 not found"}, results[3][8:])
+
+		manifest, err := identity.ReadManifest(config.OutputDir)
+		require.NoError(t, err)
+		assert.Equal(t, "delete", manifest.Command)
+		assert.Equal(t, 2, manifest.Deleted)
+		assert.Equal(t, 1, manifest.Errors)
+		require.Len(t, manifest.Files, 2)
+		assert.Equal(t, identity.RecoveryFileName, manifest.Files[1].Name)
+	})
+
+	t.Run("同じ出力先への2回目の削除は復元用ファイルに追記する", func(t *testing.T) {
+		outputDir := t.TempDir()
+		for _, mode := range []string{"overwrite", "append"} {
+			for _, id := range []string{"200", "300"} {
+				config := newConfig(t)
+				config.Filter = &identity.ListOptions{}
+				config.InputFile = writeCSVFile(t, "id\n"+id+"\n")
+				config.OutputDir = outputDir
+				config.OutputDirMode = mode
+				config.ConfirmCount = 1
+				require.NoError(t, identity.DeleteIdentities(&mock.Client{Identities: testIdentities}, config))
+			}
+		}
+
+		recovery, err := identity.ReadSnapshotFile(filepath.Join(outputDir, identity.RecoveryFileName))
+		require.NoError(t, err)
+		var ids []string
+		for _, deleted := range recovery.Identities {
+			ids = append(ids, deleted.ID)
+		}
+		assert.Equal(t, []string{"200", "300", "200", "300"}, ids)
+	})
+
+	t.Run("CSV で指定したアイデンティティを削除する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{}
+		config.InputFile = writeCSVFile(t, "id\n202\nunmapped@child.domain.com\nuser1@child.domain.com\nnobody@example.com\n100\n")
+		config.ConfirmCount = 2
+		err := identity.DeleteIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 1 errors, 2 deleted, 1 skipped")
+		assert.Equal(t, []string{"200", "300"}, client.DeletedIDs)
+
+		results := readResults(t, config.OutputDir)
+		require.Len(t, results, 5)
+		assert.Equal(t, []string{"2", "202", "200"}, results[1][:3])
+		assert.Equal(t, []string{"5", "nobody@example.com", "", "", "", "", "", "", "NotFound"}, results[3][:9])
+		assert.Equal(t, "Refused", results[4][8])
+	})
+
+	t.Run("セカンダリーメールにのみ一致する行は削除しない", func(t *testing.T) {
+		identities := append(append([]admina.Identity{}, testIdentities...),
+			admina.Identity{ID: "400", PeopleID: 401, ManagementType: "external", Email: "new@child.domain.com", SecondaryEmails: []string{"old@child.domain.com"}})
+		client := &mock.Client{Identities: identities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{}
+		config.InputFile = writeCSVFile(t, "id\nold@child.domain.com\nNEW@child.domain.com\n")
+		config.ConfirmCount = 1
+		require.NoError(t, identity.DeleteIdentities(client, config))
+		assert.Equal(t, []string{"400"}, client.DeletedIDs)
+
+		results := readResults(t, config.OutputDir)
+		require.Len(t, results, 3)
+		assert.Equal(t, []string{"Refused", "identity old@child.domain.com matches only a secondary or merged email of new@child.domain.com (400); specify its identity ID or primary email"}, results[1][8:])
+		assert.Equal(t, []string{"3", "NEW@child.domain.com", "400"}, results[2][:3])
+	})
+
+	t.Run("削除に対応していないクライアント", func(t *testing.T) {
+		offline := identity.NewCachedClient(nil, identity.NewSnapshotStore(t.TempDir()), "123", 0, true)
+		err := identity.DeleteIdentities(offline, newConfig(t))
+		assert.ErrorContains(t, err, "client does not support deleting identities")
+	})
+}
@@ -0,0 +1,481 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// FieldChange は1つのフィールドの変更内容です
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// IdentityChange は両方のスナップショットに存在し、内容が変わったアイデンティティです
+type IdentityChange struct {
+	Old     admina.Identity `json:"old"`
+	New     admina.Identity `json:"new"`
+	Changes []FieldChange   `json:"changes"`
+}
+
+// IdentityMerge は新しいスナップショットで別のアイデンティティに統合されたアイデンティティです
+type IdentityMerge struct {
+	Identity admina.Identity `json:"identity"`
+	Into     admina.Identity `json:"into"`
+}
+
+// MatrixDelta は2つのスナップショット間のマトリックスの差分です
+// Old と New は identity matrix と同じ形式で、両スナップショットに現れる行・列に揃えて集計します
+type MatrixDelta struct {
+	Old   *Matrix `json:"old"`
+	New   *Matrix `json:"new"`
+	Delta [][]int `json:"delta"`
+}
+
+// IdentityDiff は2つのスナップショットの差分です
+type IdentityDiff struct {
+	Old     SnapshotMeta      `json:"old"`
+	New     SnapshotMeta      `json:"new"`
+	Added   []admina.Identity `json:"added"`
+	Removed []admina.Identity `json:"removed"`
+	Merged  []IdentityMerge   `json:"merged"`
+	Changed []IdentityChange  `json:"changed"`
+	Matrix  *MatrixDelta      `json:"matrix"`
+}
+
+// DiffFormatter はスナップショット差分のフォーマット方法を定義するインターフェース
+type DiffFormatter interface {
+	Format(diff *IdentityDiff) (string, error)
+}
+
+// ExportSnapshot は全アイデンティティを取得して path にスナップショットとして保存します
+func ExportSnapshot(client Client, organizationID, path string) (*Snapshot, error) {
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		SnapshotMeta: SnapshotMeta{
+			OrganizationID: organizationID,
+			FetchedAt:      time.Now(),
+		},
+		Identities: identities,
+	}
+	if err := WriteSnapshotFile(path, snapshot); err != nil {
+		return nil, err
+	}
+
+	logger.LogInfo("Exported %d identities to %s", len(identities), path)
+	return snapshot, nil
+}
+
+// PrintSnapshotDiff は2つのスナップショットファイルを比較して結果を出力します
+func PrintSnapshotDiff(oldPath, newPath, outputFormat string) error {
+	formatter, err := DiffFormats.New(outputFormat, nil)
+	if err != nil {
+		return err
+	}
+
+	oldSnapshot, err := ReadSnapshotFile(oldPath)
+	if err != nil {
+		return err
+	}
+	newSnapshot, err := ReadSnapshotFile(newPath)
+	if err != nil {
+		return err
+	}
+	if oldSnapshot.OrganizationID != newSnapshot.OrganizationID {
+		logger.LogWarning("Comparing snapshots of different organizations: %s and %s", oldSnapshot.OrganizationID, newSnapshot.OrganizationID)
+	}
+
+	diff := DiffSnapshots(oldSnapshot, newSnapshot)
+
+	output, err := formatter.Format(diff)
+	if err != nil {
+		return fmt.Errorf("failed to format diff: %v", err)
+	}
+
+	logger.LogInfo("Outputting identity diff")
+	logger.Print("%s", output)
+	return nil
+}
+
+// DiffSnapshots は2つのスナップショットをアイデンティティIDで突き合わせて差分を求めます
+func DiffSnapshots(oldSnapshot, newSnapshot *Snapshot) *IdentityDiff {
+	diff := &IdentityDiff{
+		Old:     oldSnapshot.SnapshotMeta,
+		New:     newSnapshot.SnapshotMeta,
+		Added:   []admina.Identity{},
+		Removed: []admina.Identity{},
+		Merged:  []IdentityMerge{},
+		Changed: []IdentityChange{},
+	}
+
+	oldByID := make(map[string]admina.Identity, len(oldSnapshot.Identities))
+	for _, identity := range oldSnapshot.Identities {
+		oldByID[identity.ID] = identity
+	}
+	newByID := make(map[string]admina.Identity, len(newSnapshot.Identities))
+	for _, identity := range newSnapshot.Identities {
+		newByID[identity.ID] = identity
+	}
+
+	for _, newIdentity := range newSnapshot.Identities {
+		oldIdentity, exists := oldByID[newIdentity.ID]
+		if !exists {
+			diff.Added = append(diff.Added, newIdentity)
+			continue
+		}
+		if changes := compareIdentities(oldIdentity, newIdentity); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, IdentityChange{Old: oldIdentity, New: newIdentity, Changes: changes})
+		}
+	}
+
+	for _, oldIdentity := range oldSnapshot.Identities {
+		if _, exists := newByID[oldIdentity.ID]; exists {
+			continue
+		}
+		if into, ok := findMergeTarget(oldIdentity, newSnapshot.Identities); ok {
+			diff.Merged = append(diff.Merged, IdentityMerge{Identity: oldIdentity, Into: into})
+			continue
+		}
+		diff.Removed = append(diff.Removed, oldIdentity)
+	}
+
+	diff.Matrix = diffMatrix(oldSnapshot.Identities, newSnapshot.Identities)
+	return diff
+}
+
+// findMergeTarget は消えたアイデンティティを取り込んだアイデンティティを探します
+func findMergeTarget(removed admina.Identity, identities []admina.Identity) (admina.Identity, bool) {
+	for _, candidate := range identities {
+		for _, merged := range candidate.MergedPeople {
+			if removed.PeopleID != 0 && merged.ID == removed.PeopleID {
+				return candidate, true
+			}
+		}
+		if removed.Email != "" && contains(candidate.SecondaryEmails, removed.Email) {
+			return candidate, true
+		}
+	}
+	return admina.Identity{}, false
+}
+
+// compareIdentities はアイデンティティのフィールドごとの変更を返します
+func compareIdentities(oldIdentity, newIdentity admina.Identity) []FieldChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"primaryEmail", oldIdentity.Email, newIdentity.Email},
+		{"displayName", oldIdentity.DisplayName, newIdentity.DisplayName},
+		{"peopleId", strconv.Itoa(oldIdentity.PeopleID), strconv.Itoa(newIdentity.PeopleID)},
+		{"managementType", oldIdentity.ManagementType, newIdentity.ManagementType},
+		{"employeeType", oldIdentity.EmployeeType, newIdentity.EmployeeType},
+		{"employeeStatus", oldIdentity.EmployeeStatus, newIdentity.EmployeeStatus},
+		{"secondaryEmails", joinSorted(oldIdentity.SecondaryEmails), joinSorted(newIdentity.SecondaryEmails)},
+		{"mergedPeople", mergedPeopleIDs(oldIdentity), mergedPeopleIDs(newIdentity)},
+	}
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, FieldChange{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	return changes
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ";")
+}
+
+func mergedPeopleIDs(identity admina.Identity) string {
+	ids := make([]string, 0, len(identity.MergedPeople))
+	for _, merged := range identity.MergedPeople {
+		ids = append(ids, strconv.Itoa(merged.ID))
+	}
+	return joinSorted(ids)
+}
+
+// diffMatrix は両スナップショットのマトリックスを共通の行・列に揃えて差分を求めます
+// 行・列は両スナップショットを合わせたアイデンティティから identity matrix と同じ順序で決めます
+func diffMatrix(oldIdentities, newIdentities []admina.Identity) *MatrixDelta {
+	// デフォルトの集計条件のため、エラーになることはない
+	options, _ := (&MatrixOptions{}).withDefaults()
+	combined, _ := createMatrix(append(append([]admina.Identity{}, oldIdentities...), newIdentities...), options)
+
+	delta := &MatrixDelta{
+		Old: countMatrix(oldIdentities, options, combined.Rows, combined.Columns),
+		New: countMatrix(newIdentities, options, combined.Rows, combined.Columns),
+	}
+	delta.Delta = make([][]int, len(combined.Rows))
+	for i := range delta.Delta {
+		delta.Delta[i] = make([]int, len(combined.Columns))
+		for j := range delta.Delta[i] {
+			delta.Delta[i][j] = delta.New.Matrix[i][j] - delta.Old.Matrix[i][j]
+		}
+	}
+	return delta
+}
+
+// maskFieldChange はメールアドレスを含むフィールドの値をマスクします
+func maskFieldChange(change FieldChange) FieldChange {
+	switch change.Field {
+	case "primaryEmail":
+		change.Old = MaskEmail(change.Old)
+		change.New = MaskEmail(change.New)
+	case "secondaryEmails":
+		change.Old = maskEmailList(change.Old)
+		change.New = maskEmailList(change.New)
+	}
+	return change
+}
+
+func maskEmailList(joined string) string {
+	if joined == "" {
+		return ""
+	}
+	emails := strings.Split(joined, ";")
+	for i := range emails {
+		emails[i] = MaskEmail(emails[i])
+	}
+	return strings.Join(emails, ";")
+}
+
+func maskIdentity(identity admina.Identity) admina.Identity {
+	identity.Email = MaskEmail(identity.Email)
+	secondaryEmails := make([]string, len(identity.SecondaryEmails))
+	for i, email := range identity.SecondaryEmails {
+		secondaryEmails[i] = MaskEmail(email)
+	}
+	identity.SecondaryEmails = secondaryEmails
+	return identity
+}
+
+func formatDelta(value int) string {
+	if value > 0 {
+		return fmt.Sprintf("+%d", value)
+	}
+	return strconv.Itoa(value)
+}
+
+// JSONDiffFormatter の実装
+type JSONDiffFormatter struct{}
+
+func (f *JSONDiffFormatter) Format(diff *IdentityDiff) (string, error) {
+	masked := *diff
+	masked.Added = make([]admina.Identity, len(diff.Added))
+	for i, identity := range diff.Added {
+		masked.Added[i] = maskIdentity(identity)
+	}
+	masked.Removed = make([]admina.Identity, len(diff.Removed))
+	for i, identity := range diff.Removed {
+		masked.Removed[i] = maskIdentity(identity)
+	}
+	masked.Merged = make([]IdentityMerge, len(diff.Merged))
+	for i, merge := range diff.Merged {
+		masked.Merged[i] = IdentityMerge{Identity: maskIdentity(merge.Identity), Into: maskIdentity(merge.Into)}
+	}
+	masked.Changed = make([]IdentityChange, len(diff.Changed))
+	for i, change := range diff.Changed {
+		changes := make([]FieldChange, len(change.Changes))
+		for j, fieldChange := range change.Changes {
+			changes[j] = maskFieldChange(fieldChange)
+		}
+		masked.Changed[i] = IdentityChange{Old: maskIdentity(change.Old), New: maskIdentity(change.New), Changes: changes}
+	}
+
+	jsonData, err := json.MarshalIndent(masked, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// MarkdownDiffFormatter の実装
+type MarkdownDiffFormatter struct{}
+
+func (f *MarkdownDiffFormatter) Format(diff *IdentityDiff) (string, error) {
+	var output strings.Builder
+	output.WriteString("# Identity Diff\n\n")
+	output.WriteString(fmt.Sprintf("- Old: %s (%d identities)\n", diff.Old.FetchedAt.Format("2006-01-02 15:04:05"), diff.Old.Count))
+	output.WriteString(fmt.Sprintf("- New: %s (%d identities)\n\n", diff.New.FetchedAt.Format("2006-01-02 15:04:05"), diff.New.Count))
+
+	output.WriteString("## Summary\n\n")
+	output.WriteString("| Added | Removed | Merged | Changed |\n")
+	output.WriteString("|-------|---------|--------|---------|\n")
+	output.WriteString(fmt.Sprintf("| %d | %d | %d | %d |\n\n", len(diff.Added), len(diff.Removed), len(diff.Merged), len(diff.Changed)))
+
+	writeIdentityTable := func(title string, identities []admina.Identity) {
+		output.WriteString(fmt.Sprintf("## %s\n\n", title))
+		if len(identities) == 0 {
+			output.WriteString("None.\n\n")
+			return
+		}
+		output.WriteString("| ID | Email | Management Type | Employee Status |\n")
+		output.WriteString("|----|-------|-----------------|-----------------|\n")
+		for _, identity := range identities {
+			output.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				identity.ID, MaskEmail(identity.Email), identity.ManagementType, identity.EmployeeStatus))
+		}
+		output.WriteString("\n")
+	}
+	writeIdentityTable("Added", diff.Added)
+	writeIdentityTable("Removed", diff.Removed)
+
+	output.WriteString("## Merged\n\n")
+	if len(diff.Merged) == 0 {
+		output.WriteString("None.\n\n")
+	} else {
+		output.WriteString("| ID | Email | Merged Into |\n")
+		output.WriteString("|----|-------|-------------|\n")
+		for _, merge := range diff.Merged {
+			output.WriteString(fmt.Sprintf("| %s | %s | %s |\n",
+				merge.Identity.ID, MaskEmail(merge.Identity.Email), MaskEmail(merge.Into.Email)))
+		}
+		output.WriteString("\n")
+	}
+
+	output.WriteString("## Changed\n\n")
+	if len(diff.Changed) == 0 {
+		output.WriteString("None.\n\n")
+	} else {
+		output.WriteString("| ID | Email | Field | Old | New |\n")
+		output.WriteString("|----|-------|-------|-----|-----|\n")
+		for _, change := range diff.Changed {
+			for _, fieldChange := range change.Changes {
+				fieldChange = maskFieldChange(fieldChange)
+				output.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+					change.New.ID, MaskEmail(change.New.Email), fieldChange.Field, fieldChange.Old, fieldChange.New))
+			}
+		}
+		output.WriteString("\n")
+	}
+
+	output.WriteString("## Matrix Delta\n\n")
+	matrix := diff.Matrix
+	if len(matrix.Old.Rows) == 0 {
+		output.WriteString("No data available.\n")
+		return output.String(), nil
+	}
+	output.WriteString("| Type |")
+	for _, column := range matrix.Old.Columns {
+		output.WriteString(fmt.Sprintf(" %s |", column))
+	}
+	output.WriteString("\n|------|")
+	for range matrix.Old.Columns {
+		output.WriteString("------|")
+	}
+	output.WriteString("\n")
+	for i, row := range matrix.Old.Rows {
+		output.WriteString(fmt.Sprintf("| %s |", row))
+		for j := range matrix.Old.Columns {
+			output.WriteString(fmt.Sprintf(" %d → %d (%s) |", matrix.Old.Matrix[i][j], matrix.New.Matrix[i][j], formatDelta(matrix.Delta[i][j])))
+		}
+		output.WriteString("\n")
+	}
+
+	return output.String(), nil
+}
+
+// PrettyDiffFormatter の実装
+type PrettyDiffFormatter struct{}
+
+func (f *PrettyDiffFormatter) Format(diff *IdentityDiff) (string, error) {
+	var output strings.Builder
+	output.WriteString("=== Identity Diff ===\n")
+	output.WriteString(fmt.Sprintf("Old: %s (%d identities)\n", diff.Old.FetchedAt.Format("2006-01-02 15:04:05"), diff.Old.Count))
+	output.WriteString(fmt.Sprintf("New: %s (%d identities)\n\n", diff.New.FetchedAt.Format("2006-01-02 15:04:05"), diff.New.Count))
+
+	output.WriteString(fmt.Sprintf("Added: %d\n", len(diff.Added)))
+	for _, identity := range diff.Added {
+		output.WriteString(fmt.Sprintf("  + %s (%s, %s)\n", MaskEmail(identity.Email), identity.ManagementType, identity.EmployeeStatus))
+	}
+	output.WriteString(fmt.Sprintf("Removed: %d\n", len(diff.Removed)))
+	for _, identity := range diff.Removed {
+		output.WriteString(fmt.Sprintf("  - %s (%s, %s)\n", MaskEmail(identity.Email), identity.ManagementType, identity.EmployeeStatus))
+	}
+	output.WriteString(fmt.Sprintf("Merged: %d\n", len(diff.Merged)))
+	for _, merge := range diff.Merged {
+		output.WriteString(fmt.Sprintf("  > %s -> %s\n", MaskEmail(merge.Identity.Email), MaskEmail(merge.Into.Email)))
+	}
+	output.WriteString(fmt.Sprintf("Changed: %d\n", len(diff.Changed)))
+	for _, change := range diff.Changed {
+		output.WriteString(fmt.Sprintf("  * %s\n", MaskEmail(change.New.Email)))
+		for _, fieldChange := range change.Changes {
+			fieldChange = maskFieldChange(fieldChange)
+			output.WriteString(fmt.Sprintf("      %-16s %s -> %s\n", fieldChange.Field, fieldChange.Old, fieldChange.New))
+		}
+	}
+
+	output.WriteString("\nMatrix Delta:\n")
+	output.WriteString(fmt.Sprintf("%-20s", "Type"))
+	for _, column := range diff.Matrix.Old.Columns {
+		output.WriteString(fmt.Sprintf("%-15s", column))
+	}
+	output.WriteString("\n")
+	output.WriteString(strings.Repeat("-", 20+15*len(diff.Matrix.Old.Columns)) + "\n")
+	for i, row := range diff.Matrix.Old.Rows {
+		output.WriteString(fmt.Sprintf("%-20s", row))
+		for j := range diff.Matrix.Old.Columns {
+			output.WriteString(fmt.Sprintf("%-15s", formatDelta(diff.Matrix.Delta[i][j])))
+		}
+		output.WriteString("\n")
+	}
+
+	return output.String(), nil
+}
+
+// CSVDiffFormatter の実装
+// 1行に1つの変更を出力します（追加・削除・統合はフィールドを空にします）
+type CSVDiffFormatter struct{}
+
+func (f *CSVDiffFormatter) Format(diff *IdentityDiff) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	rows := [][]string{{"Change", "IdentityID", "Email", "Field", "Old", "New"}}
+	for _, identity := range diff.Added {
+		rows = append(rows, []string{"added", identity.ID, MaskEmail(identity.Email), "", "", ""})
+	}
+	for _, identity := range diff.Removed {
+		rows = append(rows, []string{"removed", identity.ID, MaskEmail(identity.Email), "", "", ""})
+	}
+	for _, merge := range diff.Merged {
+		rows = append(rows, []string{"merged", merge.Identity.ID, MaskEmail(merge.Identity.Email), "mergedInto", "", MaskEmail(merge.Into.Email)})
+	}
+	for _, change := range diff.Changed {
+		for _, fieldChange := range change.Changes {
+			fieldChange = maskFieldChange(fieldChange)
+			rows = append(rows, []string{"changed", change.New.ID, MaskEmail(change.New.Email), fieldChange.Field, fieldChange.Old, fieldChange.New})
+		}
+	}
+	for i, row := range diff.Matrix.Old.Rows {
+		for j, column := range diff.Matrix.Old.Columns {
+			if diff.Matrix.Delta[i][j] == 0 {
+				continue
+			}
+			rows = append(rows, []string{"matrix", "", "", row + "/" + column,
+				strconv.Itoa(diff.Matrix.Old.Matrix[i][j]), strconv.Itoa(diff.Matrix.New.Matrix[i][j])})
+		}
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return "", fmt.Errorf("failed to write csv: %v", err)
+	}
+	return buf.String(), nil
+}
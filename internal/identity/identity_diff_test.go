@@ -0,0 +1,127 @@
+package identity_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiffSnapshots() (*identity.Snapshot, *identity.Snapshot) {
+	oldSnapshot := &identity.Snapshot{
+		SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), Count: 4},
+		Identities: []admina.Identity{
+			{ID: "100", PeopleID: 101, ManagementType: "managed", EmployeeStatus: "active", Email: "user1@parent.domain.com"},
+			{ID: "200", PeopleID: 202, ManagementType: "external", EmployeeStatus: "active", Email: "user1@child.domain.com"},
+			{ID: "300", PeopleID: 303, ManagementType: "external", EmployeeStatus: "active", Email: "leaver@child.domain.com"},
+			{ID: "400", PeopleID: 404, ManagementType: "managed", EmployeeStatus: "active", Email: "user4@parent.domain.com"},
+		},
+	}
+
+	newSnapshot := &identity.Snapshot{
+		SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), Count: 3},
+		Identities: []admina.Identity{
+			{ID: "100", PeopleID: 101, ManagementType: "managed", EmployeeStatus: "active", Email: "user1@parent.domain.com",
+				SecondaryEmails: []string{"user1@child.domain.com"}},
+			{ID: "400", PeopleID: 404, ManagementType: "managed", EmployeeStatus: "retired", Email: "user4@parent.domain.com"},
+			{ID: "500", PeopleID: 505, ManagementType: "managed", EmployeeStatus: "active", Email: "newcomer@parent.domain.com"},
+		},
+	}
+	return oldSnapshot, newSnapshot
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	oldSnapshot, newSnapshot := newDiffSnapshots()
+
+	diff := identity.DiffSnapshots(oldSnapshot, newSnapshot)
+
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "500", diff.Added[0].ID)
+
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, "300", diff.Removed[0].ID)
+
+	require.Len(t, diff.Merged, 1)
+	assert.Equal(t, "200", diff.Merged[0].Identity.ID)
+	assert.Equal(t, "100", diff.Merged[0].Into.ID)
+
+	require.Len(t, diff.Changed, 2)
+	changesByID := map[string][]identity.FieldChange{}
+	for _, change := range diff.Changed {
+		changesByID[change.New.ID] = change.Changes
+	}
+	assert.Equal(t, []identity.FieldChange{{Field: "secondaryEmails", Old: "", New: "user1@child.domain.com"}}, changesByID["100"])
+	assert.Equal(t, []identity.FieldChange{{Field: "employeeStatus", Old: "active", New: "retired"}}, changesByID["400"])
+
+	// 行・列は identity matrix と同じく名前順に並ぶ
+	assert.Equal(t, []string{"external", "managed"}, diff.Matrix.Old.Rows)
+	assert.Equal(t, []string{"active", "retired"}, diff.Matrix.Old.Columns)
+	assert.Equal(t, diff.Matrix.Old.Rows, diff.Matrix.New.Rows)
+	assert.Equal(t, [][]int{{-2, 0}, {0, 1}}, diff.Matrix.Delta)
+	assert.Equal(t, -1, diff.Matrix.New.GrandTotal-diff.Matrix.Old.GrandTotal)
+}
+
+func TestPrintSnapshotDiff(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(false)
+
+	dir := t.TempDir()
+	oldSnapshot, newSnapshot := newDiffSnapshots()
+	oldPath := filepath.Join(dir, "old.jsonl")
+	newPath := filepath.Join(dir, "new.jsonl")
+	require.NoError(t, identity.WriteSnapshotFile(oldPath, oldSnapshot))
+	require.NoError(t, identity.WriteSnapshotFile(newPath, newSnapshot))
+
+	formats := []string{"json", "markdown", "pretty", "csv"}
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			assert.NoError(t, identity.PrintSnapshotDiff(oldPath, newPath, format))
+		})
+	}
+
+	err := identity.PrintSnapshotDiff(oldPath, newPath, "invalid")
+	assert.ErrorContains(t, err, "unknown output format: invalid")
+}
+
+func TestCSVDiffFormatter(t *testing.T) {
+	identity.SetNoMask(false)
+	oldSnapshot, newSnapshot := newDiffSnapshots()
+
+	output, err := (&identity.CSVDiffFormatter{}).Format(identity.DiffSnapshots(oldSnapshot, newSnapshot))
+	require.NoError(t, err)
+	assert.Contains(t, output, "Change,IdentityID,Email,Field,Old,New\n")
+	assert.Contains(t, output, "added,500,new*****@parent.domain.com,,,\n")
+	assert.Contains(t, output, "merged,200,use**@child.domain.com,mergedInto,,use**@parent.domain.com\n")
+	assert.Contains(t, output, "changed,400,use**@parent.domain.com,employeeStatus,active,retired\n")
+	assert.Contains(t, output, "matrix,,,external/active,2,0\n")
+}
+
+func TestCSVDiffFormatterNoMask(t *testing.T) {
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+	oldSnapshot, newSnapshot := newDiffSnapshots()
+
+	output, err := (&identity.CSVDiffFormatter{}).Format(identity.DiffSnapshots(oldSnapshot, newSnapshot))
+	require.NoError(t, err)
+	assert.Contains(t, output, "added,500,newcomer@parent.domain.com,,,\n")
+	assert.Contains(t, output, "merged,200,user1@child.domain.com,mergedInto,,user1@parent.domain.com\n")
+}
+
+func TestExportSnapshot(t *testing.T) {
+	logger.Init()
+
+	path := filepath.Join(t.TempDir(), "export", "identities.jsonl")
+	_, err := identity.ExportSnapshot(&mock.Client{Identities: testIdentities}, "123", path)
+	require.NoError(t, err)
+
+	snapshot, err := identity.ReadSnapshotFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "123", snapshot.OrganizationID)
+	assert.Equal(t, testIdentities, snapshot.Identities)
+}
@@ -0,0 +1,494 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// 重複の判定に使う手がかり
+const (
+	// SignalEmail はプライマリメールアドレスが大文字小文字を除いて一致することを表します
+	SignalEmail = "email"
+	// SignalNormalizedEmail はローカルパートの . と +以降を除くと同じドメインで一致することを表します
+	SignalNormalizedEmail = "normalized-email"
+	// SignalSecondaryEmail は一方のメールアドレスが他方のセカンダリーメールに含まれることを表します
+	SignalSecondaryEmail = "secondary-email"
+	// SignalDisplayName は正規化した表示名が一致することを表します
+	SignalDisplayName = "display-name"
+)
+
+// DuplicateSignalWeights は手がかりごとの確からしさです
+// 同じペアに複数の手がかりがある場合は 1 - Π(1 - weight) で組み合わせます
+var DuplicateSignalWeights = map[string]float64{
+	SignalEmail:           0.95,
+	SignalNormalizedEmail: 0.85,
+	SignalSecondaryEmail:  0.8,
+	SignalDisplayName:     0.5,
+}
+
+// maxDuplicateGroupSize を超える件数が同じキーを共有する場合、そのキーは手がかりとして使いません
+// 共通の表示名やアドレスで組の数が件数の2乗で増え、同一人物の手がかりにもならないためです
+const maxDuplicateGroupSize = 20
+
+// minDisplayNameKeyLength より短い正規化した表示名は別人でも一致しやすいため手がかりとして使いません
+const minDisplayNameKeyLength = 2
+
+// duplicateSignalOrder は出力する手がかりの並び順です
+var duplicateSignalOrder = []string{SignalEmail, SignalNormalizedEmail, SignalSecondaryEmail, SignalDisplayName}
+
+// DuplicateOptions は duplicates コマンドのオプションです
+type DuplicateOptions struct {
+	// Where に一致するアイデンティティのみを対象とします
+	Where *Where
+	// MinConfidence より確からしさの低いクラスタは出力しません
+	MinConfidence float64
+}
+
+// DuplicateLink は同一人物と思われる2つのアイデンティティの組です
+type DuplicateLink struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Signals []string `json:"signals"`
+	Score   float64  `json:"score"`
+}
+
+// DuplicateCluster は同一人物と思われるアイデンティティのまとまりです
+// Confidence はクラスタをつなぐのに必要な組のうち、最も弱い組のスコアです
+type DuplicateCluster struct {
+	ID         int               `json:"id"`
+	Confidence float64           `json:"confidence"`
+	Signals    []string          `json:"signals"`
+	Identities []admina.Identity `json:"identities"`
+	Links      []DuplicateLink   `json:"links"`
+}
+
+// DuplicateReport は duplicates コマンドの結果です
+type DuplicateReport struct {
+	TotalIdentities int                `json:"totalIdentities"`
+	Clusters        []DuplicateCluster `json:"clusters"`
+}
+
+// DuplicateFormatter は重複レポートのフォーマット方法を定義するインターフェース
+type DuplicateFormatter interface {
+	Format(report *DuplicateReport) (string, error)
+}
+
+// PrintDuplicates は重複していると思われるアイデンティティのクラスタを出力します
+func PrintDuplicates(client Client, options *DuplicateOptions, outputFormat string, ctx *FormatContext) error {
+	formatter, err := DuplicateFormats.New(outputFormat, ctx)
+	if err != nil {
+		return err
+	}
+
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return err
+	}
+	if options.Where != nil {
+		identities = FilterIdentities(identities, options.Where)
+	}
+
+	report := FindDuplicates(identities, options)
+	output, err := formatter.Format(report)
+	if err != nil {
+		return fmt.Errorf("failed to format duplicates: %v", err)
+	}
+
+	logger.LogInfo("Found %d duplicate clusters in %d identities", len(report.Clusters), report.TotalIdentities)
+	logger.Print("%s", output)
+	return nil
+}
+
+// FindDuplicates は手がかりを共有するアイデンティティを union-find でクラスタにまとめます
+// クラスタは確からしさの高い順、同じ場合は件数の多い順に並びます
+func FindDuplicates(identities []admina.Identity, options *DuplicateOptions) *DuplicateReport {
+	pairs := collectDuplicatePairs(identities)
+
+	// スコアの高い組から順に併合し、併合に使った組の最小スコアをクラスタの確からしさとする
+	links := make([]DuplicateLink, 0, len(pairs))
+	for pair, signals := range pairs {
+		links = append(links, DuplicateLink{
+			From:    identities[pair[0]].ID,
+			To:      identities[pair[1]].ID,
+			Signals: orderedSignals(signals),
+			Score:   combineSignals(signals),
+		})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Score != links[j].Score {
+			return links[i].Score > links[j].Score
+		}
+		if links[i].From != links[j].From {
+			return links[i].From < links[j].From
+		}
+		return links[i].To < links[j].To
+	})
+
+	index := make(map[string]int, len(identities))
+	for i, identity := range identities {
+		index[identity.ID] = i
+	}
+	uf := newUnionFind(len(identities))
+	confidence := make(map[int]float64)
+	for _, link := range links {
+		a, b := uf.find(index[link.From]), uf.find(index[link.To])
+		if a == b {
+			continue
+		}
+		score := link.Score
+		for _, root := range []int{a, b} {
+			if c, ok := confidence[root]; ok && c < score {
+				score = c
+			}
+		}
+		delete(confidence, a)
+		delete(confidence, b)
+		confidence[uf.union(a, b)] = score
+	}
+
+	clusters := make(map[int]*DuplicateCluster)
+	for i, identity := range identities {
+		root := uf.find(i)
+		if _, ok := confidence[root]; !ok {
+			continue
+		}
+		if clusters[root] == nil {
+			clusters[root] = &DuplicateCluster{Confidence: roundScore(confidence[root])}
+		}
+		clusters[root].Identities = append(clusters[root].Identities, identity)
+	}
+	for _, link := range links {
+		cluster := clusters[uf.find(index[link.From])]
+		cluster.Links = append(cluster.Links, link)
+	}
+
+	report := &DuplicateReport{TotalIdentities: len(identities), Clusters: []DuplicateCluster{}}
+	for _, cluster := range clusters {
+		if cluster.Confidence < options.MinConfidence {
+			continue
+		}
+		signals := make(map[string]bool)
+		for _, link := range cluster.Links {
+			for _, signal := range link.Signals {
+				signals[signal] = true
+			}
+		}
+		cluster.Signals = orderedSignals(signals)
+		report.Clusters = append(report.Clusters, *cluster)
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		a, b := report.Clusters[i], report.Clusters[j]
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if len(a.Identities) != len(b.Identities) {
+			return len(a.Identities) > len(b.Identities)
+		}
+		return strings.ToLower(a.Identities[0].Email) < strings.ToLower(b.Identities[0].Email)
+	})
+	for i := range report.Clusters {
+		report.Clusters[i].ID = i + 1
+	}
+	return report
+}
+
+// collectDuplicatePairs は手がかりごとに同じキーを持つアイデンティティの組を集めます
+func collectDuplicatePairs(identities []admina.Identity) map[[2]int]map[string]bool {
+	groups := make(map[string]map[string][]int)
+	add := func(signal, key string, i int) {
+		if key == "" {
+			return
+		}
+		if groups[signal] == nil {
+			groups[signal] = make(map[string][]int)
+		}
+		members := groups[signal][key]
+		if len(members) > 0 && members[len(members)-1] == i {
+			return
+		}
+		groups[signal][key] = append(members, i)
+	}
+
+	for i, identity := range identities {
+		add(SignalEmail, strings.ToLower(strings.TrimSpace(identity.Email)), i)
+		add(SignalNormalizedEmail, NormalizeEmail(identity.Email), i)
+		if name := NormalizeDisplayName(identity.DisplayName); utf8.RuneCountInString(name) >= minDisplayNameKeyLength {
+			add(SignalDisplayName, name, i)
+		}
+		// セカンダリーメールはプライマリメールと同じキーの空間で突き合わせる
+		add(SignalSecondaryEmail, strings.ToLower(strings.TrimSpace(identity.Email)), i)
+		for _, email := range identity.SecondaryEmails {
+			add(SignalSecondaryEmail, strings.ToLower(strings.TrimSpace(email)), i)
+		}
+	}
+
+	pairs := make(map[[2]int]map[string]bool)
+	for signal, keys := range groups {
+		for _, members := range keys {
+			if len(members) > maxDuplicateGroupSize {
+				logger.LogWarning("Ignoring %s signal shared by %d identities", signal, len(members))
+				continue
+			}
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					pair := [2]int{members[x], members[y]}
+					if pair[0] > pair[1] {
+						pair[0], pair[1] = pair[1], pair[0]
+					}
+					if pairs[pair] == nil {
+						pairs[pair] = make(map[string]bool)
+					}
+					pairs[pair][signal] = true
+				}
+			}
+		}
+	}
+
+	for pair, signals := range pairs {
+		// プライマリメール同士の一致は正規化・セカンダリーの一致を含むため重ねて数えない
+		if signals[SignalEmail] {
+			delete(signals, SignalNormalizedEmail)
+			delete(signals, SignalSecondaryEmail)
+		}
+		if signals[SignalSecondaryEmail] && !hasSecondaryMatch(identities[pair[0]], identities[pair[1]]) {
+			delete(signals, SignalSecondaryEmail)
+		}
+		if len(signals) == 0 {
+			delete(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// hasSecondaryMatch は一方のメールアドレスが他方のセカンダリーメールに含まれるかを返します
+func hasSecondaryMatch(a, b admina.Identity) bool {
+	for _, email := range a.SecondaryEmails {
+		if hasEmail(b, email) {
+			return true
+		}
+	}
+	for _, email := range b.SecondaryEmails {
+		if hasEmail(a, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEmail はメールアドレスを小文字にし、ローカルパートの . と + 以降を除きます
+// taro.yamada+test@example.com と TaroYamada@example.com は同じ値になります
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return ""
+	}
+	localPart, domain := email[:at], email[at+1:]
+	if plus := strings.Index(localPart, "+"); plus >= 0 {
+		localPart = localPart[:plus]
+	}
+	localPart = strings.ReplaceAll(localPart, ".", "")
+	if localPart == "" {
+		return ""
+	}
+	return localPart + "@" + domain
+}
+
+// NormalizeDisplayName は表示名の全角・半角の違い、大文字小文字、空白、かなとローマ字の違い、
+// 姓名の順序を除いた値を返します。正規化の詳細は NameSimilarity を参照してください
+func NormalizeDisplayName(name string) string {
+	tokens := nameTokens(name)
+	sort.Strings(tokens)
+	return strings.Join(tokens, "")
+}
+
+// combineSignals は組の手がかりから 0〜1 のスコアを求めます
+func combineSignals(signals map[string]bool) float64 {
+	remaining := 1.0
+	for signal := range signals {
+		remaining *= 1 - DuplicateSignalWeights[signal]
+	}
+	return 1 - remaining
+}
+
+// roundScore はスコアを小数点以下2桁に丸めます
+func roundScore(score float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(score, 'f', 2, 64), 64)
+	return rounded
+}
+
+// orderedSignals は手がかりを duplicateSignalOrder の順に並べます
+func orderedSignals(signals map[string]bool) []string {
+	ordered := make([]string, 0, len(signals))
+	for _, signal := range duplicateSignalOrder {
+		if signals[signal] {
+			ordered = append(ordered, signal)
+		}
+	}
+	return ordered
+}
+
+// unionFind はクラスタリングに使う素集合データ構造です
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &unionFind{parent: parent}
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+// union は2つの集合を併合し、新しい代表を返します
+func (u *unionFind) union(a, b int) int {
+	a, b = u.find(a), u.find(b)
+	if a > b {
+		a, b = b, a
+	}
+	u.parent[b] = a
+	return a
+}
+
+// maskedIdentities はメールアドレスをマスクしたコピーを返します
+func maskedIdentities(identities []admina.Identity) []admina.Identity {
+	masked := make([]admina.Identity, len(identities))
+	for i, identity := range identities {
+		identity.Email = MaskEmail(identity.Email)
+		if len(identity.SecondaryEmails) > 0 {
+			secondaryEmails := make([]string, len(identity.SecondaryEmails))
+			for j, email := range identity.SecondaryEmails {
+				secondaryEmails[j] = MaskEmail(email)
+			}
+			identity.SecondaryEmails = secondaryEmails
+		}
+		masked[i] = identity
+	}
+	return masked
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', 2, 64)
+}
+
+// JSONDuplicateFormatter の実装
+type JSONDuplicateFormatter struct{}
+
+func (f *JSONDuplicateFormatter) Format(report *DuplicateReport) (string, error) {
+	masked := *report
+	masked.Clusters = make([]DuplicateCluster, len(report.Clusters))
+	for i, cluster := range report.Clusters {
+		cluster.Identities = maskedIdentities(cluster.Identities)
+		masked.Clusters[i] = cluster
+	}
+	output, err := json.MarshalIndent(masked, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal duplicates: %v", err)
+	}
+	return string(output) + "\n", nil
+}
+
+// MarkdownDuplicateFormatter の実装
+type MarkdownDuplicateFormatter struct{}
+
+func (f *MarkdownDuplicateFormatter) Format(report *DuplicateReport) (string, error) {
+	var output strings.Builder
+	output.WriteString("# Duplicate Identities\n\n")
+	output.WriteString(fmt.Sprintf("Scanned identities: %d, clusters: %d\n\n", report.TotalIdentities, len(report.Clusters)))
+	for _, cluster := range report.Clusters {
+		output.WriteString(fmt.Sprintf("## Cluster %d (confidence %s)\n\n", cluster.ID, formatScore(cluster.Confidence)))
+		output.WriteString(fmt.Sprintf("Signals: %s\n\n", strings.Join(cluster.Signals, ", ")))
+		output.WriteString("| ID | People ID | Email | Display Name | Management Type | Employee Status |\n")
+		output.WriteString("|----|-----------|-------|--------------|-----------------|-----------------|\n")
+		for _, identity := range cluster.Identities {
+			output.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				identity.ID, peopleIDValue(identity), MaskEmail(identity.Email), identity.DisplayName, identity.ManagementType, identity.EmployeeStatus))
+		}
+		output.WriteString("\n")
+	}
+	return output.String(), nil
+}
+
+// PrettyDuplicateFormatter の実装
+type PrettyDuplicateFormatter struct{}
+
+func (f *PrettyDuplicateFormatter) Format(report *DuplicateReport) (string, error) {
+	var output strings.Builder
+	output.WriteString("=== Duplicate Identities ===\n\n")
+	output.WriteString(fmt.Sprintf("Scanned identities: %d\n", report.TotalIdentities))
+	output.WriteString(fmt.Sprintf("Clusters: %d\n", len(report.Clusters)))
+	for _, cluster := range report.Clusters {
+		output.WriteString(fmt.Sprintf("\nCluster %d (confidence %s, signals: %s)\n", cluster.ID, formatScore(cluster.Confidence), strings.Join(cluster.Signals, ", ")))
+		for _, identity := range cluster.Identities {
+			output.WriteString(fmt.Sprintf("  - %s %s (%s, %s, %s)\n",
+				identity.ID, MaskEmail(identity.Email), identity.DisplayName, identity.ManagementType, identity.EmployeeStatus))
+		}
+	}
+	return output.String(), nil
+}
+
+// CSVDuplicateFormatter の実装
+// アイデンティティごとに1行を出力します
+type CSVDuplicateFormatter struct{}
+
+func (f *CSVDuplicateFormatter) Format(report *DuplicateReport) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	rows := [][]string{{"ClusterID", "Confidence", "Signals", "IdentityID", "PeopleID", "Email", "DisplayName", "ManagementType", "EmployeeStatus"}}
+	for _, cluster := range report.Clusters {
+		for _, identity := range cluster.Identities {
+			rows = append(rows, []string{
+				strconv.Itoa(cluster.ID),
+				formatScore(cluster.Confidence),
+				strings.Join(cluster.Signals, ";"),
+				identity.ID,
+				peopleIDValue(identity),
+				MaskEmail(identity.Email),
+				identity.DisplayName,
+				identity.ManagementType,
+				identity.EmployeeStatus,
+			})
+		}
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return "", fmt.Errorf("failed to write csv: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// HTMLDuplicateFormatter の実装
+// クラスタごとの表を単一の HTML ファイルにします
+type HTMLDuplicateFormatter struct {
+	Organization *admina.Organization
+}
+
+func (f *HTMLDuplicateFormatter) Format(report *DuplicateReport) (string, error) {
+	data := struct {
+		htmlPage
+		*DuplicateReport
+	}{
+		htmlPage:        newHTMLPage("Duplicate Identities", f.Organization),
+		DuplicateReport: report,
+	}
+	return executeHTML("duplicates", data)
+}
@@ -0,0 +1,159 @@
+package identity_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var duplicateTestIdentities = []admina.Identity{
+	{ID: "1", PeopleID: 11, DisplayName: "Hanako Suzuki", ManagementType: "managed", Email: "Hanako@Example.com"},
+	{ID: "2", PeopleID: 12, DisplayName: "H. Suzuki", ManagementType: "external", Email: "hanako@example.com"},
+	{ID: "3", PeopleID: 13, DisplayName: "Taro Yamada", ManagementType: "managed", Email: "taro.yamada+work@example.com"},
+	{ID: "4", PeopleID: 14, DisplayName: "T. Yamada", ManagementType: "external", Email: "taroyamada@example.com"},
+	{ID: "5", PeopleID: 15, DisplayName: "Jiro Sato", ManagementType: "managed", Email: "jiro@a.example.com", SecondaryEmails: []string{"jiro@b.example.com"}},
+	{ID: "6", PeopleID: 16, DisplayName: "J. Sato", ManagementType: "external", Email: "jiro@b.example.com"},
+	{ID: "7", PeopleID: 17, DisplayName: "J.　SATO", ManagementType: "external", Email: "sato@c.example.com"},
+	{ID: "8", PeopleID: 18, DisplayName: "山田 花子", ManagementType: "managed", Email: "yamada@d.example.com"},
+	{ID: "9", PeopleID: 19, DisplayName: "山田　花子", ManagementType: "external", Email: "hanako.y@e.example.com"},
+	{ID: "10", PeopleID: 20, DisplayName: "Saburo Ito", ManagementType: "managed", Email: "saburo@example.com"},
+}
+
+func clusterIDs(cluster identity.DuplicateCluster) []string {
+	ids := make([]string, 0, len(cluster.Identities))
+	for _, i := range cluster.Identities {
+		ids = append(ids, i.ID)
+	}
+	return ids
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "taroyamada@example.com", identity.NormalizeEmail(" Taro.Yamada+test@Example.com "))
+	assert.Equal(t, "taroyamada@example.com", identity.NormalizeEmail("taroyamada@example.com"))
+	assert.Equal(t, "", identity.NormalizeEmail("not-an-email"))
+	assert.Equal(t, "", identity.NormalizeEmail("+tag@example.com"))
+}
+
+func TestNormalizeDisplayName(t *testing.T) {
+	assert.Equal(t, "taroyamada", identity.NormalizeDisplayName("ＴＡＲＯ　Ｙａｍａｄａ"))
+	assert.Equal(t, "山田花子", identity.NormalizeDisplayName(" 山田　花子 "))
+	assert.Equal(t, identity.NormalizeDisplayName("ﾔﾏﾀﾞ ﾀﾛｳ"), identity.NormalizeDisplayName("ヤマダ タロウ"))
+}
+
+func TestFindDuplicates(t *testing.T) {
+	report := identity.FindDuplicates(duplicateTestIdentities, &identity.DuplicateOptions{})
+	assert.Equal(t, 10, report.TotalIdentities)
+	require.Len(t, report.Clusters, 4)
+
+	t.Run("大文字小文字のみ異なるメールアドレス", func(t *testing.T) {
+		cluster := report.Clusters[0]
+		assert.Equal(t, 1, cluster.ID)
+		assert.Equal(t, []string{"1", "2"}, clusterIDs(cluster))
+		assert.Equal(t, 0.95, cluster.Confidence)
+		// email の一致では normalized-email を重ねて数えない
+		assert.Equal(t, []string{identity.SignalEmail}, cluster.Signals)
+	})
+
+	t.Run(". と + 以降を除くと一致するメールアドレス", func(t *testing.T) {
+		cluster := report.Clusters[1]
+		assert.Equal(t, []string{"3", "4"}, clusterIDs(cluster))
+		assert.Equal(t, 0.85, cluster.Confidence)
+		assert.Equal(t, []string{identity.SignalNormalizedEmail}, cluster.Signals)
+	})
+
+	t.Run("手がかりの連鎖は最も弱い組を確からしさとする", func(t *testing.T) {
+		// 5 と 6 はセカンダリーメール、6 と 7 は表示名でつながる
+		cluster := report.Clusters[2]
+		assert.Equal(t, []string{"5", "6", "7"}, clusterIDs(cluster))
+		assert.Equal(t, 0.5, cluster.Confidence)
+		assert.Equal(t, []string{identity.SignalSecondaryEmail, identity.SignalDisplayName}, cluster.Signals)
+		require.Len(t, cluster.Links, 2)
+		assert.Equal(t, identity.DuplicateLink{From: "5", To: "6", Signals: []string{identity.SignalSecondaryEmail}, Score: 0.8}, cluster.Links[0])
+	})
+
+	t.Run("全角・半角の違いを除いた表示名", func(t *testing.T) {
+		cluster := report.Clusters[3]
+		assert.Equal(t, []string{"8", "9"}, clusterIDs(cluster))
+		assert.Equal(t, 0.5, cluster.Confidence)
+	})
+
+	t.Run("確からしさの低いクラスタを除外する", func(t *testing.T) {
+		report := identity.FindDuplicates(duplicateTestIdentities, &identity.DuplicateOptions{MinConfidence: 0.8})
+		require.Len(t, report.Clusters, 2)
+		assert.Equal(t, []string{"3", "4"}, clusterIDs(report.Clusters[1]))
+		assert.Equal(t, 2, report.Clusters[1].ID)
+	})
+
+	t.Run("複数の手がかりはスコアを高める", func(t *testing.T) {
+		identities := []admina.Identity{
+			{ID: "1", DisplayName: "Taro Yamada", Email: "taro.yamada@example.com"},
+			{ID: "2", DisplayName: "Taro Yamada", Email: "taroyamada@example.com"},
+		}
+		report := identity.FindDuplicates(identities, &identity.DuplicateOptions{})
+		require.Len(t, report.Clusters, 1)
+		assert.Equal(t, []string{identity.SignalNormalizedEmail, identity.SignalDisplayName}, report.Clusters[0].Signals)
+		assert.Greater(t, report.Clusters[0].Confidence, 0.85)
+	})
+
+	t.Run("多数が共有する表示名は手がかりにしない", func(t *testing.T) {
+		logger.Init()
+		identities := make([]admina.Identity, 0, 5003)
+		for i := 0; i < 5000; i++ {
+			identities = append(identities, admina.Identity{ID: strconv.Itoa(i), DisplayName: "Guest User", Email: fmt.Sprintf("guest%d@example.com", i)})
+		}
+		identities = append(identities,
+			admina.Identity{ID: "a", DisplayName: "X", Email: "x@a.example.com"},
+			admina.Identity{ID: "b", DisplayName: "x", Email: "x@b.example.com"},
+			admina.Identity{ID: "c", DisplayName: "Guest User", Email: "GUEST1@example.com"},
+		)
+		report := identity.FindDuplicates(identities, &identity.DuplicateOptions{})
+		require.Len(t, report.Clusters, 1)
+		assert.Equal(t, []string{"1", "c"}, clusterIDs(report.Clusters[0]))
+		assert.Equal(t, []string{identity.SignalEmail}, report.Clusters[0].Signals)
+	})
+
+	t.Run("重複がない場合は空のクラスタを返す", func(t *testing.T) {
+		report := identity.FindDuplicates(duplicateTestIdentities[9:], &identity.DuplicateOptions{})
+		assert.Empty(t, report.Clusters)
+		assert.NotNil(t, report.Clusters)
+	})
+}
+
+func TestDuplicateFormats(t *testing.T) {
+	report := identity.FindDuplicates(duplicateTestIdentities, &identity.DuplicateOptions{})
+	for _, format := range identity.DuplicateFormats.Formats() {
+		t.Run(format.Name, func(t *testing.T) {
+			formatter, err := identity.DuplicateFormats.New(format.Name, formatterTestContext(""))
+			require.NoError(t, err)
+
+			output, err := formatter.Format(report)
+			require.NoError(t, err)
+			assert.Contains(t, output, "Hanako Suzuki")
+			assert.Contains(t, output, "normalized-email")
+			assert.NotContains(t, output, "taroyamada@example.com")
+		})
+	}
+}
+
+func TestDuplicateFormatsNoMask(t *testing.T) {
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	report := identity.FindDuplicates(duplicateTestIdentities, &identity.DuplicateOptions{})
+	for _, format := range identity.DuplicateFormats.Formats() {
+		t.Run(format.Name, func(t *testing.T) {
+			formatter, err := identity.DuplicateFormats.New(format.Name, formatterTestContext(""))
+			require.NoError(t, err)
+
+			output, err := formatter.Format(report)
+			require.NoError(t, err)
+			assert.Contains(t, output, "taroyamada@example.com")
+		})
+	}
+}
@@ -390,7 +390,7 @@ func runE2ETestCase(t *testing.T, ctx context.Context, client *admina.Client, tt
 	writeTestLog("Created To Identity: %+v", toIdentity)
 
 	// マージ前のマトリックスを取得
-	beforeMatrix, err := identity.GetIdentityMatrix(client)
+	beforeMatrix, err := identity.GetIdentityMatrix(client, nil)
 	require.NoError(t, err, "Failed to get identity matrix before merge")
 	writeTestLog("\nBefore Merge Matrix:\n%+v", beforeMatrix)
 
@@ -412,7 +412,7 @@ func runE2ETestCase(t *testing.T, ctx context.Context, client *admina.Client, tt
 	}
 
 	// マージ後のマトリックスを取得
-	afterMatrix, err := identity.GetIdentityMatrix(client)
+	afterMatrix, err := identity.GetIdentityMatrix(client, nil)
 	require.NoError(t, err, "Failed to get identity matrix after merge")
 	writeTestLog("\nAfter Merge Matrix:\n%+v", afterMatrix)
 
@@ -452,8 +452,8 @@ func verifyMatrixAfterMerge(t *testing.T, tt struct {
 		require.Equal(t, beforeMatrix, afterMatrix, "Matrix should not change when no merges occur")
 
 		// マトリックスの値を検証
-		for i := range afterMatrix.ManagementTypes {
-			for j := range afterMatrix.Statuses {
+		for i := range afterMatrix.Rows {
+			for j := range afterMatrix.Columns {
 				require.Equal(t, beforeMatrix.Matrix[i][j], afterMatrix.Matrix[i][j],
 					fmt.Sprintf("Matrix value should not change at [%d][%d]", i, j))
 			}
@@ -464,7 +464,7 @@ func verifyMatrixAfterMerge(t *testing.T, tt struct {
 // verifyManagedToManagedMerge はmanaged to managedのマージ結果を検証します
 func verifyManagedToManagedMerge(t *testing.T, matrix *identity.Matrix) {
 	managedIndex := -1
-	for i, mType := range matrix.ManagementTypes {
+	for i, mType := range matrix.Rows {
 		if mType == "managed" {
 			managedIndex = i
 			break
@@ -478,7 +478,7 @@ func verifyManagedToManagedMerge(t *testing.T, matrix *identity.Matrix) {
 func verifyExternalToManagedMerge(t *testing.T, matrix *identity.Matrix) {
 	externalIndex := -1
 	managedIndex := -1
-	for i, mType := range matrix.ManagementTypes {
+	for i, mType := range matrix.Rows {
 		if mType == "external" {
 			externalIndex = i
 		} else if mType == "managed" {
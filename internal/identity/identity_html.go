@@ -0,0 +1,312 @@
+package identity
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/organization"
+)
+
+// MergeReportFileName は samemerge の HTML レポートのファイル名です
+const MergeReportFileName = "merge_report.html"
+
+// htmlPage は HTML レポートの共通部分です
+type htmlPage struct {
+	Title        string
+	GeneratedAt  string
+	Organization []string
+}
+
+func newHTMLPage(title string, org *admina.Organization) htmlPage {
+	return htmlPage{
+		Title:        title,
+		GeneratedAt:  time.Now().Format(time.RFC3339),
+		Organization: organization.HeaderLines(org),
+	}
+}
+
+// HTMLMatrixFormatter の実装
+// CSS とテーブルの並び替え用スクリプトを埋め込んだ単一の HTML ファイルを出力します
+type HTMLMatrixFormatter struct {
+	Organization *admina.Organization
+}
+
+func (f *HTMLMatrixFormatter) Format(matrix *Matrix) (string, error) {
+	data := struct {
+		htmlPage
+		Matrices []*Matrix
+	}{
+		htmlPage: newHTMLPage("Identity Matrix", f.Organization),
+		Matrices: append([]*Matrix{matrix}, matrix.Groups...),
+	}
+	return executeHTML("matrix", data)
+}
+
+// HTMLFormatter の実装
+// マージ結果のサマリー、スキップ理由、候補と未マッピングの一覧を単一の HTML ファイルにします
+type HTMLFormatter struct {
+	Organization *admina.Organization
+}
+
+// skipReasonCount はスキップ理由ごとの件数です
+type skipReasonCount struct {
+	Reason string
+	Count  int
+}
+
+// domainCount はドメインごとのマッチ・未マッピング件数です
+type domainCount struct {
+	Domain   string
+	Matched  int
+	Unmapped int
+}
+
+func (f *HTMLFormatter) Format(result *MergeResult, mergedCount, skippedCount int) (string, error) {
+	errorCount := 0
+	reasons := make(map[string]int)
+	for _, candidate := range result.Candidates {
+		if candidate.Status == "Error" {
+			errorCount++
+		}
+		if candidate.Reason != "" {
+			reasons[candidate.Reason]++
+		}
+	}
+
+	skipReasons := make([]skipReasonCount, 0, len(reasons))
+	for reason, count := range reasons {
+		skipReasons = append(skipReasons, skipReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(skipReasons, func(i, j int) bool {
+		if skipReasons[i].Count != skipReasons[j].Count {
+			return skipReasons[i].Count > skipReasons[j].Count
+		}
+		return skipReasons[i].Reason < skipReasons[j].Reason
+	})
+
+	summary := result.Summary
+	if summary == nil {
+		summary = &MergeSummary{}
+	}
+	domains := []domainCount{}
+	for domain := range summary.MatchCounts {
+		domains = append(domains, domainCount{Domain: domain})
+	}
+	for domain := range summary.UnmappedCounts {
+		if _, exists := summary.MatchCounts[domain]; !exists {
+			domains = append(domains, domainCount{Domain: domain})
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Domain < domains[j].Domain })
+	for i := range domains {
+		domains[i].Matched = summary.MatchCounts[domains[i].Domain]
+		domains[i].Unmapped = summary.UnmappedCounts[domains[i].Domain]
+	}
+
+	data := struct {
+		htmlPage
+		Summary     *MergeSummary
+		Merged      int
+		Skipped     int
+		Errors      int
+		Domains     []domainCount
+		SkipReasons []skipReasonCount
+		Candidates  []MergeCandidate
+		Unmapped    []admina.Identity
+	}{
+		htmlPage:    newHTMLPage("Merge Result", f.Organization),
+		Summary:     summary,
+		Merged:      mergedCount,
+		Skipped:     skippedCount,
+		Errors:      errorCount,
+		Domains:     domains,
+		SkipReasons: skipReasons,
+		Candidates:  result.Candidates,
+		Unmapped:    result.Unmapped,
+	}
+	return executeHTML("merge", data)
+}
+
+var htmlTemplates = template.Must(template.New("html").Funcs(template.FuncMap{
+	"maskEmail": MaskEmail,
+	"inc":       func(i int) int { return i + 1 },
+	"score":     formatScore,
+	"join":      strings.Join,
+	"cell": func(m *Matrix, i, j int) string {
+		return m.Cell(i, j)
+	},
+}).Parse(htmlTemplateSource))
+
+func executeHTML(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render html: %v", err)
+	}
+	return buf.String(), nil
+}
+
+const htmlTemplateSource = `
+{{define "header"}}<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "Hiragino Sans", "Meiryo", sans-serif; margin: 2rem; color: #222; }
+h1 { font-size: 1.5rem; margin-bottom: 0.25rem; }
+h2 { font-size: 1.2rem; margin-top: 2rem; border-bottom: 1px solid #ddd; padding-bottom: 0.25rem; }
+.org { background: #f5f7fa; border: 1px solid #e1e5ea; padding: 0.75rem 1rem; margin: 1rem 0; font-family: monospace; }
+.generated { color: #777; font-size: 0.85rem; }
+.summary { display: flex; flex-wrap: wrap; gap: 1rem; margin: 1rem 0; }
+.summary div { border: 1px solid #e1e5ea; border-radius: 4px; padding: 0.5rem 1rem; min-width: 8rem; }
+.summary .value { font-size: 1.5rem; font-weight: bold; }
+table { border-collapse: collapse; margin: 0.5rem 0 1rem; }
+th, td { border: 1px solid #ccc; padding: 0.3rem 0.6rem; text-align: left; }
+td.num, th.num { text-align: right; }
+thead th { background: #eef1f5; cursor: pointer; user-select: none; }
+thead th.asc::after { content: " \25B2"; }
+thead th.desc::after { content: " \25BC"; }
+tfoot td { font-weight: bold; background: #fafafa; }
+.Success { color: #1a7f37; }
+.Skip { color: #9a6700; }
+.NeedsReview { color: #bc4c00; font-weight: bold; }
+.Error { color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="generated">Generated at {{.GeneratedAt}}</p>
+{{if .Organization}}<div class="org">{{range .Organization}}{{.}}<br>{{end}}</div>{{end}}
+{{end}}
+
+{{define "footer"}}<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("thead th").forEach(function (th, index) {
+    th.addEventListener("click", function () {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("thead th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[index].getAttribute("data-value") || a.cells[index].textContent;
+        var y = b.cells[index].getAttribute("data-value") || b.cells[index].textContent;
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var cmp = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+        return asc ? cmp : -cmp;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+{{end}}
+
+{{define "matrix"}}{{template "header" .}}
+{{range .Matrices}}{{$m := .}}
+<h2>{{if .GroupField}}{{.GroupField}}: {{.GroupValue}}{{else}}All identities{{end}}</h2>
+{{if and .Rows .Columns}}<table class="sortable">
+<thead><tr><th>{{.RowField}}</th>{{range .Columns}}<th class="num">{{.}}</th>{{end}}<th class="num">Total</th></tr></thead>
+<tbody>
+{{range $i, $row := .Rows}}<tr><td>{{$row}}</td>{{range $j, $column := $m.Columns}}<td class="num" data-value="{{index (index $m.Matrix $i) $j}}">{{cell $m $i $j}}</td>{{end}}<td class="num">{{index $m.RowTotals $i}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td>Total</td>{{range .ColTotals}}<td class="num">{{.}}</td>{{end}}<td class="num">{{.GrandTotal}}</td></tr></tfoot>
+</table>{{else}}<p>No data available.</p>{{end}}
+<p>Total Identities: {{.GrandTotal}}</p>
+{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "merge"}}{{template "header" .}}
+<h2>Summary</h2>
+<div class="summary">
+<div><div>Total identities</div><div class="value">{{.Summary.TotalIdentities}}</div></div>
+<div><div>Merge candidates</div><div class="value">{{.Summary.MergeCandidates}}</div></div>
+<div><div>Unmapped</div><div class="value">{{.Summary.UnmappedIdentities}}</div></div>
+<div><div>Merged</div><div class="value">{{.Merged}}</div></div>
+<div><div>Skipped</div><div class="value">{{.Skipped}}</div></div>
+<div><div>Errors</div><div class="value">{{.Errors}}</div></div>
+</div>
+{{if .Domains}}<table class="sortable">
+<thead><tr><th>Child domain</th><th class="num">Matched</th><th class="num">Unmapped</th></tr></thead>
+<tbody>{{range .Domains}}<tr><td>{{.Domain}}</td><td class="num">{{.Matched}}</td><td class="num">{{.Unmapped}}</td></tr>
+{{end}}</tbody>
+</table>{{end}}
+
+<h2>Skip reasons</h2>
+{{if .SkipReasons}}<table class="sortable">
+<thead><tr><th>Reason</th><th class="num">Count</th></tr></thead>
+<tbody>{{range .SkipReasons}}<tr><td>{{.Reason}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p>No skipped candidates with a reason.</p>{{end}}
+
+<h2>Candidates ({{len .Candidates}})</h2>
+{{if .Candidates}}<table class="sortable">
+<thead><tr><th class="num">No.</th><th>Status</th><th>Parent</th><th>Parent ID</th><th>Parent type</th><th>Child</th><th>Child ID</th><th>Child type</th><th class="num">Name similarity</th><th>Reason</th></tr></thead>
+<tbody>{{range $i, $c := .Candidates}}<tr><td class="num">{{inc $i}}</td><td class="{{$c.Status}}">{{$c.Status}}</td><td>{{maskEmail $c.Parent.Email}}</td><td>{{$c.Parent.ID}}</td><td>{{$c.Parent.ManagementType}}</td><td>{{maskEmail $c.Child.Email}}</td><td>{{$c.Child.ID}}</td><td>{{$c.Child.ManagementType}}</td><td class="num">{{score $c.NameSimilarity}}</td><td>{{$c.Reason}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p>No merge candidates.</p>{{end}}
+
+<h2>Unmapped child identities ({{len .Unmapped}})</h2>
+{{if .Unmapped}}<table class="sortable">
+<thead><tr><th>Child</th><th>Identity ID</th><th>Display name</th><th>Type</th><th>Status</th></tr></thead>
+<tbody>{{range .Unmapped}}<tr><td>{{maskEmail .Email}}</td><td>{{.ID}}</td><td>{{.DisplayName}}</td><td>{{.ManagementType}}</td><td>{{.EmployeeStatus}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p>No unmapped identities.</p>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "duplicates"}}{{template "header" .}}
+<h2>Summary</h2>
+<div class="summary">
+<div><div>Scanned identities</div><div class="value">{{.TotalIdentities}}</div></div>
+<div><div>Clusters</div><div class="value">{{len .Clusters}}</div></div>
+</div>
+{{range .Clusters}}
+<h2>Cluster {{.ID}} (confidence {{score .Confidence}})</h2>
+<p>Signals: {{join .Signals ", "}}</p>
+<table class="sortable">
+<thead><tr><th>Identity ID</th><th class="num">People ID</th><th>Email</th><th>Display name</th><th>Type</th><th>Status</th></tr></thead>
+<tbody>{{range .Identities}}<tr><td>{{.ID}}</td><td class="num">{{.PeopleID}}</td><td>{{maskEmail .Email}}</td><td>{{.DisplayName}}</td><td>{{.ManagementType}}</td><td>{{.EmployeeStatus}}</td></tr>
+{{end}}</tbody>
+</table>
+{{else}}<p>No duplicate identities.</p>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "compareIdentities"}}{{if .}}<table class="sortable">
+<thead><tr><th>Identity ID</th><th>Email</th><th>Display name</th><th>Type</th><th>Status</th></tr></thead>
+<tbody>{{range .}}<tr><td>{{.ID}}</td><td>{{maskEmail .Email}}</td><td>{{.DisplayName}}</td><td>{{.ManagementType}}</td><td>{{.EmployeeStatus}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p>None.</p>{{end}}{{end}}
+
+{{define "compare"}}{{template "header" .}}
+<h2>Summary</h2>
+<div class="summary">
+<div><div>Left: {{.Left.Label}}</div><div class="value">{{.Left.TotalIdentities}}</div></div>
+<div><div>Right: {{.Right.Label}}</div><div class="value">{{.Right.TotalIdentities}}</div></div>
+<div><div>In both</div><div class="value">{{len .Overlaps}}</div></div>
+<div><div>Type mismatches</div><div class="value">{{len .Mismatches}}</div></div>
+<div><div>Only in left</div><div class="value">{{len .OnlyLeft}}</div></div>
+<div><div>Only in right</div><div class="value">{{len .OnlyRight}}</div></div>
+</div>
+
+<h2>In both ({{len .Overlaps}})</h2>
+{{if .Overlaps}}<table class="sortable">
+<thead><tr><th>Left email</th><th>Left display name</th><th>Left type</th><th>Right email</th><th>Right display name</th><th>Right type</th><th>Matched by</th></tr></thead>
+<tbody>{{range .Overlaps}}<tr><td>{{maskEmail .Left.Email}}</td><td>{{.Left.DisplayName}}</td><td{{if .ManagementTypeMismatch}} class="NeedsReview"{{end}}>{{.Left.ManagementType}}</td><td>{{maskEmail .Right.Email}}</td><td>{{.Right.DisplayName}}</td><td{{if .ManagementTypeMismatch}} class="NeedsReview"{{end}}>{{.Right.ManagementType}}</td><td>{{.MatchedBy}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p>No identities in both organizations.</p>{{end}}
+
+<h2>Only in {{.Left.Label}} ({{len .OnlyLeft}})</h2>
+{{template "compareIdentities" .OnlyLeft}}
+
+<h2>Only in {{.Right.Label}} ({{len .OnlyRight}})</h2>
+{{template "compareIdentities" .OnlyRight}}
+{{template "footer" .}}{{end}}
+`
@@ -0,0 +1,114 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var htmlTestOrganization = &admina.Organization{
+	ID:         123,
+	Name:       "Test <Org>",
+	UniqueName: "test-org",
+	Status:     "active",
+	Domains:    []string{"parent.domain.com", "child.domain.com"},
+}
+
+// assertSelfContained は外部のスクリプト・スタイルシート・画像を参照していないことを確認します
+func assertSelfContained(t *testing.T, output string) {
+	t.Helper()
+	assert.True(t, strings.HasPrefix(output, "<!DOCTYPE html>"))
+	assert.Contains(t, output, "<style>")
+	assert.NotContains(t, output, "<link")
+	assert.NotContains(t, output, "src=")
+	assert.NotContains(t, output, "http://")
+	assert.NotContains(t, output, "https://")
+}
+
+func TestHTMLMatrixFormatter(t *testing.T) {
+	matrix, err := identity.GetIdentityMatrix(&mock.Client{Identities: listTestIdentities}, &identity.MatrixOptions{Group: "domain", Percent: "row"})
+	require.NoError(t, err)
+
+	output, err := (&identity.HTMLMatrixFormatter{Organization: htmlTestOrganization}).Format(matrix)
+	require.NoError(t, err)
+
+	assertSelfContained(t, output)
+	assert.Contains(t, output, "Test &lt;Org&gt; | test-org | 123 (active)")
+	assert.Contains(t, output, "<th>managementType</th>")
+	assert.Contains(t, output, "<h2>domain: child.domain.com</h2>")
+	assert.Contains(t, output, `data-value="1">1 (50.0%)</td>`)
+	assert.Contains(t, output, `<table class="sortable">`)
+}
+
+func TestHTMLFormatter(t *testing.T) {
+	result := &identity.MergeResult{
+		Candidates: []identity.MergeCandidate{
+			{Parent: testIdentities[0], Child: testIdentities[1], Status: "Success"},
+			{Parent: testIdentities[1], Child: testIdentities[0], Status: "Skip", Reason: "cannot merge from managed to external"},
+		},
+		Unmapped: []admina.Identity{testIdentities[2]},
+		Summary: &identity.MergeSummary{
+			TotalIdentities:    3,
+			MergeCandidates:    2,
+			UnmappedIdentities: 1,
+			MatchCounts:        map[string]int{"child.domain.com": 2},
+			UnmappedCounts:     map[string]int{"child.domain.com": 1},
+		},
+	}
+
+	output, err := (&identity.HTMLFormatter{}).Format(result, 1, 1)
+	require.NoError(t, err)
+
+	assertSelfContained(t, output)
+	assert.NotContains(t, output, `class="org"`)
+	assert.Contains(t, output, `<div>Merge candidates</div><div class="value">2</div>`)
+	assert.Contains(t, output, `<div>Merged</div><div class="value">1</div>`)
+	assert.Contains(t, output, "<tr><td>cannot merge from managed to external</td><td class=\"num\">1</td></tr>")
+	assert.Contains(t, output, "<tr><td>child.domain.com</td><td class=\"num\">2</td><td class=\"num\">1</td></tr>")
+	assert.Contains(t, output, "use**@parent.domain.com")
+	assert.Contains(t, output, "unm*****@child.domain.com")
+	assert.NotContains(t, output, "user1@parent.domain.com")
+}
+
+func TestMergeIdentitiesHTMLReport(t *testing.T) {
+	logger.Init()
+
+	outputDir := t.TempDir()
+	err := identity.MergeIdentities(&mock.Client{Identities: testIdentities}, &identity.MergeConfig{
+		ParentDomain: "parent.domain.com",
+		ChildDomains: []string{"child.domain.com"},
+		DryRun:       true,
+		AutoApprove:  true,
+		OutputFormat: "html",
+		OutputDir:    outputDir,
+		Organization: htmlTestOrganization,
+	})
+	require.NoError(t, err)
+
+	runDir, err := identity.LatestOutputDir(outputDir)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(runDir, identity.MergeReportFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Domains: [parent.domain.com child.domain.com]")
+	assert.FileExists(t, filepath.Join(runDir, "identity_mappings.csv"))
+}
+
+func TestPrintIdentityMatrixHTMLFile(t *testing.T) {
+	logger.Init()
+
+	path := filepath.Join(t.TempDir(), "matrix.html")
+	err := identity.PrintIdentityMatrix(&mock.Client{Identities: listTestIdentities}, "html", &identity.MatrixOptions{OutputFile: path})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "<h2>All identities</h2>")
+}
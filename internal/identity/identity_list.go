@@ -0,0 +1,318 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// ListFields は list コマンドで表示・並び替えできるフィールドです
+var ListFields = []string{
+	"id",
+	"peopleId",
+	"displayName",
+	"email",
+	"domain",
+	"managementType",
+	"employeeType",
+	"employeeStatus",
+	"secondaryEmails",
+	"mergedPeople",
+}
+
+// DefaultListFields は --fields を指定しない場合に表示するフィールドです
+var DefaultListFields = []string{"id", "email", "displayName", "managementType", "employeeType", "employeeStatus"}
+
+// ListOptions は list コマンドの絞り込み・並び替え条件です
+// 文字列のリストはいずれかに一致すれば対象とし、空の場合は絞り込みません
+type ListOptions struct {
+	Domains            []string
+	ManagementTypes    []string
+	EmployeeTypes      []string
+	EmployeeStatuses   []string
+	Search             string
+	PeopleID           int
+	HasSecondaryEmails *bool
+	HasMergedPeople    *bool
+	Where              *Where
+	Sort               string
+	Fields             []string
+	Limit              int
+}
+
+// IdentityList は list コマンドの結果です
+// Rows の各値はメールアドレスがマスク済みです
+type IdentityList struct {
+	Fields  []string
+	Rows    [][]string
+	Matched int
+}
+
+// ListFormatter はアイデンティティ一覧のフォーマット方法を定義するインターフェース
+type ListFormatter interface {
+	Format(list *IdentityList) (string, error)
+}
+
+// PrintIdentityList は条件に一致するアイデンティティの一覧を出力します
+func PrintIdentityList(client Client, options *ListOptions, outputFormat string) error {
+	formatter, err := ListFormats.New(outputFormat, nil)
+	if err != nil {
+		return err
+	}
+
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return err
+	}
+
+	list, err := ListIdentities(identities, options)
+	if err != nil {
+		return err
+	}
+
+	output, err := formatter.Format(list)
+	if err != nil {
+		return fmt.Errorf("failed to format list: %v", err)
+	}
+
+	logger.LogInfo("Outputting %d of %d matched identities", len(list.Rows), list.Matched)
+	logger.Print("%s", output)
+	return nil
+}
+
+// ListIdentities は条件で絞り込み、並び替えたアイデンティティの一覧を作成します
+func ListIdentities(identities []admina.Identity, options *ListOptions) (*IdentityList, error) {
+	fields := options.Fields
+	if len(fields) == 0 {
+		fields = DefaultListFields
+	}
+	for _, field := range fields {
+		if !contains(ListFields, field) {
+			return nil, fmt.Errorf("unknown field: %s (available: %s)", field, strings.Join(ListFields, ", "))
+		}
+	}
+
+	matched := make([]admina.Identity, 0, len(identities))
+	for _, identity := range identities {
+		if options.matches(identity) {
+			matched = append(matched, identity)
+		}
+	}
+
+	if options.Sort != "" {
+		if err := sortIdentities(matched, options.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	list := &IdentityList{
+		Fields:  fields,
+		Rows:    [][]string{},
+		Matched: len(matched),
+	}
+	for i, identity := range matched {
+		if options.Limit > 0 && i >= options.Limit {
+			break
+		}
+		row := make([]string, len(fields))
+		for j, field := range fields {
+			row[j] = maskedFieldValue(identity, field)
+		}
+		list.Rows = append(list.Rows, row)
+	}
+	return list, nil
+}
+
+func (o *ListOptions) matches(identity admina.Identity) bool {
+	if !o.Where.Match(identity) {
+		return false
+	}
+	if !matchesAny(o.Domains, ExtractDomain(identity.Email)) ||
+		!matchesAny(o.ManagementTypes, identity.ManagementType) ||
+		!matchesAny(o.EmployeeTypes, identity.EmployeeType) ||
+		!matchesAny(o.EmployeeStatuses, identity.EmployeeStatus) {
+		return false
+	}
+	if o.PeopleID != 0 && identity.PeopleID != o.PeopleID {
+		return false
+	}
+	if o.Search != "" {
+		search := strings.ToLower(o.Search)
+		if !strings.Contains(strings.ToLower(identity.DisplayName), search) &&
+			!strings.Contains(strings.ToLower(identity.Email), search) {
+			return false
+		}
+	}
+	if o.HasSecondaryEmails != nil && *o.HasSecondaryEmails != (len(identity.SecondaryEmails) > 0) {
+		return false
+	}
+	if o.HasMergedPeople != nil && *o.HasMergedPeople != (len(identity.MergedPeople) > 0) {
+		return false
+	}
+	return true
+}
+
+// matchesAny は values が空か、value と大文字小文字を区別せずに一致する要素があるかを返します
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortIdentities は指定フィールドで並び替えます。先頭に "-" を付けると降順になります
+func sortIdentities(identities []admina.Identity, sortKey string) error {
+	descending := strings.HasPrefix(sortKey, "-")
+	field := strings.TrimPrefix(sortKey, "-")
+	if !contains(ListFields, field) {
+		return fmt.Errorf("unknown sort field: %s (available: %s)", field, strings.Join(ListFields, ", "))
+	}
+
+	sort.SliceStable(identities, func(i, j int) bool {
+		a, b := identities[i], identities[j]
+		if descending {
+			a, b = b, a
+		}
+		if field == "peopleId" {
+			return a.PeopleID < b.PeopleID
+		}
+		return strings.ToLower(fieldValue(a, field)) < strings.ToLower(fieldValue(b, field))
+	})
+	return nil
+}
+
+// fieldValue はアイデンティティのフィールド値を文字列で返します
+func fieldValue(identity admina.Identity, field string) string {
+	switch field {
+	case "id":
+		return identity.ID
+	case "peopleId":
+		return strconv.Itoa(identity.PeopleID)
+	case "displayName":
+		return identity.DisplayName
+	case "email":
+		return identity.Email
+	case "domain":
+		return ExtractDomain(identity.Email)
+	case "managementType":
+		return identity.ManagementType
+	case "employeeType":
+		return identity.EmployeeType
+	case "employeeStatus":
+		return identity.EmployeeStatus
+	case "secondaryEmails":
+		return strings.Join(identity.SecondaryEmails, ";")
+	case "mergedPeople":
+		return mergedPeopleIDs(identity)
+	default:
+		return ""
+	}
+}
+
+// maskedFieldValue はメールアドレスをマスクしたフィールド値を返します
+func maskedFieldValue(identity admina.Identity, field string) string {
+	switch field {
+	case "email":
+		return MaskEmail(identity.Email)
+	case "secondaryEmails":
+		return maskEmailList(strings.Join(identity.SecondaryEmails, ";"))
+	default:
+		return fieldValue(identity, field)
+	}
+}
+
+// JSONListFormatter の実装
+type JSONListFormatter struct{}
+
+func (f *JSONListFormatter) Format(list *IdentityList) (string, error) {
+	items := make([]map[string]string, 0, len(list.Rows))
+	for _, row := range list.Rows {
+		item := make(map[string]string, len(list.Fields))
+		for i, field := range list.Fields {
+			item[field] = row[i]
+		}
+		items = append(items, item)
+	}
+
+	jsonData, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData) + "\n", nil
+}
+
+// MarkdownListFormatter の実装
+type MarkdownListFormatter struct{}
+
+func (f *MarkdownListFormatter) Format(list *IdentityList) (string, error) {
+	var output strings.Builder
+	output.WriteString("# Identities\n\n")
+	if len(list.Rows) == 0 {
+		output.WriteString("No identities matched.\n")
+		return output.String(), nil
+	}
+
+	output.WriteString("| " + strings.Join(list.Fields, " | ") + " |\n")
+	output.WriteString("|" + strings.Repeat("---|", len(list.Fields)) + "\n")
+	for _, row := range list.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = strings.ReplaceAll(value, "|", "\\|")
+		}
+		output.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	output.WriteString(fmt.Sprintf("\nShowing %d of %d identities\n", len(list.Rows), list.Matched))
+	return output.String(), nil
+}
+
+// PrettyListFormatter の実装
+type PrettyListFormatter struct{}
+
+func (f *PrettyListFormatter) Format(list *IdentityList) (string, error) {
+	widths := make([]int, len(list.Fields))
+	for i, field := range list.Fields {
+		widths[i] = utf8.RuneCountInString(field)
+	}
+	for _, row := range list.Rows {
+		for i, value := range row {
+			if width := utf8.RuneCountInString(value); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	writeRow := func(output *strings.Builder, values []string) {
+		for i, value := range values {
+			output.WriteString(value)
+			if i < len(values)-1 {
+				output.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)+2))
+			}
+		}
+		output.WriteString("\n")
+	}
+
+	var output strings.Builder
+	output.WriteString("Identities:\n")
+	writeRow(&output, list.Fields)
+	totalWidth := 0
+	for _, width := range widths {
+		totalWidth += width + 2
+	}
+	output.WriteString(strings.Repeat("-", totalWidth) + "\n")
+	for _, row := range list.Rows {
+		writeRow(&output, row)
+	}
+	output.WriteString(fmt.Sprintf("\nShowing %d of %d identities\n", len(list.Rows), list.Matched))
+	return output.String(), nil
+}
@@ -0,0 +1,97 @@
+package identity_test
+
+import (
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var listTestIdentities = []admina.Identity{
+	{ID: "100", PeopleID: 101, DisplayName: "Taro Yamada", ManagementType: "managed", EmployeeType: "full_time_employee", EmployeeStatus: "active",
+		Email: "taro@parent.domain.com", SecondaryEmails: []string{"taro@child.domain.com"}},
+	{ID: "200", PeopleID: 202, DisplayName: "Hanako Suzuki", ManagementType: "external", EmployeeType: "contractor", EmployeeStatus: "active",
+		Email: "hanako@child.domain.com"},
+	{ID: "300", PeopleID: 303, DisplayName: "Jiro Tanaka", ManagementType: "managed", EmployeeType: "full_time_employee", EmployeeStatus: "retired",
+		Email: "jiro@parent.domain.com"},
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestListIdentities(t *testing.T) {
+	identity.SetNoMask(true)
+	defer identity.SetNoMask(false)
+
+	testCases := []struct {
+		name        string
+		options     *identity.ListOptions
+		expectedIDs []string
+	}{
+		{"条件なし", &identity.ListOptions{}, []string{"100", "200", "300"}},
+		{"ドメイン", &identity.ListOptions{Domains: []string{"child.domain.com"}}, []string{"200"}},
+		{"管理タイプとステータス", &identity.ListOptions{ManagementTypes: []string{"managed"}, EmployeeStatuses: []string{"active"}}, []string{"100"}},
+		{"従業員タイプ", &identity.ListOptions{EmployeeTypes: []string{"contractor"}}, []string{"200"}},
+		{"表示名の部分一致", &identity.ListOptions{Search: "tanaka"}, []string{"300"}},
+		{"メールの部分一致", &identity.ListOptions{Search: "HANAKO@"}, []string{"200"}},
+		{"People ID", &identity.ListOptions{PeopleID: 303}, []string{"300"}},
+		{"セカンダリーメールあり", &identity.ListOptions{HasSecondaryEmails: boolPtr(true)}, []string{"100"}},
+		{"統合済みPeopleなし", &identity.ListOptions{HasMergedPeople: boolPtr(false)}, []string{"100", "200", "300"}},
+		{"降順ソート", &identity.ListOptions{Sort: "-peopleId"}, []string{"300", "200", "100"}},
+		{"表示名でソートして件数制限", &identity.ListOptions{Sort: "displayName", Limit: 2}, []string{"200", "300"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.options.Fields = []string{"id"}
+			list, err := identity.ListIdentities(listTestIdentities, tc.options)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, row := range list.Rows {
+				ids = append(ids, row[0])
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestListIdentitiesFieldsAndMask(t *testing.T) {
+	identity.SetNoMask(false)
+
+	list, err := identity.ListIdentities(listTestIdentities, &identity.ListOptions{
+		Fields: []string{"email", "domain", "secondaryEmails"},
+		Limit:  1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, list.Matched)
+	assert.Equal(t, [][]string{{"tar*@parent.domain.com", "parent.domain.com", "tar*@child.domain.com"}}, list.Rows)
+
+	_, err = identity.ListIdentities(listTestIdentities, &identity.ListOptions{Fields: []string{"unknown"}})
+	assert.Error(t, err)
+
+	_, err = identity.ListIdentities(listTestIdentities, &identity.ListOptions{Sort: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestPrintIdentityList(t *testing.T) {
+	logger.Init()
+
+	mockClient := &mock.Client{Identities: listTestIdentities}
+
+	formats := []string{"json", "markdown", "pretty"}
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			err := identity.PrintIdentityList(mockClient, &identity.ListOptions{}, format)
+			assert.NoError(t, err)
+		})
+	}
+
+	err := identity.PrintIdentityList(mockClient, &identity.ListOptions{}, "invalid")
+	assert.ErrorContains(t, err, "unknown output format: invalid")
+}
@@ -1,18 +1,68 @@
 package identity
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/moneyforward-i/admina-sysutils/internal/xlsx"
 )
 
+// MatrixDimensions はマトリックスの行・列・グループに指定できるフィールドです
+var MatrixDimensions = []string{"managementType", "employeeType", "employeeStatus", "domain", "merged"}
+
+// MatrixSortOrders はマトリックスの行・列の並び順です
+var MatrixSortOrders = []string{"label", "count"}
+
+// MatrixPercentModes はマトリックスの割合の基準です
+// row: 行合計に対する割合, col: 列合計に対する割合, total: 総計に対する割合
+var MatrixPercentModes = []string{"row", "col", "total"}
+
 type Matrix struct {
-	ManagementTypes []string
-	Statuses        []string
-	Matrix          [][]int
+	RowField    string
+	ColumnField string
+	Rows        []string
+	Columns     []string
+	Matrix      [][]int
+	RowTotals   []int
+	ColTotals   []int
+	GrandTotal  int
+	// Percent が指定された場合、Percentages に各セルの割合 (0-100) が入ります
+	Percent     string      `json:",omitempty"`
+	Percentages [][]float64 `json:",omitempty"`
+	// GroupField が指定された場合、Groups に値ごとのマトリックスが入ります
+	GroupField string    `json:",omitempty"`
+	GroupValue string    `json:",omitempty"`
+	Groups     []*Matrix `json:",omitempty"`
+}
+
+// MatrixOptions はマトリックスの集計条件です
+type MatrixOptions struct {
+	// Where に一致するアイデンティティのみを集計します
+	Where *Where
+	// Rows, Columns は行・列にするフィールドです (デフォルト: managementType, employeeStatus)
+	Rows    string
+	Columns string
+	// Group を指定すると、その値ごとにマトリックスを作成します
+	Group string
+	// Sort は行・列の並び順です。label: 名前順 (デフォルト), count: 件数の多い順
+	Sort string
+	// Percent を指定すると各セルの割合を計算します (row, col, total)
+	Percent string
+	// OutputFile を指定すると標準出力ではなくファイルに書き出します
+	OutputFile string
+	// Organization は html・template 出力のヘッダーに表示する組織情報です
+	Organization *admina.Organization
+	// Template は template 出力で使用するテンプレートのファイルまたは同梱のテンプレート名です
+	Template string
 }
 
 // Formatter はマトリックス結果のフォーマット方法を定義するインターフェース
@@ -20,40 +70,75 @@ type MatrixFormatter interface {
 	Format(matrix *Matrix) (string, error)
 }
 
-func GetIdentityMatrix(client Client) (*Matrix, error) {
-	allIdentities, err := FetchAllIdentities(client)
+// withDefaults は未指定の項目をデフォルト値で埋め、指定値を検証します
+func (o *MatrixOptions) withDefaults() (*MatrixOptions, error) {
+	options := MatrixOptions{}
+	if o != nil {
+		options = *o
+	}
+	if options.Rows == "" {
+		options.Rows = "managementType"
+	}
+	if options.Columns == "" {
+		options.Columns = "employeeStatus"
+	}
+	if options.Sort == "" {
+		options.Sort = "label"
+	}
+
+	for _, field := range []string{options.Rows, options.Columns} {
+		if !contains(MatrixDimensions, field) {
+			return nil, fmt.Errorf("unknown matrix dimension: %s (available: %s)", field, strings.Join(MatrixDimensions, ", "))
+		}
+	}
+	if options.Group != "" && !contains(MatrixDimensions, options.Group) {
+		return nil, fmt.Errorf("unknown matrix dimension: %s (available: %s)", options.Group, strings.Join(MatrixDimensions, ", "))
+	}
+	if !contains(MatrixSortOrders, options.Sort) {
+		return nil, fmt.Errorf("unknown matrix sort order: %s (available: %s)", options.Sort, strings.Join(MatrixSortOrders, ", "))
+	}
+	if options.Percent != "" && !contains(MatrixPercentModes, options.Percent) {
+		return nil, fmt.Errorf("unknown matrix percent mode: %s (available: %s)", options.Percent, strings.Join(MatrixPercentModes, ", "))
+	}
+	return &options, nil
+}
+
+func GetIdentityMatrix(client Client, options *MatrixOptions) (*Matrix, error) {
+	options, err := options.withDefaults()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(allIdentities) == 0 {
-		return &Matrix{
-			ManagementTypes: []string{},
-			Statuses:        []string{},
-			Matrix:          [][]int{},
-		}, nil
+	allIdentities, err := FetchAllIdentities(client)
+	if err != nil {
+		return nil, err
 	}
+	allIdentities = FilterIdentities(allIdentities, options.Where)
 
-	return createMatrix(allIdentities)
+	return createMatrix(allIdentities, options)
 }
 
-func PrintIdentityMatrix(client Client, outputFormat string) error {
-	matrix, err := GetIdentityMatrix(client)
+func PrintIdentityMatrix(client Client, outputFormat string, options *MatrixOptions) error {
+	if options == nil {
+		options = &MatrixOptions{}
+	}
+
+	// フォーマッタの選択
+	formatter, err := MatrixFormats.New(outputFormat, &FormatContext{
+		Organization: options.Organization,
+		Template:     options.Template,
+	})
 	if err != nil {
 		return err
 	}
+	outputFile := options.OutputFile
+	if info, _ := MatrixFormats.Lookup(outputFormat); info.RequiresFile && outputFile == "" {
+		return fmt.Errorf("--output-file is required for %s output", outputFormat)
+	}
 
-	// フォーマッタの選択
-	var formatter MatrixFormatter
-	switch outputFormat {
-	case "json":
-		formatter = &JSONMatrixFormatter{}
-	case "markdown":
-		formatter = &MarkdownMatrixFormatter{}
-	case "pretty":
-		formatter = &PrettyMatrixFormatter{}
-	default:
-		return fmt.Errorf("unknown output format: %s", outputFormat)
+	matrix, err := GetIdentityMatrix(client, options)
+	if err != nil {
+		return err
 	}
 
 	// 結果のフォーマット
@@ -62,6 +147,17 @@ func PrintIdentityMatrix(client Client, outputFormat string) error {
 		return fmt.Errorf("failed to format matrix: %v", err)
 	}
 
+	if outputFile != "" {
+		if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+		if err := os.WriteFile(outputFile, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write matrix: %v", err)
+		}
+		logger.LogInfo("Identity matrix written to %s", outputFile)
+		return nil
+	}
+
 	// 結果の出力（標準出力を使用）
 	logger.LogInfo("Outputting identity matrix")
 	const formatString = "%s"
@@ -80,52 +176,68 @@ func (f *JSONMatrixFormatter) Format(matrix *Matrix) (string, error) {
 	return string(jsonData), nil
 }
 
+// MarshalJSON は行・列がデフォルト (managementType × employeeStatus) の場合、
+// 以前の形式と互換になるよう ManagementTypes と Statuses にも行・列の値を出力します
+func (m *Matrix) MarshalJSON() ([]byte, error) {
+	type matrix Matrix
+	if m.RowField != "managementType" || m.ColumnField != "employeeStatus" {
+		return json.Marshal((*matrix)(m))
+	}
+	return json.Marshal(struct {
+		ManagementTypes []string
+		Statuses        []string
+		*matrix
+	}{m.Rows, m.Columns, (*matrix)(m)})
+}
+
 // MarkdownMatrixFormatter の実装
 type MarkdownMatrixFormatter struct{}
 
 func (f *MarkdownMatrixFormatter) Format(matrix *Matrix) (string, error) {
-	if len(matrix.ManagementTypes) == 0 || len(matrix.Statuses) == 0 {
-		return "# Identity Matrix\nNo data available.\n", nil
-	}
-
 	var output strings.Builder
 	output.WriteString("# Identity Matrix\n")
-	output.WriteString("| Type          |")
-	for _, status := range matrix.Statuses {
-		output.WriteString(fmt.Sprintf(" %-15s |", status))
+	writeMarkdownMatrix(&output, matrix)
+
+	for _, group := range matrix.Groups {
+		output.WriteString(fmt.Sprintf("\n## %s: %s\n", group.GroupField, group.GroupValue))
+		writeMarkdownMatrix(&output, group)
+	}
+
+	return output.String(), nil
+}
+
+func writeMarkdownMatrix(output *strings.Builder, matrix *Matrix) {
+	if len(matrix.Rows) == 0 || len(matrix.Columns) == 0 {
+		output.WriteString("No data available.\n")
+		return
+	}
+
+	output.WriteString(fmt.Sprintf("| %-13s |", matrix.RowField))
+	for _, column := range matrix.Columns {
+		output.WriteString(fmt.Sprintf(" %-15s |", column))
 	}
 	output.WriteString(" Total          |\n")
 
 	output.WriteString("|---------------|")
-	for range matrix.Statuses {
+	for range matrix.Columns {
 		output.WriteString("----------------|")
 	}
 	output.WriteString("----------------|\n")
 
-	totalIdentities := 0
-	for i, managementType := range matrix.ManagementTypes {
-		output.WriteString(fmt.Sprintf("| %-13s |", managementType))
-		rowTotal := 0
-		for j := range matrix.Statuses {
-			output.WriteString(fmt.Sprintf(" %-15d |", matrix.Matrix[i][j]))
-			rowTotal += matrix.Matrix[i][j]
+	for i, row := range matrix.Rows {
+		output.WriteString(fmt.Sprintf("| %-13s |", row))
+		for j := range matrix.Columns {
+			output.WriteString(fmt.Sprintf(" %-15s |", matrix.Cell(i, j)))
 		}
-		output.WriteString(fmt.Sprintf(" %-15d |\n", rowTotal))
-		totalIdentities += rowTotal
+		output.WriteString(fmt.Sprintf(" %-15d |\n", matrix.RowTotals[i]))
 	}
 
 	output.WriteString("| Total         |")
-	for j := range matrix.Statuses {
-		columnTotal := 0
-		for i := range matrix.ManagementTypes {
-			columnTotal += matrix.Matrix[i][j]
-		}
+	for _, columnTotal := range matrix.ColTotals {
 		output.WriteString(fmt.Sprintf(" %-15d |", columnTotal))
 	}
-	output.WriteString(fmt.Sprintf(" %-15d |\n", totalIdentities))
-	output.WriteString(fmt.Sprintf("\n\nTotal Identities: %d\n", totalIdentities))
-
-	return output.String(), nil
+	output.WriteString(fmt.Sprintf(" %-15d |\n", matrix.GrandTotal))
+	output.WriteString(fmt.Sprintf("\n\nTotal Identities: %d\n", matrix.GrandTotal))
 }
 
 // PrettyMatrixFormatter の実装
@@ -134,77 +246,313 @@ type PrettyMatrixFormatter struct{}
 func (f *PrettyMatrixFormatter) Format(matrix *Matrix) (string, error) {
 	var output strings.Builder
 	output.WriteString("Identity Matrix:\n")
-	output.WriteString(fmt.Sprintf("%-20s", "Type"))
-	for _, status := range matrix.Statuses {
-		output.WriteString(fmt.Sprintf("%-15s", status))
+	writePrettyMatrix(&output, matrix)
+
+	for _, group := range matrix.Groups {
+		output.WriteString(fmt.Sprintf("\n[%s: %s]\n", group.GroupField, group.GroupValue))
+		writePrettyMatrix(&output, group)
+	}
+
+	return output.String(), nil
+}
+
+func writePrettyMatrix(output *strings.Builder, matrix *Matrix) {
+	output.WriteString(fmt.Sprintf("%-20s", matrix.RowField))
+	for _, column := range matrix.Columns {
+		output.WriteString(fmt.Sprintf("%-15s", column))
 	}
 	output.WriteString(fmt.Sprintf("%-15s\n", "Total"))
 
-	output.WriteString(strings.Repeat("-", 20+15*len(matrix.Statuses)+15) + "\n")
+	output.WriteString(strings.Repeat("-", 20+15*len(matrix.Columns)+15) + "\n")
 
-	totalIdentities := 0
-	for i, managementType := range matrix.ManagementTypes {
-		output.WriteString(fmt.Sprintf("%-20s", managementType))
-		rowTotal := 0
-		for j := range matrix.Statuses {
-			output.WriteString(fmt.Sprintf("%-15d", matrix.Matrix[i][j]))
-			rowTotal += matrix.Matrix[i][j]
+	for i, row := range matrix.Rows {
+		output.WriteString(fmt.Sprintf("%-20s", row))
+		for j := range matrix.Columns {
+			output.WriteString(fmt.Sprintf("%-15s", matrix.Cell(i, j)))
 		}
-		output.WriteString(fmt.Sprintf("%-15d\n", rowTotal))
-		totalIdentities += rowTotal
+		output.WriteString(fmt.Sprintf("%-15d\n", matrix.RowTotals[i]))
 	}
 
-	output.WriteString(strings.Repeat("-", 20+15*len(matrix.Statuses)+15) + "\n")
+	output.WriteString(strings.Repeat("-", 20+15*len(matrix.Columns)+15) + "\n")
 
 	output.WriteString(fmt.Sprintf("%-20s", "Total"))
-	for j := range matrix.Statuses {
-		columnTotal := 0
-		for i := range matrix.ManagementTypes {
-			columnTotal += matrix.Matrix[i][j]
-		}
+	for _, columnTotal := range matrix.ColTotals {
 		output.WriteString(fmt.Sprintf("%-15d", columnTotal))
 	}
-	output.WriteString(fmt.Sprintf("%-15d\n", totalIdentities))
-	output.WriteString(fmt.Sprintf("\n\nTotal Identities: %d\n", totalIdentities))
+	output.WriteString(fmt.Sprintf("%-15d\n", matrix.GrandTotal))
+	output.WriteString(fmt.Sprintf("\n\nTotal Identities: %d\n", matrix.GrandTotal))
+}
 
-	return output.String(), nil
+// CSVMatrixFormatter の実装
+// Delimiter を指定しない場合はカンマ区切りになります
+type CSVMatrixFormatter struct {
+	Delimiter rune
 }
 
-// createMatrix を追加
-func createMatrix(identities []admina.Identity) (*Matrix, error) {
-	matrix := &Matrix{
-		ManagementTypes: []string{},
-		Statuses:        []string{},
-		Matrix:          [][]int{},
+func (f *CSVMatrixFormatter) Format(matrix *Matrix) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if f.Delimiter != 0 {
+		writer.Comma = f.Delimiter
 	}
 
-	managementTypeMap := make(map[string]int)
-	statusMap := make(map[string]int)
+	for _, row := range matrixTable(matrix) {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = cell.Text
+			if cell.IsNumber {
+				record[i] = strconv.FormatFloat(cell.Number, 'f', -1, 64)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
 
-	// 一意なManagementTypeとStatusを収集
+// XLSXMatrixFormatter の実装
+// 全体のマトリックスと、グループごとのマトリックスをそれぞれ別のシートに出力します
+type XLSXMatrixFormatter struct{}
+
+func (f *XLSXMatrixFormatter) Format(matrix *Matrix) (string, error) {
+	workbook := xlsx.NewWorkbook()
+	matrices := append([]*Matrix{matrix}, matrix.Groups...)
+	for _, m := range matrices {
+		name := "Matrix"
+		if m.GroupField != "" {
+			name = m.GroupValue
+		}
+		sheet := workbook.AddSheet(name, matrixSheetRows(m))
+		sheet.FreezeRows = 1
+		sheet.FreezeColumns = 1
+	}
+
+	data, err := workbook.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// matrixSheetRows は1つのマトリックスを見出し行・合計行付きの表にします
+// 割合を計算している場合は各列の右に割合の列を追加します
+func matrixSheetRows(matrix *Matrix) [][]xlsx.Cell {
+	header := []xlsx.Cell{{Text: matrix.RowField, Bold: true}}
+	for _, column := range matrix.Columns {
+		header = append(header, xlsx.Cell{Text: column, Bold: true})
+		if matrix.Percentages != nil {
+			header = append(header, xlsx.Cell{Text: column + " (%)", Bold: true})
+		}
+	}
+	header = append(header, xlsx.Cell{Text: "Total", Bold: true})
+	rows := [][]xlsx.Cell{header}
+
+	for i, label := range matrix.Rows {
+		row := []xlsx.Cell{xlsx.String(label)}
+		for j := range matrix.Columns {
+			row = append(row, xlsx.Number(float64(matrix.Matrix[i][j])))
+			if matrix.Percentages != nil {
+				row = append(row, xlsx.Number(roundPercent(matrix.Percentages[i][j])))
+			}
+		}
+		row = append(row, xlsx.Number(float64(matrix.RowTotals[i])))
+		rows = append(rows, row)
+	}
+
+	totals := []xlsx.Cell{{Text: "Total", Bold: true}}
+	for j := range matrix.Columns {
+		totals = append(totals, xlsx.Cell{Number: float64(matrix.ColTotals[j]), IsNumber: true, Bold: true})
+		if matrix.Percentages != nil {
+			totals = append(totals, xlsx.String(""))
+		}
+	}
+	totals = append(totals, xlsx.Cell{Number: float64(matrix.GrandTotal), IsNumber: true, Bold: true})
+	return append(rows, totals)
+}
+
+// matrixTable は CSV/TSV 用に全体とグループのマトリックスを1つの表にします
+// グループがある場合は先頭にグループの値の列を追加し、全体の行は "(all)" とします
+func matrixTable(matrix *Matrix) [][]xlsx.Cell {
+	if len(matrix.Groups) == 0 {
+		return matrixSheetRows(matrix)
+	}
+
+	var table [][]xlsx.Cell
+	for _, m := range append([]*Matrix{matrix}, matrix.Groups...) {
+		groupValue := "(all)"
+		if m.GroupField != "" {
+			groupValue = m.GroupValue
+		}
+		rows := matrixSheetRows(m)
+		for i, row := range rows {
+			if i == 0 && table != nil {
+				continue
+			}
+			first := xlsx.String(groupValue)
+			if i == 0 {
+				first = xlsx.String(matrix.Groups[0].GroupField)
+			}
+			table = append(table, append([]xlsx.Cell{first}, row...))
+		}
+	}
+	return table
+}
+
+func roundPercent(percent float64) float64 {
+	value, _ := strconv.ParseFloat(strconv.FormatFloat(percent, 'f', 1, 64), 64)
+	return value
+}
+
+// Cell はセルの表示値を返します。割合を計算している場合は件数に続けて表示します
+func (m *Matrix) Cell(i, j int) string {
+	if m.Percentages == nil {
+		return fmt.Sprintf("%d", m.Matrix[i][j])
+	}
+	return fmt.Sprintf("%d (%.1f%%)", m.Matrix[i][j], m.Percentages[i][j])
+}
+
+// computeTotals は行・列の合計、総計、割合を計算します
+func (m *Matrix) computeTotals(percent string) {
+	m.RowTotals = make([]int, len(m.Rows))
+	m.ColTotals = make([]int, len(m.Columns))
+	m.GrandTotal = 0
+	for i := range m.Rows {
+		for j := range m.Columns {
+			m.RowTotals[i] += m.Matrix[i][j]
+			m.ColTotals[j] += m.Matrix[i][j]
+			m.GrandTotal += m.Matrix[i][j]
+		}
+	}
+
+	m.Percent = percent
+	m.Percentages = nil
+	if percent == "" {
+		return
+	}
+
+	m.Percentages = make([][]float64, len(m.Rows))
+	for i := range m.Rows {
+		m.Percentages[i] = make([]float64, len(m.Columns))
+		for j := range m.Columns {
+			var base int
+			switch percent {
+			case "row":
+				base = m.RowTotals[i]
+			case "col":
+				base = m.ColTotals[j]
+			default:
+				base = m.GrandTotal
+			}
+			if base > 0 {
+				m.Percentages[i][j] = float64(m.Matrix[i][j]) * 100 / float64(base)
+			}
+		}
+	}
+}
+
+// matrixDimensionValue はアイデンティティの集計軸の値を返します
+func matrixDimensionValue(identity admina.Identity, dimension string) string {
+	switch dimension {
+	case "merged":
+		if len(identity.MergedPeople) > 0 {
+			return "merged"
+		}
+		return "unmerged"
+	default:
+		return fieldValue(identity, dimension)
+	}
+}
+
+// sortedDimensionValues は集計軸の値を並び順に従って返します
+func sortedDimensionValues(identities []admina.Identity, dimension, order string) []string {
+	counts := make(map[string]int)
+	values := []string{}
 	for _, identity := range identities {
-		if _, exists := managementTypeMap[identity.ManagementType]; !exists {
-			managementTypeMap[identity.ManagementType] = len(matrix.ManagementTypes)
-			matrix.ManagementTypes = append(matrix.ManagementTypes, identity.ManagementType)
+		value := matrixDimensionValue(identity, dimension)
+		if _, exists := counts[value]; !exists {
+			values = append(values, value)
+		}
+		counts[value]++
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if order == "count" && counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
 		}
-		if _, exists := statusMap[identity.EmployeeStatus]; !exists {
-			statusMap[identity.EmployeeStatus] = len(matrix.Statuses)
-			matrix.Statuses = append(matrix.Statuses, identity.EmployeeStatus)
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// createMatrix は options の行・列でアイデンティティを集計します
+func createMatrix(identities []admina.Identity, options *MatrixOptions) (*Matrix, error) {
+	options, err := options.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := sortedDimensionValues(identities, options.Rows, options.Sort)
+	columns := sortedDimensionValues(identities, options.Columns, options.Sort)
+	matrix := countMatrix(identities, options, rows, columns)
+
+	if options.Group == "" {
+		return matrix, nil
+	}
+
+	// グループごとのマトリックスは全体と同じ行・列で集計し、比較しやすくします
+	for _, groupValue := range sortedDimensionValues(identities, options.Group, options.Sort) {
+		var groupIdentities []admina.Identity
+		for _, identity := range identities {
+			if matrixDimensionValue(identity, options.Group) == groupValue {
+				groupIdentities = append(groupIdentities, identity)
+			}
 		}
+
+		group := countMatrix(groupIdentities, options, rows, columns)
+		group.GroupField = options.Group
+		group.GroupValue = groupValue
+		matrix.Groups = append(matrix.Groups, group)
+	}
+
+	return matrix, nil
+}
+
+// countMatrix は決められた行・列でアイデンティティを数えます
+func countMatrix(identities []admina.Identity, options *MatrixOptions, rows, columns []string) *Matrix {
+	matrix := &Matrix{
+		RowField:    options.Rows,
+		ColumnField: options.Columns,
+		Rows:        rows,
+		Columns:     columns,
+	}
+
+	rowIndex := make(map[string]int, len(rows))
+	for i, row := range rows {
+		rowIndex[row] = i
+	}
+	columnIndex := make(map[string]int, len(columns))
+	for j, column := range columns {
+		columnIndex[column] = j
 	}
 
 	// マトリックスの初期化
-	matrix.Matrix = make([][]int, len(matrix.ManagementTypes))
+	matrix.Matrix = make([][]int, len(rows))
 	for i := range matrix.Matrix {
-		matrix.Matrix[i] = make([]int, len(matrix.Statuses))
+		matrix.Matrix[i] = make([]int, len(columns))
 	}
 
 	// カウントの集計
 	for _, identity := range identities {
-		i := managementTypeMap[identity.ManagementType]
-		j := statusMap[identity.EmployeeStatus]
+		i := rowIndex[matrixDimensionValue(identity, options.Rows)]
+		j := columnIndex[matrixDimensionValue(identity, options.Columns)]
 		matrix.Matrix[i][j]++
 	}
 
-	return matrix, nil
+	matrix.computeTotals(options.Percent)
+	return matrix
 }
@@ -1,6 +1,11 @@
 package identity_test
 
 import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
@@ -8,6 +13,7 @@ import (
 	"github.com/moneyforward-i/admina-sysutils/internal/identity"
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetIdentityMatrix(t *testing.T) {
@@ -18,11 +24,91 @@ func TestGetIdentityMatrix(t *testing.T) {
 		},
 	}
 
-	matrix, err := identity.GetIdentityMatrix(mockClient)
+	matrix, err := identity.GetIdentityMatrix(mockClient, nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, matrix)
-	assert.Equal(t, 2, len(matrix.ManagementTypes))
-	assert.Equal(t, 2, len(matrix.Statuses))
+	assert.Equal(t, 2, len(matrix.Rows))
+	assert.Equal(t, 2, len(matrix.Columns))
+}
+
+func TestGetIdentityMatrixDimensions(t *testing.T) {
+	mockClient := &mock.Client{Identities: listTestIdentities}
+
+	t.Run("デフォルトは管理タイプ×ステータスの名前順", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "managementType", matrix.RowField)
+		assert.Equal(t, "employeeStatus", matrix.ColumnField)
+		assert.Equal(t, []string{"external", "managed"}, matrix.Rows)
+		assert.Equal(t, []string{"active", "retired"}, matrix.Columns)
+		assert.Equal(t, [][]int{{1, 0}, {1, 1}}, matrix.Matrix)
+	})
+
+	t.Run("行と列を指定できる", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Rows: "domain", Columns: "merged"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"child.domain.com", "parent.domain.com"}, matrix.Rows)
+		assert.Equal(t, []string{"unmerged"}, matrix.Columns)
+		assert.Equal(t, [][]int{{1}, {2}}, matrix.Matrix)
+	})
+
+	t.Run("件数順", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Sort: "count"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"managed", "external"}, matrix.Rows)
+		assert.Equal(t, []string{"active", "retired"}, matrix.Columns)
+	})
+
+	t.Run("グループごとに同じ行・列で集計する", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Group: "domain"})
+		require.NoError(t, err)
+		require.Len(t, matrix.Groups, 2)
+		assert.Equal(t, "domain", matrix.Groups[0].GroupField)
+		assert.Equal(t, "child.domain.com", matrix.Groups[0].GroupValue)
+		assert.Equal(t, matrix.Rows, matrix.Groups[0].Rows)
+		assert.Equal(t, [][]int{{1, 0}, {0, 0}}, matrix.Groups[0].Matrix)
+		assert.Equal(t, [][]int{{0, 0}, {1, 1}}, matrix.Groups[1].Matrix)
+	})
+
+	t.Run("合計はモデルで計算される", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, matrix.RowTotals)
+		assert.Equal(t, []int{2, 1}, matrix.ColTotals)
+		assert.Equal(t, 3, matrix.GrandTotal)
+		assert.Nil(t, matrix.Percentages)
+	})
+
+	t.Run("割合", func(t *testing.T) {
+		testCases := []struct {
+			percent  string
+			expected [][]float64
+		}{
+			{"row", [][]float64{{100, 0}, {50, 50}}},
+			{"col", [][]float64{{50, 0}, {50, 100}}},
+			{"total", [][]float64{{100.0 / 3, 0}, {100.0 / 3, 100.0 / 3}}},
+		}
+		for _, tc := range testCases {
+			matrix, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Percent: tc.percent})
+			require.NoError(t, err)
+			assert.Equal(t, tc.percent, matrix.Percent)
+			for i := range tc.expected {
+				assert.InDeltaSlice(t, tc.expected[i], matrix.Percentages[i], 0.001, tc.percent)
+			}
+		}
+		matrix, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Percent: "row"})
+		require.NoError(t, err)
+		assert.Equal(t, "1 (50.0%)", matrix.Cell(1, 1))
+	})
+
+	t.Run("不明な軸はエラー", func(t *testing.T) {
+		_, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Rows: "status"})
+		assert.Error(t, err)
+		_, err = identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Sort: "size"})
+		assert.Error(t, err)
+		_, err = identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Percent: "all"})
+		assert.Error(t, err)
+	})
 }
 
 func TestPrintIdentityMatrix(t *testing.T) {
@@ -36,11 +122,106 @@ func TestPrintIdentityMatrix(t *testing.T) {
 		},
 	}
 
+	t.Run("JSONに合計を含む", func(t *testing.T) {
+		output, err := (&identity.JSONMatrixFormatter{}).Format(&identity.Matrix{
+			Rows: []string{"managed"}, Columns: []string{"active"}, Matrix: [][]int{{2}},
+			RowTotals: []int{2}, ColTotals: []int{2}, GrandTotal: 2,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, output, `"RowTotals"`)
+		assert.Contains(t, output, `"ColTotals"`)
+		assert.Contains(t, output, `"GrandTotal": 2`)
+	})
+
+	t.Run("デフォルトの行・列では以前のキーも出力する", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(mockClient, nil)
+		require.NoError(t, err)
+		output, err := (&identity.JSONMatrixFormatter{}).Format(matrix)
+		require.NoError(t, err)
+
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal([]byte(output), &decoded))
+		assert.Equal(t, []any{"external", "internal"}, decoded["ManagementTypes"])
+		assert.Equal(t, []any{"active", "inactive"}, decoded["Statuses"])
+		assert.Equal(t, decoded["Rows"], decoded["ManagementTypes"])
+
+		matrix, err = identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Rows: "domain"})
+		require.NoError(t, err)
+		output, err = (&identity.JSONMatrixFormatter{}).Format(matrix)
+		require.NoError(t, err)
+		assert.NotContains(t, output, `"ManagementTypes"`)
+		assert.NotContains(t, output, `"Statuses"`)
+	})
+
 	formats := []string{"json", "markdown", "pretty"}
 	for _, format := range formats {
 		t.Run(format, func(t *testing.T) {
-			err := identity.PrintIdentityMatrix(mockClient, format)
+			err := identity.PrintIdentityMatrix(mockClient, format, nil)
+			assert.NoError(t, err)
+
+			err = identity.PrintIdentityMatrix(mockClient, format, &identity.MatrixOptions{Group: "managementType", Percent: "row"})
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestMatrixFileFormatters(t *testing.T) {
+	logger.Init()
+
+	mockClient := &mock.Client{Identities: listTestIdentities}
+	matrix, err := identity.GetIdentityMatrix(mockClient, nil)
+	require.NoError(t, err)
+
+	t.Run("csv", func(t *testing.T) {
+		output, err := (&identity.CSVMatrixFormatter{}).Format(matrix)
+		require.NoError(t, err)
+		assert.Equal(t, "managementType,active,retired,Total\n"+
+			"external,1,0,1\n"+
+			"managed,1,1,2\n"+
+			"Total,2,1,3\n", output)
+	})
+
+	t.Run("tsvでグループと割合を出力", func(t *testing.T) {
+		grouped, err := identity.GetIdentityMatrix(mockClient, &identity.MatrixOptions{Group: "domain", Percent: "row"})
+		require.NoError(t, err)
+
+		output, err := (&identity.CSVMatrixFormatter{Delimiter: '\t'}).Format(grouped)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		assert.Equal(t, "domain\tmanagementType\tactive\tactive (%)\tretired\tretired (%)\tTotal", lines[0])
+		assert.Equal(t, "(all)\tmanaged\t1\t50\t1\t50\t2", lines[2])
+		assert.Equal(t, "child.domain.com\texternal\t1\t100\t0\t0\t1", lines[4])
+		assert.Len(t, lines, 1+3*3)
+	})
+
+	t.Run("xlsxはファイル指定が必須", func(t *testing.T) {
+		err := identity.PrintIdentityMatrix(mockClient, "xlsx", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("xlsxをファイルに出力", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "reports", "matrix.xlsx")
+		err := identity.PrintIdentityMatrix(mockClient, "xlsx", &identity.MatrixOptions{Group: "managementType", OutputFile: path})
+		require.NoError(t, err)
+
+		reader, err := zip.OpenReader(path)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		names := []string{}
+		for _, file := range reader.File {
+			names = append(names, file.Name)
+		}
+		assert.Contains(t, names, "xl/worksheets/sheet1.xml")
+		assert.Contains(t, names, "xl/worksheets/sheet3.xml")
+	})
+
+	t.Run("csvをファイルに出力", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "matrix.csv")
+		require.NoError(t, identity.PrintIdentityMatrix(mockClient, "csv", &identity.MatrixOptions{OutputFile: path}))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "managementType,active,retired,Total\n"))
+	})
+}
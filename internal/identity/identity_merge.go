@@ -1,11 +1,12 @@
 package identity
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
@@ -18,27 +19,82 @@ type MergeConfig struct {
 	AutoApprove  bool
 	OutputFormat string
 	OutputDir    string
+	// OutputDirMode は OutputDir への出力方法です (timestamped, overwrite, append)
+	OutputDirMode string
+	// Where に一致するアイデンティティのみをマージ候補の探索対象とします
+	Where *Where
+	// Organization は html レポート・テンプレートに表示する組織情報です
+	Organization *admina.Organization
+	// Template は template 出力で使用するテンプレートのファイルまたは同梱のテンプレート名です
+	Template string
+	// PairsFile が指定されている場合、ドメインの照合ではなくCSVのマージペアからマージ候補を作成します
+	PairsFile string
+	// ExportDecisions が指定されている場合、マージせずに候補を判断ファイルに出力します
+	ExportDecisions string
+	// DecisionsFile が指定されている場合、ドメインの照合ではなく判断ファイルで approve とした候補のみをマージします
+	DecisionsFile string
+	// CSV は出力するCSVファイルの列・文字コード・区切り文字です
+	CSV CSVOptions
+	// AfterMerge はマージに成功した子アイデンティティに行う処理です
+	AfterMerge AfterMergeAction
+	// Force が true の場合、--after-merge delete で managed の子アイデンティティも削除します
+	Force bool
+	// Stdin は確認プロンプトの入力です。nil の場合は標準入力を使い、端末でない場合は --y なしでは実行できません
+	Stdin io.Reader
+	// Review が true の場合、確認プロンプトの代わりに端末のレビュー画面で承認した候補のみをマージします
+	Review bool
+	// MinNameSimilarity より親子の表示名の類似度が低い候補はマージせず NeedsReview とします。0 の場合は判定しません
+	MinNameSimilarity float64
+	// Version と Args は manifest.json に記録するツールのバージョンと実行時の引数です
+	Version string
+	Args    []string
 }
 
 type MergeCandidate struct {
 	Parent admina.Identity
 	Child  admina.Identity
+	// Status は Success, Skip, NeedsReview (表示名の類似度が低い), Error のいずれかです
 	Status string
 	Reason string
+	// NameSimilarity は親子の表示名の類似度 (0〜1) です
+	NameSimilarity float64
+	// AfterMerge はマージ後の処理 (set-status=retired など) です。指定がない場合は空です
+	// AfterMergeStatus は Success, Skip (マージしていない), Planned (dry-run), Error のいずれかです
+	AfterMerge       string
+	AfterMergeStatus string
+	AfterMergeReason string
+	// review は --review または判断ファイルで記録した判断 (approve, reject, defer など) です
+	review string
 }
 
 type MergeSummary struct {
-	TotalIdentities    int
-	MergeCandidates    int
-	UnmappedIdentities int
-	MatchCounts        map[string]int
-	UnmappedCounts     map[string]int
+	TotalIdentities    int            `json:"totalIdentities"`
+	MergeCandidates    int            `json:"mergeCandidates"`
+	UnmappedIdentities int            `json:"unmappedIdentities"`
+	MatchCounts        map[string]int `json:"matchCounts"`
+	UnmappedCounts     map[string]int `json:"unmappedCounts"`
+	UnresolvedPairs    int            `json:"unresolvedPairs,omitempty"`
+	// Decisions は判断ファイルの判断 (approve, reject, defer) ごとの候補数です
+	Decisions map[string]int `json:"decisions,omitempty"`
 }
 
 type MergeResult struct {
 	Candidates []MergeCandidate
 	Unmapped   []admina.Identity
 	Summary    *MergeSummary
+	// Unresolved は PairsFile または DecisionsFile の行のうち、アイデンティティを特定できなかったものです
+	Unresolved []UnresolvedPair
+	// recoveryWritten は --after-merge delete で復元用ファイルを出力したかです
+	recoveryWritten bool
+}
+
+// newMergeCandidate は親子の表示名の類似度を求めてマージ候補を作成します
+func newMergeCandidate(parent, child admina.Identity) MergeCandidate {
+	return MergeCandidate{
+		Parent:         parent,
+		Child:          child,
+		NameSimilarity: NameSimilarity(parent.DisplayName, child.DisplayName),
+	}
 }
 
 // Formatter はマージ結果のフォーマット方法を定義するインターフェース
@@ -59,14 +115,77 @@ func MergeIdentities(client Client, config *MergeConfig) error {
 	logger.LogInfo("Starting identity merge process")
 	ctx := context.Background()
 
-	result, err := prepareMergeResult(client, config)
+	// 出力フォーマット・テンプレート・出力先はマージを行う前に検証する
+	formatter, err := selectFormatter(config)
+	if err != nil {
+		return err
+	}
+	if err := config.CSV.Validate(); err != nil {
+		return err
+	}
+	run, err := NewOutputRun(config.getOutputDir(), config.OutputDirMode, time.Now())
 	if err != nil {
 		return err
 	}
+	if config.ExportDecisions != "" {
+		return exportMergeDecisions(client, config)
+	}
+	if !config.DryRun {
+		if err := config.AfterMerge.checkClient(client); err != nil {
+			return err
+		}
+	}
+	var prompt *mergePrompt
+	switch {
+	case config.DecisionsFile != "":
+		// 判断ファイルで承認済みのため確認プロンプトは表示しない
+		if config.Review {
+			return fmt.Errorf("--review cannot be used with --decisions")
+		}
+	case config.Review:
+		if config.DryRun || config.AutoApprove {
+			return fmt.Errorf("--review cannot be used with --dry-run or --y")
+		}
+		if err := checkReviewTerminal(); err != nil {
+			return err
+		}
+	case !config.DryRun && !config.AutoApprove:
+		// 応答できない入力で待ち続けたり、すべてスキップしたりしないよう、取得の前に確認する
+		if prompt, err = newMergePrompt(config.Stdin); err != nil {
+			return err
+		}
+	}
+	var pairs []MergePair
+	if config.PairsFile != "" {
+		if pairs, err = ReadMergePairs(config.PairsFile); err != nil {
+			return err
+		}
+		logger.LogInfo("Read %d merge pairs from %s", len(pairs), config.PairsFile)
+	}
+	var decisions []MergeDecision
+	if config.DecisionsFile != "" {
+		if decisions, err = ReadMergeDecisions(config.DecisionsFile, &config.CSV); err != nil {
+			return err
+		}
+		logger.LogInfo("Read %d merge decisions from %s", len(decisions), config.DecisionsFile)
+	}
 
-	mergedCount, skippedCount, errorCount := processMergeCandidates(ctx, client, config, result)
+	result, err := prepareMergeResult(client, config, pairs, decisions)
+	if err != nil {
+		return err
+	}
 
-	if err := outputResults(result, config, mergedCount, skippedCount); err != nil {
+	if config.Review {
+		if err := reviewCandidates(result, config); err != nil {
+			return err
+		}
+	}
+
+	afterMerge := &afterMergeRunner{action: config.AfterMerge, force: config.Force, client: client, run: run, organization: config.Organization}
+	mergedCount, skippedCount, errorCount := processMergeCandidates(ctx, client, config, result, afterMerge, prompt)
+	result.recoveryWritten = afterMerge.deleted > 0
+
+	if err := outputResults(result, config, formatter, run, mergedCount, skippedCount, errorCount); err != nil {
 		return err
 	}
 
@@ -77,12 +196,24 @@ func MergeIdentities(client Client, config *MergeConfig) error {
 	return nil
 }
 
-func prepareMergeResult(client Client, config *MergeConfig) (*MergeResult, error) {
+func prepareMergeResult(client Client, config *MergeConfig, pairs []MergePair, decisions []MergeDecision) (*MergeResult, error) {
 	allIdentities, err := FetchAllIdentities(client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch identities: %v", err)
 	}
 
+	if config.Where != nil {
+		allIdentities = FilterIdentities(allIdentities, config.Where)
+		logger.LogInfo("Filtered identities by '%s': %d identities", config.Where, len(allIdentities))
+	}
+
+	if config.PairsFile != "" {
+		return resolvePairs(allIdentities, pairs), nil
+	}
+	if config.DecisionsFile != "" {
+		return resolveDecisions(allIdentities, decisions), nil
+	}
+
 	result, err := findMergeCandidates(allIdentities, config)
 	if err != nil {
 		return nil, err
@@ -91,24 +222,30 @@ func prepareMergeResult(client Client, config *MergeConfig) (*MergeResult, error
 	return result, nil
 }
 
-func processMergeCandidates(ctx context.Context, client Client, config *MergeConfig, result *MergeResult) (mergedCount, skippedCount, errorCount int) {
+func processMergeCandidates(ctx context.Context, client Client, config *MergeConfig, result *MergeResult, afterMerge *afterMergeRunner, prompt *mergePrompt) (mergedCount, skippedCount, errorCount int) {
 	for i := range result.Candidates {
 		candidate := &result.Candidates[i]
-		status, err := processSingleCandidate(ctx, client, config, candidate)
+		status, err := processSingleCandidate(ctx, client, config, candidate, prompt)
 		switch status {
 		case "Success":
 			mergedCount++
-		case "Skip":
+		case "Skip", "NeedsReview":
 			skippedCount++
 		case "Error":
 			errorCount++
 			candidate.Reason = fmt.Sprintf("Failed to merge: %v", err)
 		}
+
+		// マージ後の処理はマージに成功した候補のみに行い、失敗はエラーとして数える
+		afterMerge.plan(candidate, config.DryRun)
+		if err := afterMerge.apply(ctx, candidate); err != nil {
+			errorCount++
+		}
 	}
 	return
 }
 
-func processSingleCandidate(ctx context.Context, client Client, config *MergeConfig, candidate *MergeCandidate) (string, error) {
+func processSingleCandidate(ctx context.Context, client Client, config *MergeConfig, candidate *MergeCandidate, prompt *mergePrompt) (string, error) {
 	if !IsMergeAllowed(candidate.Parent, candidate.Child) {
 		reason := fmt.Sprintf("cannot merge from %s to %s", candidate.Child.ManagementType, candidate.Parent.ManagementType)
 		logger.LogInfo("%s (%s -> %s)", reason, MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
@@ -117,20 +254,51 @@ func processSingleCandidate(ctx context.Context, client Client, config *MergeCon
 		return "Skip", nil
 	}
 
+	// レビュー画面や判断ファイルで判断した場合は表示名の類似度と確認プロンプトより優先する
+	if config.Review || config.DecisionsFile != "" {
+		if reason := reviewSkipReason(candidate.review); reason != "" {
+			logger.LogInfo("Skipped merging %s -> %s: %s", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email), reason)
+			candidate.Status = "Skip"
+			candidate.Reason = reason
+			return "Skip", nil
+		}
+		if config.DryRun {
+			logger.LogInfo("Dry-run: Would merge %s -> %s", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
+			candidate.Status = "Skip"
+			return "Skip", nil
+		}
+		return mergeCandidate(ctx, client, candidate)
+	}
+
+	// ローカルパートが同じでも別人の可能性があるため、表示名が似ていない候補は確認に回す
+	if config.MinNameSimilarity > 0 && candidate.NameSimilarity < config.MinNameSimilarity {
+		reason := fmt.Sprintf("display name similarity %s is below %s", formatScore(candidate.NameSimilarity), formatScore(config.MinNameSimilarity))
+		logger.LogInfo("%s (%s -> %s)", reason, MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
+		candidate.Status = "NeedsReview"
+		candidate.Reason = reason
+		return "NeedsReview", nil
+	}
+
 	if config.DryRun {
 		logger.LogInfo("Dry-run: Would merge %s -> %s", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
 		candidate.Status = "Skip"
 		return "Skip", nil
 	}
 
-	if !config.AutoApprove {
-		if !confirmMerge(candidate) {
-			logger.LogInfo("Skipped merging %s -> %s", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
+	if prompt != nil {
+		if reason := confirmSkipReason(prompt.ask(candidate)); reason != "" {
+			logger.LogInfo("Skipped merging %s -> %s: %s", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email), reason)
 			candidate.Status = "Skip"
+			candidate.Reason = reason
 			return "Skip", nil
 		}
 	}
 
+	return mergeCandidate(ctx, client, candidate)
+}
+
+// mergeCandidate は API で子アイデンティティを親にマージします
+func mergeCandidate(ctx context.Context, client Client, candidate *MergeCandidate) (string, error) {
 	clientMergeResult, err := client.MergeIdentities(ctx, candidate.Child.PeopleID, candidate.Parent.PeopleID)
 	if err != nil {
 		logger.LogInfo("Failed to merge %s -> %s: %v", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email), err)
@@ -143,94 +311,115 @@ func processSingleCandidate(ctx context.Context, client Client, config *MergeCon
 	return "Success", nil
 }
 
-func confirmMerge(candidate *MergeCandidate) bool {
-	fmt.Printf("Merge %s -> %s? (y/n): ", MaskEmail(candidate.Child.Email), MaskEmail(candidate.Parent.Email))
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.TrimSpace(response)
-	return response == "y"
-}
-
-func outputResults(result *MergeResult, config *MergeConfig, mergedCount, skippedCount int) error {
-	formatter, err := selectFormatter(config.OutputFormat)
-	if err != nil {
-		return err
+// confirmSkipReason は確認プロンプトの回答からスキップの理由を返します。承認した場合は空です
+func confirmSkipReason(answer string) string {
+	switch answer {
+	case confirmYes:
+		return ""
+	case confirmQuit:
+		return "stopped by user"
 	}
+	return "not confirmed"
+}
 
+func outputResults(result *MergeResult, config *MergeConfig, formatter Formatter, run *OutputRun, mergedCount, skippedCount, errorCount int) error {
 	output, err := formatter.Format(result, mergedCount, skippedCount)
 	if err != nil {
 		return fmt.Errorf("failed to format output: %v", err)
 	}
 
-	// JSONフォーマッタの場合、ログレベルをDEBUGに変更
-	logger.LogDebug("%s", output)
+	if config.OutputFormat == "template" {
+		// テンプレートの出力は利用者が求めたレポートなので標準出力に出す
+		logger.Print("%s", output)
+	} else {
+		// JSONフォーマッタの場合、ログレベルをDEBUGに変更
+		logger.LogDebug("%s", output)
+	}
 
 	// CSVファイルの出力処理
-	outputDir := config.getOutputDir()
-	if outputDir != "" {
-		logger.LogInfo("Writing CSV files")
-
-		// CSVファイルの書き込み
-		csvWriter, err := NewCSVWriter(outputDir)
-		if err != nil {
-			return fmt.Errorf("failed to create CSV writer: %v", err)
-		}
+	if err := run.Prepare(); err != nil {
+		return err
+	}
+	logger.LogInfo("Writing CSV files")
 
-		// マッピングファイルの作成
-		mappingRows := make([][]string, 0, len(result.Candidates))
-		for _, candidate := range result.Candidates {
-			parentEmail := MaskEmail(candidate.Parent.Email)
-			childEmail := MaskEmail(candidate.Child.Email)
-			mappingRows = append(mappingRows, []string{
-				parentEmail,
-				candidate.Parent.ID,
-				childEmail,
-				candidate.Child.ID,
-				candidate.Status,
-			})
-		}
+	// CSVファイルの書き込み
+	csvWriter, err := NewCSVWriter(run.Dir, run.Append(), &config.CSV)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV writer: %v", err)
+	}
 
-		if err := csvWriter.WriteCSV("identity_mappings.csv",
-			[]string{"ParentEmail", "ParentIdentityID", "ChildEmail", "ChildIdentityID", "Status"},
-			mappingRows); err != nil {
-			return fmt.Errorf("failed to write mappings CSV: %v", err)
-		}
+	headers, rows := mappingTable(result, &config.CSV)
+	if err := csvWriter.WriteCSV(mappingsFileName, headers, rows); err != nil {
+		return fmt.Errorf("failed to write mappings CSV: %v", err)
+	}
 
-		// アンマップファイルの作成
-		unmappedRows := make([][]string, 0, len(result.Unmapped))
-		for _, unmapped := range result.Unmapped {
-			childEmail := MaskEmail(unmapped.Email)
-			unmappedRows = append(unmappedRows, []string{
-				childEmail,
-				unmapped.ID,
-			})
+	files := []string{mappingsFileName}
+	if result.recoveryWritten {
+		files = append(files, RecoveryFileName)
+	}
+	if config.PairsFile != "" || config.DecisionsFile != "" {
+		// マージペアと判断ファイルでは未マッピングの代わりに解決できなかった行を出力する
+		if err := csvWriter.WriteCSV(unresolvedFileName, unresolvedHeaders, unresolvedRows(result)); err != nil {
+			return fmt.Errorf("failed to write unresolved CSV: %v", err)
 		}
-
-		if err := csvWriter.WriteCSV("unmapped_child_identities.csv",
-			[]string{"ChildEmail", "ChildIdentityID"},
-			unmappedRows); err != nil {
+		files = append(files, unresolvedFileName)
+	} else {
+		headers, rows = unmappedTable(result, &config.CSV)
+		if err := csvWriter.WriteCSV(unmappedFileName, headers, rows); err != nil {
 			return fmt.Errorf("failed to write unmapped CSV: %v", err)
 		}
+		files = append(files, unmappedFileName)
+	}
+
+	logger.LogInfo("CSV files written to %s", run.Dir)
 
-		logger.LogInfo("CSV files written to %s", outputDir)
+	// HTMLレポートはCSVと同じディレクトリに出力
+	if config.OutputFormat == "html" {
+		reportPath := filepath.Join(run.Dir, MergeReportFileName)
+		if err := os.WriteFile(reportPath, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write HTML report: %v", err)
+		}
+		logger.LogInfo("HTML report written to %s", reportPath)
+		files = append(files, MergeReportFileName)
 	}
 
+	// 成果物を検証できるように、出力したファイルのチェックサムをマニフェストに記録する
+	if err := WriteManifest(run.Dir, newMergeManifest(result, config, run, mergedCount, skippedCount, errorCount), files); err != nil {
+		return err
+	}
+	logger.LogInfo("Manifest written to %s", filepath.Join(run.Dir, ManifestFileName))
+
 	return nil
 }
 
-func selectFormatter(format string) (Formatter, error) {
-	switch format {
-	case "json":
-		return &JSONFormatter{}, nil
-	case "markdown":
-		return &MarkdownFormatter{}, nil
-	case "pretty":
-		return &PrettyFormatter{}, nil
-	case "csv":
-		return &CSVFormatter{}, nil
-	default:
-		return nil, fmt.Errorf("unknown output format: %s", format)
+func newMergeManifest(result *MergeResult, config *MergeConfig, run *OutputRun, mergedCount, skippedCount, errorCount int) *Manifest {
+	command := "samemerge"
+	if config.PairsFile != "" {
+		command = "merge"
+	}
+	manifest := newManifest(command, config.Version, config.Args, config.Organization, run, config.DryRun)
+	manifest.ParentDomain = config.ParentDomain
+	manifest.ChildDomains = config.ChildDomains
+	manifest.PairsFile = config.PairsFile
+	manifest.DecisionsFile = config.DecisionsFile
+	manifest.OutputFormat = config.OutputFormat
+	manifest.CSVSchema = CSVSchemaVersion
+	if !config.AfterMerge.IsNone() {
+		manifest.AfterMerge = config.AfterMerge.String()
 	}
+	manifest.MinNameSimilarity = config.MinNameSimilarity
+	manifest.Summary = result.Summary
+	manifest.Merged = mergedCount
+	manifest.Skipped = skippedCount
+	manifest.Errors = errorCount
+	return manifest
+}
+
+func selectFormatter(config *MergeConfig) (Formatter, error) {
+	return MergeFormats.New(config.OutputFormat, &FormatContext{
+		Organization: config.Organization,
+		Template:     config.Template,
+	})
 }
 
 func findMergeCandidates(identities []admina.Identity, config *MergeConfig) (*MergeResult, error) {
@@ -279,10 +468,7 @@ func findMergeCandidates(identities []admina.Identity, config *MergeConfig) (*Me
 			for _, parent := range identities {
 				if ExtractDomain(parent.Email) == config.ParentDomain &&
 					ExtractLocalPart(parent.Email) == localPart {
-					result.Candidates = append(result.Candidates, MergeCandidate{
-						Parent: parent,
-						Child:  identity,
-					})
+					result.Candidates = append(result.Candidates, newMergeCandidate(parent, identity))
 					result.Summary.MatchCounts[ExtractDomain(identity.Email)]++
 					matched = true
 					break
@@ -0,0 +1,178 @@
+package identity
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// unresolvedFileName は --from-csv で解決できなかった行を出力するファイル名です
+const unresolvedFileName = "unresolved_pairs.csv"
+
+// pairsChildColumn と pairsParentColumn はマージペアのCSVの必須列です（大文字小文字は区別しません）
+const (
+	pairsChildColumn  = "child"
+	pairsParentColumn = "parent"
+)
+
+// MergePair はマージペアのCSVの1行です
+// Child と Parent にはメールアドレス・アイデンティティID・People ID のいずれかを指定します
+type MergePair struct {
+	Line   int
+	Child  string
+	Parent string
+}
+
+// UnresolvedPair はアイデンティティを特定できなかったマージペアです
+type UnresolvedPair struct {
+	MergePair
+	Reason string
+}
+
+// ReadMergePairs はマージペアのCSVを読み込みます
+// ヘッダー行に child と parent の列が必要です。それ以外の列は無視します
+func ReadMergePairs(path string) ([]MergePair, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open merge pairs: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("merge pairs file is empty: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merge pairs header: %v", err)
+	}
+
+	childIndex, parentIndex := -1, -1
+	for i, header := range headers {
+		// Excel で保存した BOM 付きのファイルも読み込めるようにする
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))) {
+		case pairsChildColumn:
+			childIndex = i
+		case pairsParentColumn:
+			parentIndex = i
+		}
+	}
+	if childIndex < 0 || parentIndex < 0 {
+		return nil, fmt.Errorf("merge pairs header must contain %q and %q columns: %s", pairsChildColumn, pairsParentColumn, strings.Join(headers, ","))
+	}
+
+	var pairs []MergePair
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read merge pairs: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		pair := MergePair{Line: line}
+		if childIndex < len(record) {
+			pair.Child = strings.TrimSpace(record[childIndex])
+		}
+		if parentIndex < len(record) {
+			pair.Parent = strings.TrimSpace(record[parentIndex])
+		}
+		if pair.Child == "" && pair.Parent == "" {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// resolvePairs はマージペアを取得したアイデンティティに対応付け、マージ候補を作成します
+// 一致するアイデンティティがない、または複数ある行は Unresolved に含めます
+func resolvePairs(identities []admina.Identity, pairs []MergePair) *MergeResult {
+	result := &MergeResult{
+		Candidates: []MergeCandidate{},
+		Unmapped:   []admina.Identity{},
+		Summary: &MergeSummary{
+			TotalIdentities: len(identities),
+			MatchCounts:     make(map[string]int),
+			UnmappedCounts:  make(map[string]int),
+		},
+	}
+
+	for _, pair := range pairs {
+		child, childErr := resolvePairIdentity(identities, "child", pair.Child)
+		parent, parentErr := resolvePairIdentity(identities, "parent", pair.Parent)
+		var reason string
+		switch {
+		case childErr != nil && parentErr != nil:
+			reason = childErr.Error() + "; " + parentErr.Error()
+		case childErr != nil:
+			reason = childErr.Error()
+		case parentErr != nil:
+			reason = parentErr.Error()
+		case child.ID == parent.ID:
+			reason = "child and parent are the same identity"
+		}
+		if reason != "" {
+			result.Unresolved = append(result.Unresolved, UnresolvedPair{MergePair: pair, Reason: reason})
+			continue
+		}
+
+		result.Candidates = append(result.Candidates, newMergeCandidate(parent, child))
+		result.Summary.MatchCounts[ExtractDomain(child.Email)]++
+	}
+
+	result.Summary.MergeCandidates = len(result.Candidates)
+	result.Summary.UnresolvedPairs = len(result.Unresolved)
+
+	logger.PrintErr("=== Merge Pairs Summary ===\n")
+	logger.PrintErr("Pairs in file: %d\n", len(pairs))
+	logger.PrintErr("Resolved merge candidates: %d\n", len(result.Candidates))
+	logger.PrintErr("Unresolved pairs: %d\n", len(result.Unresolved))
+	for _, unresolved := range result.Unresolved {
+		logger.PrintErr("  - line %d: %s\n", unresolved.Line, unresolved.Reason)
+	}
+	logger.PrintErr("=== Analysis Complete ===\n")
+	return result
+}
+
+// resolvePairIdentity は value に一致するアイデンティティが1件だけの場合に返します
+func resolvePairIdentity(identities []admina.Identity, role, value string) (admina.Identity, error) {
+	if value == "" {
+		return admina.Identity{}, fmt.Errorf("%s is empty", role)
+	}
+	matched := FindIdentities(identities, value)
+	switch len(matched) {
+	case 0:
+		return admina.Identity{}, fmt.Errorf("%s %s not found", role, MaskEmail(value))
+	case 1:
+		return matched[0], nil
+	default:
+		return admina.Identity{}, fmt.Errorf("%s %s matches %d identities", role, MaskEmail(value), len(matched))
+	}
+}
+
+// unresolvedHeaders は unresolved_pairs.csv のヘッダーです
+var unresolvedHeaders = []string{"Line", "Child", "Parent", "Reason"}
+
+// unresolvedRows は解決できなかったマージペアをCSVの行にします
+func unresolvedRows(result *MergeResult) [][]string {
+	rows := make([][]string, 0, len(result.Unresolved))
+	for _, unresolved := range result.Unresolved {
+		rows = append(rows, []string{
+			strconv.Itoa(unresolved.Line),
+			MaskEmail(unresolved.Child),
+			MaskEmail(unresolved.Parent),
+			unresolved.Reason,
+		})
+	}
+	return rows
+}
@@ -0,0 +1,91 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCSVFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pairs.csv")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestReadMergePairs(t *testing.T) {
+	t.Run("BOM付き・大文字のヘッダーと余分な列を読み込める", func(t *testing.T) {
+		path := writeCSVFile(t, "\ufeffNote,Child,Parent\nold account,old@child.domain.com,new@parent.domain.com\n\n,,\nid,300,100\n")
+
+		pairs, err := identity.ReadMergePairs(path)
+		require.NoError(t, err)
+		assert.Equal(t, []identity.MergePair{
+			{Line: 2, Child: "old@child.domain.com", Parent: "new@parent.domain.com"},
+			{Line: 5, Child: "300", Parent: "100"},
+		}, pairs)
+	})
+
+	t.Run("child と parent の列が必要", func(t *testing.T) {
+		_, err := identity.ReadMergePairs(writeCSVFile(t, "from,to\na,b\n"))
+		assert.ErrorContains(t, err, `merge pairs header must contain "child" and "parent" columns`)
+	})
+
+	t.Run("空のファイル", func(t *testing.T) {
+		_, err := identity.ReadMergePairs(writeCSVFile(t, ""))
+		assert.ErrorContains(t, err, "merge pairs file is empty")
+	})
+}
+
+func TestMergeIdentitiesFromPairs(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(false)
+
+	pairsFile := writeCSVFile(t, "child,parent\n"+
+		"300,100\n"+ // アイデンティティID
+		"202,user1@parent.domain.com\n"+ // People ID とメールアドレス
+		"100,200\n"+ // managed から external へはマージできない
+		"nobody@child.domain.com,100\n"+
+		"100,100\n")
+
+	outputDir := t.TempDir()
+	err := identity.MergeIdentities(&mock.Client{Identities: testIdentities}, &identity.MergeConfig{
+		PairsFile:     pairsFile,
+		DryRun:        true,
+		AutoApprove:   true,
+		OutputFormat:  "json",
+		OutputDir:     outputDir,
+		OutputDirMode: "overwrite",
+		CSV:           identity.CSVOptions{Columns: []string{"ChildIdentityID", "ParentIdentityID", "Status", "Reason"}},
+	})
+	require.NoError(t, err)
+
+	mappings, err := os.ReadFile(filepath.Join(outputDir, "identity_mappings.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ParentIdentityID", "ChildIdentityID", "Status", "Reason"},
+		{"100", "300", "Skip", ""},
+		{"100", "200", "Skip", ""},
+		{"200", "100", "Skip", "cannot merge from managed to external"},
+	}, readCSV(t, mappings))
+
+	unresolved, err := os.ReadFile(filepath.Join(outputDir, "unresolved_pairs.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"Line", "Child", "Parent", "Reason"},
+		{"5", "nob***@child.domain.com", "100", "child nob***@child.domain.com not found"},
+		{"6", "100", "100", "child and parent are the same identity"},
+	}, readCSV(t, unresolved))
+	assert.NoFileExists(t, filepath.Join(outputDir, "unmapped_child_identities.csv"))
+
+	manifest, err := identity.ReadManifest(outputDir)
+	require.NoError(t, err)
+	assert.Equal(t, pairsFile, manifest.PairsFile)
+	assert.Equal(t, 3, manifest.Summary.MergeCandidates)
+	assert.Equal(t, 2, manifest.Summary.UnresolvedPairs)
+}
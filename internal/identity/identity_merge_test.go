@@ -45,12 +45,14 @@ func TestMergeIdentitiesWithFormatters(t *testing.T) {
 				Identities: testIdentities,
 			}
 
+			outputDir := t.TempDir()
 			config := &identity.MergeConfig{
 				ParentDomain: "parent.domain.com",
 				ChildDomains: []string{"child.domain.com"},
 				DryRun:       true,
 				AutoApprove:  true,
 				OutputFormat: "json",
+				OutputDir:    outputDir,
 			}
 
 			projectRoot, err := os.Getwd()
@@ -68,11 +70,11 @@ func TestMergeIdentitiesWithFormatters(t *testing.T) {
 					assert.NoError(t, err)
 
 					if format == "csv" {
-						// CSVファイルの出力ディレクトリを確認
-						outputDir := filepath.Join(projectRoot, "out", "data")
-						logger.LogInfo("Output directory: %s", outputDir)
-						mappingsPath := filepath.Join(outputDir, "identity_mappings.csv")
-						unmappedPath := filepath.Join(outputDir, "unmapped_child_identities.csv")
+						// CSVファイルは --outdir の実行ごとのディレクトリに出力される
+						runDir, err := identity.LatestOutputDir(outputDir)
+						assert.NoError(t, err)
+						mappingsPath := filepath.Join(runDir, "identity_mappings.csv")
+						unmappedPath := filepath.Join(runDir, "unmapped_child_identities.csv")
 
 						// CSVファイルの存在確認
 						assert.FileExists(t, mappingsPath)
@@ -117,6 +119,7 @@ func TestMergeIdentitiesOrder(t *testing.T) {
 		DryRun:       false,
 		AutoApprove:  true,
 		OutputFormat: "json",
+		OutputDir:    t.TempDir(),
 	}
 
 	// テストの実行
@@ -154,6 +157,7 @@ func TestMergeIdentitiesError(t *testing.T) {
 				DryRun:       false,
 				AutoApprove:  true,
 				OutputFormat: "json",
+				OutputDir:    t.TempDir(),
 			},
 			expectedError: "",
 		},
@@ -169,6 +173,7 @@ func TestMergeIdentitiesError(t *testing.T) {
 				DryRun:       false,
 				AutoApprove:  true,
 				OutputFormat: "json",
+				OutputDir:    t.TempDir(),
 			},
 			expectedError: "failed to fetch identities: failed to fetch identities: merge failed",
 		},
@@ -183,6 +188,7 @@ func TestMergeIdentitiesError(t *testing.T) {
 				DryRun:       false,
 				AutoApprove:  true,
 				OutputFormat: "invalid",
+				OutputDir:    t.TempDir(),
 			},
 			expectedError: "unknown output format: invalid",
 		},
@@ -214,6 +220,7 @@ func TestMergeIdentitiesDryRun(t *testing.T) {
 		DryRun:       true,
 		AutoApprove:  true,
 		OutputFormat: "json",
+		OutputDir:    t.TempDir(),
 	}
 
 	err := identity.MergeIdentities(mockClient, config)
@@ -347,6 +354,7 @@ func TestMergeIdentitiesAPIErrors(t *testing.T) {
 		DryRun:       false,
 		AutoApprove:  true,
 		OutputFormat: "json",
+		OutputDir:    t.TempDir(),
 	}
 
 	for _, tc := range testCases {
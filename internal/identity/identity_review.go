@@ -0,0 +1,547 @@
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+)
+
+// レビューで候補ごとに記録する判断
+const (
+	ReviewUndecided = ""
+	ReviewApprove   = "approve"
+	ReviewReject    = "reject"
+	// reviewCancelled はレビューを中止した場合に残りの候補に記録します
+	reviewCancelled = "cancelled"
+)
+
+// レビュー画面のキー。1文字のキーはその文字で表します
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyPageUp    = "pgup"
+	KeyPageDown  = "pgdown"
+	KeyHome      = "home"
+	KeyEnd       = "end"
+	KeyEnter     = "enter"
+	KeyEscape    = "esc"
+	KeyBackspace = "backspace"
+	KeySpace     = "space"
+	KeyCtrlC     = "ctrl+c"
+)
+
+type reviewMode int
+
+const (
+	reviewModeList reviewMode = iota
+	reviewModeSearch
+	reviewModeConfirm
+)
+
+// reviewDetailLines はレビュー画面下部の詳細表示の行数です
+const reviewDetailLines = 12
+
+// ReviewSession はマージ候補をレビューする画面の状態です
+// 端末の入出力から切り離しているため、キー操作と描画を個別に確認できます
+type ReviewSession struct {
+	candidates        []*MergeCandidate
+	minNameSimilarity float64
+
+	// visible は検索に一致する候補の位置です
+	visible []int
+	cursor  int
+	offset  int
+	query   string
+	input   string
+	mode    reviewMode
+	message string
+
+	done      bool
+	confirmed bool
+}
+
+// NewReviewSession はレビュー画面の状態を作成します
+// minNameSimilarity を下回る候補は画面で low similarity と表示します
+func NewReviewSession(candidates []*MergeCandidate, minNameSimilarity float64) *ReviewSession {
+	s := &ReviewSession{candidates: candidates, minNameSimilarity: minNameSimilarity}
+	s.applyFilter("")
+	return s
+}
+
+// Decision は i 番目の候補の判断を返します
+func (s *ReviewSession) Decision(i int) string {
+	return s.candidates[i].review
+}
+
+// Confirmed はサマリーの確認で実行が選ばれたかを返します
+func (s *ReviewSession) Confirmed() bool {
+	return s.confirmed
+}
+
+// Counts は承認・却下・未決定の件数を返します
+func (s *ReviewSession) Counts() (approved, rejected, undecided int) {
+	for _, candidate := range s.candidates {
+		switch candidate.review {
+		case ReviewApprove:
+			approved++
+		case ReviewReject:
+			rejected++
+		default:
+			undecided++
+		}
+	}
+	return
+}
+
+// HandleKey はキー操作を反映し、レビューが終了した場合に true を返します
+func (s *ReviewSession) HandleKey(key string) bool {
+	s.message = ""
+	switch s.mode {
+	case reviewModeSearch:
+		s.handleSearchKey(key)
+	case reviewModeConfirm:
+		s.handleConfirmKey(key)
+	default:
+		s.handleListKey(key)
+	}
+	return s.done
+}
+
+func (s *ReviewSession) handleListKey(key string) {
+	switch key {
+	case KeyUp, "k":
+		s.move(-1)
+	case KeyDown, "j":
+		s.move(1)
+	case KeyPageUp:
+		s.move(-10)
+	case KeyPageDown:
+		s.move(10)
+	case KeyHome, "g":
+		s.move(-len(s.visible))
+	case KeyEnd, "G":
+		s.move(len(s.visible))
+	case "a":
+		s.decide(ReviewApprove)
+	case "r":
+		s.decide(ReviewReject)
+	case "s", KeySpace:
+		s.decide(ReviewUndecided)
+	case "D":
+		if current := s.current(); current != nil {
+			domain := ExtractDomain(current.Child.Email)
+			count := s.approveAll(func(c *MergeCandidate) bool { return ExtractDomain(c.Child.Email) == domain })
+			s.message = fmt.Sprintf("Approved %d candidates in %s", count, domain)
+		}
+	case "T":
+		if current := s.current(); current != nil {
+			managementType := current.Child.ManagementType
+			count := s.approveAll(func(c *MergeCandidate) bool { return c.Child.ManagementType == managementType })
+			s.message = fmt.Sprintf("Approved %d %s candidates", count, managementType)
+		}
+	case "/":
+		s.mode = reviewModeSearch
+		s.input = s.query
+	case KeyEscape:
+		s.applyFilter("")
+	case "x":
+		s.mode = reviewModeConfirm
+	case "q", KeyCtrlC:
+		s.done = true
+	}
+}
+
+func (s *ReviewSession) handleSearchKey(key string) {
+	switch key {
+	case KeyEnter:
+		s.mode = reviewModeList
+		s.applyFilter(s.input)
+		if len(s.visible) == 0 {
+			s.message = fmt.Sprintf("No candidates match %q", s.input)
+			s.applyFilter("")
+		}
+	case KeyEscape, KeyCtrlC:
+		s.mode = reviewModeList
+	case KeyBackspace:
+		if runes := []rune(s.input); len(runes) > 0 {
+			s.input = string(runes[:len(runes)-1])
+		}
+	case KeySpace:
+		s.input += " "
+	default:
+		if len([]rune(key)) == 1 {
+			s.input += key
+		}
+	}
+}
+
+func (s *ReviewSession) handleConfirmKey(key string) {
+	switch key {
+	case "y":
+		s.done = true
+		s.confirmed = true
+	case "n", KeyEscape:
+		s.mode = reviewModeList
+	case "q", KeyCtrlC:
+		s.done = true
+	}
+}
+
+func (s *ReviewSession) current() *MergeCandidate {
+	if len(s.visible) == 0 {
+		return nil
+	}
+	return s.candidates[s.visible[s.cursor]]
+}
+
+func (s *ReviewSession) move(delta int) {
+	s.cursor = max(0, min(s.cursor+delta, len(s.visible)-1))
+}
+
+// decide は選択中の候補に判断を記録し、次の候補に移動します
+func (s *ReviewSession) decide(decision string) {
+	if current := s.current(); current != nil {
+		current.review = decision
+		s.move(1)
+	}
+}
+
+// approveAll は表示中の候補のうち match に一致するものを承認します
+func (s *ReviewSession) approveAll(match func(*MergeCandidate) bool) int {
+	count := 0
+	for _, i := range s.visible {
+		if match(s.candidates[i]) {
+			s.candidates[i].review = ReviewApprove
+			count++
+		}
+	}
+	return count
+}
+
+// applyFilter はメールアドレス・表示名・ID の部分一致で表示する候補を絞り込みます
+func (s *ReviewSession) applyFilter(query string) {
+	s.query = strings.TrimSpace(query)
+	needle := strings.ToLower(s.query)
+	s.visible = s.visible[:0]
+	for i, candidate := range s.candidates {
+		if needle == "" || reviewMatches(candidate, needle) {
+			s.visible = append(s.visible, i)
+		}
+	}
+	s.cursor, s.offset = 0, 0
+}
+
+func reviewMatches(candidate *MergeCandidate, needle string) bool {
+	for _, identity := range []admina.Identity{candidate.Parent, candidate.Child} {
+		for _, value := range []string{identity.Email, identity.DisplayName, identity.ID} {
+			if strings.Contains(strings.ToLower(value), needle) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Render は width x height の画面の内容を返します
+func (s *ReviewSession) Render(width, height int) string {
+	approved, rejected, undecided := s.Counts()
+	var lines []string
+	header := fmt.Sprintf("Merge review: %d approved, %d rejected, %d undecided (total %d)", approved, rejected, undecided, len(s.candidates))
+	if s.query != "" {
+		header += fmt.Sprintf("  filter: %q (%d)", s.query, len(s.visible))
+	}
+	lines = append(lines, header, "")
+
+	if s.mode == reviewModeConfirm {
+		lines = append(lines,
+			fmt.Sprintf("%d candidates will be merged.", approved),
+			fmt.Sprintf("%d rejected and %d undecided candidates will be skipped.", rejected, undecided),
+			"",
+			"Execute merges? (y: execute, n: back to list, q: quit without merging)")
+		return strings.Join(fitLines(lines, width), "\n")
+	}
+
+	listHeight := max(height-len(lines)-reviewDetailLines-3, 3)
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+listHeight {
+		s.offset = s.cursor - listHeight + 1
+	}
+	// 番号・判断・類似度・補足の列を除いた幅を親子のメールアドレスで分ける
+	column := max((width-46)/2, 16)
+	lines = append(lines, fmt.Sprintf("  %4s  %-8s  %s  %s  %s  %s", "No.", "Decision", padWidth("Child", column), padWidth("Parent", column), "Name", "Note"))
+	for row := s.offset; row < len(s.visible) && row < s.offset+listHeight; row++ {
+		i := s.visible[row]
+		candidate := s.candidates[i]
+		marker := " "
+		if row == s.cursor {
+			marker = ">"
+		}
+		decision := candidate.review
+		if decision == ReviewUndecided {
+			decision = "-"
+		}
+		lines = append(lines, fmt.Sprintf("%s %4d  %-8s  %s  %s  %s  %s", marker, i+1, decision,
+			padWidth(MaskEmail(candidate.Child.Email), column), padWidth(MaskEmail(candidate.Parent.Email), column),
+			formatScore(candidate.NameSimilarity), s.note(candidate)))
+	}
+	for len(lines) < 3+listHeight {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, strings.Repeat("-", max(width-1, 1)))
+	lines = append(lines, s.details(column)...)
+
+	switch {
+	case s.mode == reviewModeSearch:
+		lines = append(lines, "Search: "+s.input+"_  (enter: apply, esc: cancel)")
+	case s.message != "":
+		lines = append(lines, s.message)
+	default:
+		lines = append(lines, "up/down,j/k: move  a: approve  r: reject  s: skip  D: approve domain  T: approve management type  /: search  x: execute  q: quit")
+	}
+	return strings.Join(fitLines(lines, width), "\n")
+}
+
+// note は候補の補足を返します
+func (s *ReviewSession) note(candidate *MergeCandidate) string {
+	if s.minNameSimilarity > 0 && candidate.NameSimilarity < s.minNameSimilarity {
+		return "low similarity"
+	}
+	return ""
+}
+
+// details は選択中の候補の親子のフィールドを並べて返します
+func (s *ReviewSession) details(column int) []string {
+	lines := make([]string, 0, reviewDetailLines)
+	if candidate := s.current(); candidate != nil {
+		for _, row := range candidateFields(candidate) {
+			lines = append(lines, fmt.Sprintf("  %-14s %s  %s", row[0], padWidth(row[1], column), row[2]))
+		}
+	}
+	for len(lines) < reviewDetailLines {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// candidateFields は候補の親子のフィールドを (項目名, 子, 親) の組で返します
+func candidateFields(candidate *MergeCandidate) [][3]string {
+	child, parent := candidate.Child, candidate.Parent
+	return [][3]string{
+		{"", "Child", "Parent"},
+		{"ID", child.ID, parent.ID},
+		{"People ID", peopleIDValue(child), peopleIDValue(parent)},
+		{"Email", MaskEmail(child.Email), MaskEmail(parent.Email)},
+		{"Display name", child.DisplayName, parent.DisplayName},
+		{"Management", child.ManagementType, parent.ManagementType},
+		{"Type", child.EmployeeType, parent.EmployeeType},
+		{"Status", child.EmployeeStatus, parent.EmployeeStatus},
+		{"Secondary", strings.Join(maskEmails(child.SecondaryEmails), ", "), strings.Join(maskEmails(parent.SecondaryEmails), ", ")},
+		{"Merged people", fmt.Sprint(len(child.MergedPeople)), fmt.Sprint(len(parent.MergedPeople))},
+	}
+}
+
+func maskEmails(emails []string) []string {
+	masked := make([]string, len(emails))
+	for i, email := range emails {
+		masked[i] = MaskEmail(email)
+	}
+	return masked
+}
+
+// displayWidth は全角文字を2桁として表示幅を返します
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			w += 2
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+// truncateWidth は表示幅が n を超える部分を切り詰めます
+func truncateWidth(s string, n int) string {
+	if displayWidth(s) <= n {
+		return s
+	}
+	var b strings.Builder
+	w := 0
+	for _, r := range s {
+		rw := displayWidth(string(r))
+		if w+rw > n-1 {
+			break
+		}
+		b.WriteRune(r)
+		w += rw
+	}
+	return b.String() + "~"
+}
+
+// padWidth は表示幅が n になるように切り詰めるか空白で埋めます
+func padWidth(s string, n int) string {
+	s = truncateWidth(s, n)
+	return s + strings.Repeat(" ", n-displayWidth(s))
+}
+
+func fitLines(lines []string, width int) []string {
+	for i, line := range lines {
+		lines[i] = truncateWidth(line, max(width-1, 1))
+	}
+	return lines
+}
+
+// checkReviewTerminal はレビュー画面を表示できる端末かを確認します
+func checkReviewTerminal() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("--review requires an interactive terminal on stdin and stdout")
+	}
+	return nil
+}
+
+// runReview は端末にレビュー画面を表示し、実行が確定したかを返します
+func runReview(session *ReviewSession) (bool, error) {
+	if err := checkReviewTerminal(); err != nil {
+		return false, err
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return false, fmt.Errorf("failed to start review: %v", err)
+	}
+	defer term.Restore(in, state)
+
+	// 代替画面に切り替え、終了時に元の画面とカーソルを戻す
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 120, 40
+		}
+		screen := session.Render(width, height)
+		fmt.Print("\x1b[H\x1b[2J" + strings.ReplaceAll(screen, "\n", "\r\n"))
+
+		key, err := readKey(reader)
+		if err != nil {
+			return false, fmt.Errorf("failed to read key: %v", err)
+		}
+		if session.HandleKey(key) {
+			return session.Confirmed(), nil
+		}
+	}
+}
+
+// readKey は raw モードの入力から1つのキーを読み取ります
+func readKey(reader *bufio.Reader) (string, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		if err == io.EOF {
+			return KeyCtrlC, nil
+		}
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return KeyEnter, nil
+	case 127, '\b':
+		return KeyBackspace, nil
+	case 3:
+		return KeyCtrlC, nil
+	case ' ':
+		return KeySpace, nil
+	case 0x1b:
+		// 続きのバイトがない場合は Esc キー単体
+		if reader.Buffered() == 0 {
+			return KeyEscape, nil
+		}
+		return readEscapeSequence(reader)
+	}
+	return string(r), nil
+}
+
+// readEscapeSequence は矢印キーなどのエスケープシーケンスを読み取ります
+func readEscapeSequence(reader *bufio.Reader) (string, error) {
+	var seq strings.Builder
+	for reader.Buffered() > 0 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq.WriteByte(b)
+		if seq.Len() > 1 && (b >= 'A' && b <= 'Z' || b == '~') {
+			break
+		}
+	}
+	switch seq.String() {
+	case "[A", "OA":
+		return KeyUp, nil
+	case "[B", "OB":
+		return KeyDown, nil
+	case "[5~":
+		return KeyPageUp, nil
+	case "[6~":
+		return KeyPageDown, nil
+	case "[H", "OH", "[1~":
+		return KeyHome, nil
+	case "[F", "OF", "[4~":
+		return KeyEnd, nil
+	}
+	return KeyEscape, nil
+}
+
+// reviewCandidates はマージが許可されている候補をレビュー画面に表示し、判断を候補に記録します
+// レビューを中止した場合はすべての候補をマージしません
+func reviewCandidates(result *MergeResult, config *MergeConfig) error {
+	var candidates []*MergeCandidate
+	for i := range result.Candidates {
+		if IsMergeAllowed(result.Candidates[i].Parent, result.Candidates[i].Child) {
+			candidates = append(candidates, &result.Candidates[i])
+		}
+	}
+	if len(candidates) == 0 {
+		logger.LogInfo("No merge candidates to review")
+		return nil
+	}
+
+	confirmed, err := runReview(NewReviewSession(candidates, config.MinNameSimilarity))
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		logger.LogInfo("Review cancelled; no identities will be merged")
+		for _, candidate := range candidates {
+			candidate.review = reviewCancelled
+		}
+	}
+	return nil
+}
+
+// reviewSkipReason はレビューの判断からスキップの理由を返します。承認した場合は空です
+func reviewSkipReason(decision string) string {
+	switch decision {
+	case ReviewApprove:
+		return ""
+	case ReviewReject:
+		return "rejected in review"
+	case ReviewDefer:
+		return "deferred in review"
+	case reviewCancelled:
+		return "review cancelled"
+	}
+	return "not reviewed"
+}
@@ -0,0 +1,153 @@
+package identity_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReviewTestSession() *identity.ReviewSession {
+	identities := []admina.Identity{
+		{ID: "100", DisplayName: "Taro Yamada", ManagementType: "managed", Email: "taro@parent.domain.com"},
+		{ID: "200", DisplayName: "Taro Yamada", ManagementType: "external", Email: "taro@a.domain.com"},
+		{ID: "110", DisplayName: "Jiro Sato", ManagementType: "managed", Email: "jiro@parent.domain.com"},
+		{ID: "210", DisplayName: "Jiro Tanaka", ManagementType: "external", Email: "jiro@b.domain.com"},
+		{ID: "120", DisplayName: "Hanako Suzuki", ManagementType: "managed", Email: "hanako@parent.domain.com"},
+		{ID: "220", DisplayName: "Hanako Suzuki", ManagementType: "system", Email: "hanako@a.domain.com"},
+	}
+	candidates := []*identity.MergeCandidate{
+		{Parent: identities[0], Child: identities[1], NameSimilarity: 1},
+		{Parent: identities[2], Child: identities[3], NameSimilarity: 0.5},
+		{Parent: identities[4], Child: identities[5], NameSimilarity: 1},
+	}
+	return identity.NewReviewSession(candidates, 0.8)
+}
+
+func reviewDecisions(session *identity.ReviewSession) []string {
+	decisions := make([]string, 3)
+	for i := range decisions {
+		decisions[i] = session.Decision(i)
+	}
+	return decisions
+}
+
+func TestReviewSession(t *testing.T) {
+	t.Run("承認・却下・保留して次の候補に移動する", func(t *testing.T) {
+		session := newReviewTestSession()
+		for _, key := range []string{"a", "r", "a", identity.KeyUp, "s"} {
+			assert.False(t, session.HandleKey(key))
+		}
+		assert.Equal(t, []string{identity.ReviewApprove, identity.ReviewUndecided, identity.ReviewApprove}, reviewDecisions(session))
+		approved, rejected, undecided := session.Counts()
+		assert.Equal(t, []int{2, 0, 1}, []int{approved, rejected, undecided})
+	})
+
+	t.Run("ドメインと管理タイプで一括承認する", func(t *testing.T) {
+		session := newReviewTestSession()
+		session.HandleKey("D")
+		assert.Equal(t, []string{identity.ReviewApprove, identity.ReviewUndecided, identity.ReviewApprove}, reviewDecisions(session))
+		assert.Contains(t, session.Render(120, 30), "Approved 2 candidates in a.domain.com")
+
+		session = newReviewTestSession()
+		session.HandleKey(identity.KeyDown)
+		session.HandleKey("T")
+		assert.Equal(t, []string{identity.ReviewApprove, identity.ReviewApprove, identity.ReviewUndecided}, reviewDecisions(session))
+	})
+
+	t.Run("検索で絞り込んだ候補のみを操作する", func(t *testing.T) {
+		session := newReviewTestSession()
+		for _, key := range []string{"/", "h", "a", "n", "a", "k", "o", identity.KeyEnter} {
+			session.HandleKey(key)
+		}
+		assert.Contains(t, session.Render(120, 30), `filter: "hanako" (1)`)
+		session.HandleKey("D")
+		assert.Equal(t, []string{identity.ReviewUndecided, identity.ReviewUndecided, identity.ReviewApprove}, reviewDecisions(session))
+
+		session.HandleKey(identity.KeyEscape)
+		assert.NotContains(t, session.Render(120, 30), "filter:")
+	})
+
+	t.Run("一致しない検索は絞り込まない", func(t *testing.T) {
+		session := newReviewTestSession()
+		for _, key := range []string{"/", "x", "y", "z", identity.KeyEnter} {
+			session.HandleKey(key)
+		}
+		output := session.Render(120, 30)
+		assert.Contains(t, output, `No candidates match "xyz"`)
+		assert.NotContains(t, output, "filter:")
+	})
+
+	t.Run("サマリーを確認してから実行する", func(t *testing.T) {
+		session := newReviewTestSession()
+		session.HandleKey("a")
+		session.HandleKey("x")
+		output := session.Render(120, 30)
+		assert.Contains(t, output, "1 candidates will be merged.")
+		assert.Contains(t, output, "0 rejected and 2 undecided candidates will be skipped.")
+
+		// n で一覧に戻る
+		assert.False(t, session.HandleKey("n"))
+		session.HandleKey("x")
+		assert.True(t, session.HandleKey("y"))
+		assert.True(t, session.Confirmed())
+	})
+
+	t.Run("中止した場合は実行しない", func(t *testing.T) {
+		session := newReviewTestSession()
+		session.HandleKey("a")
+		assert.True(t, session.HandleKey("q"))
+		assert.False(t, session.Confirmed())
+	})
+
+	t.Run("一覧と選択中の候補の詳細を表示する", func(t *testing.T) {
+		identity.SetNoMask(false)
+		session := newReviewTestSession()
+		session.HandleKey(identity.KeyDown)
+		output := session.Render(100, 30)
+		lines := strings.Split(output, "\n")
+		assert.Len(t, lines, 30)
+		for _, line := range lines {
+			assert.Less(t, len([]rune(line)), 100)
+		}
+		assert.Contains(t, output, "jir*@b.domain.com")
+		assert.NotContains(t, output, "jiro@b.domain.com")
+		assert.Contains(t, output, "low similarity")
+		assert.Contains(t, output, "Jiro Tanaka")
+	})
+}
+
+func TestMergeIdentitiesReview(t *testing.T) {
+	logger.Init()
+	newConfig := func(t *testing.T) *identity.MergeConfig {
+		return &identity.MergeConfig{
+			ParentDomain:  "parent.domain.com",
+			ChildDomains:  []string{"child.domain.com"},
+			OutputFormat:  "json",
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+			Review:        true,
+		}
+	}
+
+	t.Run("--dry-run や --y とは併用できない", func(t *testing.T) {
+		config := newConfig(t)
+		config.AutoApprove = true
+		err := identity.MergeIdentities(&mock.Client{Identities: testIdentities}, config)
+		assert.ErrorContains(t, err, "--review cannot be used with --dry-run or --y")
+	})
+
+	t.Run("端末でない場合はマージしない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		withStdin(t, "a\nx\ny\n")
+		err := identity.MergeIdentities(client, newConfig(t))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "--review requires an interactive terminal")
+		assert.Empty(t, client.MergeResults)
+	})
+}
@@ -0,0 +1,246 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// ShowOptions は show コマンドのオプションです
+type ShowOptions struct {
+	// SameLocalPart が true の場合、同じローカルパートを持つ他のアイデンティティも表示します
+	SameLocalPart bool
+	// Domains は SameLocalPart で対象とするドメインです。空の場合は全ドメインを対象とします
+	Domains []string
+}
+
+// IdentityDetail は show コマンドで表示する1件分の情報です
+type IdentityDetail struct {
+	Identity      admina.Identity   `json:"identity"`
+	SameLocalPart []admina.Identity `json:"sameLocalPart,omitempty"`
+}
+
+// DetailFormatter はアイデンティティ詳細のフォーマット方法を定義するインターフェース
+type DetailFormatter interface {
+	Format(details []IdentityDetail) (string, error)
+}
+
+// PrintIdentityDetail はメールアドレス・アイデンティティID・People IDに一致するアイデンティティの詳細を出力します
+func PrintIdentityDetail(client Client, query string, options *ShowOptions, outputFormat string) error {
+	formatter, err := DetailFormats.New(outputFormat, nil)
+	if err != nil {
+		return err
+	}
+
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return err
+	}
+
+	details := GetIdentityDetails(identities, query, options)
+	if len(details) == 0 {
+		return fmt.Errorf("no identity found for %s", MaskEmail(query))
+	}
+
+	output, err := formatter.Format(details)
+	if err != nil {
+		return fmt.Errorf("failed to format identity: %v", err)
+	}
+
+	logger.LogInfo("Outputting %d identities", len(details))
+	logger.Print("%s", output)
+	return nil
+}
+
+// GetIdentityDetails は query に一致するアイデンティティの詳細を返します
+func GetIdentityDetails(identities []admina.Identity, query string, options *ShowOptions) []IdentityDetail {
+	details := []IdentityDetail{}
+	for _, identity := range FindIdentities(identities, query) {
+		detail := IdentityDetail{Identity: identity}
+		if options.SameLocalPart {
+			detail.SameLocalPart = findSameLocalPart(identities, identity, options.Domains)
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// FindIdentities は query をアイデンティティID、People ID、メールアドレスとして検索します
+// メールアドレスはプライマリ・セカンダリー・統合済みPeopleのいずれかに一致すれば対象とします
+func FindIdentities(identities []admina.Identity, query string) []admina.Identity {
+	query = strings.TrimSpace(query)
+	peopleID, err := strconv.Atoi(query)
+	isPeopleID := err == nil
+
+	matched := []admina.Identity{}
+	for _, identity := range identities {
+		if identity.ID == query ||
+			(isPeopleID && identity.PeopleID == peopleID) ||
+			hasEmail(identity, query) {
+			matched = append(matched, identity)
+		}
+	}
+	return matched
+}
+
+// hasEmail はアイデンティティが email を持っているかを大文字小文字を区別せずに返します
+func hasEmail(identity admina.Identity, email string) bool {
+	if !strings.Contains(email, "@") {
+		return false
+	}
+	if strings.EqualFold(identity.Email, email) {
+		return true
+	}
+	for _, secondaryEmail := range identity.SecondaryEmails {
+		if strings.EqualFold(secondaryEmail, email) {
+			return true
+		}
+	}
+	for _, merged := range identity.MergedPeople {
+		if strings.EqualFold(merged.PrimaryEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSameLocalPart は target と同じローカルパートを持つ他のアイデンティティを返します
+func findSameLocalPart(identities []admina.Identity, target admina.Identity, domains []string) []admina.Identity {
+	localPart := strings.ToLower(ExtractLocalPart(target.Email))
+	if localPart == "" {
+		return nil
+	}
+
+	matched := []admina.Identity{}
+	for _, identity := range identities {
+		if identity.ID == target.ID || strings.ToLower(ExtractLocalPart(identity.Email)) != localPart {
+			continue
+		}
+		if !matchesAny(domains, ExtractDomain(identity.Email)) {
+			continue
+		}
+		matched = append(matched, identity)
+	}
+	return matched
+}
+
+// maskMergedPeople は統合済みPeopleのメールアドレスをマスクしたアイデンティティを返します
+func maskMergedPeople(identity admina.Identity) admina.Identity {
+	identity = maskIdentity(identity)
+	if identity.MergedPeople == nil {
+		return identity
+	}
+	mergedPeople := append(identity.MergedPeople[:0:0], identity.MergedPeople...)
+	for i := range mergedPeople {
+		mergedPeople[i].PrimaryEmail = MaskEmail(mergedPeople[i].PrimaryEmail)
+	}
+	identity.MergedPeople = mergedPeople
+	return identity
+}
+
+// JSONDetailFormatter の実装
+type JSONDetailFormatter struct{}
+
+func (f *JSONDetailFormatter) Format(details []IdentityDetail) (string, error) {
+	masked := make([]IdentityDetail, len(details))
+	for i, detail := range details {
+		masked[i].Identity = maskMergedPeople(detail.Identity)
+		for _, identity := range detail.SameLocalPart {
+			masked[i].SameLocalPart = append(masked[i].SameLocalPart, maskIdentity(identity))
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(masked, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData) + "\n", nil
+}
+
+// MarkdownDetailFormatter の実装
+type MarkdownDetailFormatter struct{}
+
+func (f *MarkdownDetailFormatter) Format(details []IdentityDetail) (string, error) {
+	var output strings.Builder
+	for _, detail := range details {
+		identity := maskMergedPeople(detail.Identity)
+		output.WriteString(fmt.Sprintf("# %s\n\n", identity.Email))
+		output.WriteString("| Field | Value |\n")
+		output.WriteString("|-------|-------|\n")
+		output.WriteString(fmt.Sprintf("| ID | %s |\n", identity.ID))
+		output.WriteString(fmt.Sprintf("| People ID | %d |\n", identity.PeopleID))
+		output.WriteString(fmt.Sprintf("| Display Name | %s |\n", identity.DisplayName))
+		output.WriteString(fmt.Sprintf("| Primary Email | %s |\n", identity.Email))
+		output.WriteString(fmt.Sprintf("| Management Type | %s |\n", identity.ManagementType))
+		output.WriteString(fmt.Sprintf("| Employee Type | %s |\n", identity.EmployeeType))
+		output.WriteString(fmt.Sprintf("| Employee Status | %s |\n", identity.EmployeeStatus))
+		output.WriteString(fmt.Sprintf("| Secondary Emails | %s |\n\n", strings.Join(identity.SecondaryEmails, "<br>")))
+
+		output.WriteString("## Merged People\n\n")
+		if len(identity.MergedPeople) == 0 {
+			output.WriteString("None.\n\n")
+		} else {
+			output.WriteString("| ID | Display Name | Primary Email | Username |\n")
+			output.WriteString("|----|--------------|---------------|----------|\n")
+			for _, merged := range identity.MergedPeople {
+				output.WriteString(fmt.Sprintf("| %d | %s | %s | %s |\n", merged.ID, merged.DisplayName, merged.PrimaryEmail, merged.Username))
+			}
+			output.WriteString("\n")
+		}
+
+		if detail.SameLocalPart != nil {
+			output.WriteString("## Same Local Part\n\n")
+			if len(detail.SameLocalPart) == 0 {
+				output.WriteString("None.\n\n")
+				continue
+			}
+			output.WriteString("| ID | Email | Management Type | Employee Status |\n")
+			output.WriteString("|----|-------|-----------------|-----------------|\n")
+			for _, other := range detail.SameLocalPart {
+				output.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", other.ID, MaskEmail(other.Email), other.ManagementType, other.EmployeeStatus))
+			}
+			output.WriteString("\n")
+		}
+	}
+	return output.String(), nil
+}
+
+// PrettyDetailFormatter の実装
+type PrettyDetailFormatter struct{}
+
+func (f *PrettyDetailFormatter) Format(details []IdentityDetail) (string, error) {
+	var output strings.Builder
+	for i, detail := range details {
+		if i > 0 {
+			output.WriteString("\n")
+		}
+		identity := maskMergedPeople(detail.Identity)
+		output.WriteString("=== Identity ===\n")
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "ID:", identity.ID))
+		output.WriteString(fmt.Sprintf("%-18s%d\n", "People ID:", identity.PeopleID))
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "Display Name:", identity.DisplayName))
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "Primary Email:", identity.Email))
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "Management Type:", identity.ManagementType))
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "Employee Type:", identity.EmployeeType))
+		output.WriteString(fmt.Sprintf("%-18s%s\n", "Employee Status:", identity.EmployeeStatus))
+		output.WriteString(fmt.Sprintf("Secondary Emails: %d\n", len(identity.SecondaryEmails)))
+		for _, email := range identity.SecondaryEmails {
+			output.WriteString(fmt.Sprintf("  - %s\n", email))
+		}
+		output.WriteString(fmt.Sprintf("Merged People: %d\n", len(identity.MergedPeople)))
+		for _, merged := range identity.MergedPeople {
+			output.WriteString(fmt.Sprintf("  - [%d] %s <%s> (username: %s)\n", merged.ID, merged.DisplayName, merged.PrimaryEmail, merged.Username))
+		}
+		if detail.SameLocalPart != nil {
+			output.WriteString(fmt.Sprintf("Same Local Part: %d\n", len(detail.SameLocalPart)))
+			for _, other := range detail.SameLocalPart {
+				output.WriteString(fmt.Sprintf("  - %s (%s, %s, ID: %s)\n", MaskEmail(other.Email), other.ManagementType, other.EmployeeStatus, other.ID))
+			}
+		}
+	}
+	return output.String(), nil
+}
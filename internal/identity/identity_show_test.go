@@ -0,0 +1,109 @@
+package identity_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func showTestIdentities(t *testing.T) []admina.Identity {
+	t.Helper()
+	var identities []admina.Identity
+	err := json.Unmarshal([]byte(`[
+		{"id": "100", "peopleId": 101, "displayName": "Taro Yamada", "managementType": "managed", "employeeStatus": "active",
+		 "primaryEmail": "taro@parent.domain.com", "secondaryEmails": ["taro@child.domain.com"],
+		 "mergedPeople": [{"id": 202, "displayName": "Taro Yamada", "primaryEmail": "taro@child.domain.com", "username": "taro"}]},
+		{"id": "300", "peopleId": 303, "displayName": "Taro External", "managementType": "external", "employeeStatus": "active",
+		 "primaryEmail": "taro@other.domain.com"},
+		{"id": "400", "peopleId": 404, "displayName": "Taro Partner", "managementType": "external", "employeeStatus": "active",
+		 "primaryEmail": "taro@partner.example.com"}
+	]`), &identities)
+	require.NoError(t, err)
+	return identities
+}
+
+func TestFindIdentities(t *testing.T) {
+	identities := showTestIdentities(t)
+
+	testCases := []struct {
+		name        string
+		query       string
+		expectedIDs []string
+	}{
+		{"アイデンティティID", "300", []string{"300"}},
+		{"People ID", "101", []string{"100"}},
+		{"プライマリメール", "TARO@parent.domain.com", []string{"100"}},
+		{"セカンダリーメール", "taro@child.domain.com", []string{"100"}},
+		{"該当なし", "nobody@parent.domain.com", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ids := []string{}
+			for _, found := range identity.FindIdentities(identities, tc.query) {
+				ids = append(ids, found.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestGetIdentityDetailsSameLocalPart(t *testing.T) {
+	identities := showTestIdentities(t)
+
+	details := identity.GetIdentityDetails(identities, "100", &identity.ShowOptions{
+		SameLocalPart: true,
+		Domains:       []string{"parent.domain.com", "other.domain.com"},
+	})
+	require.Len(t, details, 1)
+	require.Len(t, details[0].SameLocalPart, 1)
+	assert.Equal(t, "300", details[0].SameLocalPart[0].ID)
+
+	details = identity.GetIdentityDetails(identities, "100", &identity.ShowOptions{SameLocalPart: true})
+	require.Len(t, details, 1)
+	assert.Len(t, details[0].SameLocalPart, 2)
+}
+
+func TestPrintIdentityDetail(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(false)
+
+	mockClient := &mock.Client{Identities: showTestIdentities(t)}
+
+	formats := []string{"json", "markdown", "pretty"}
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			err := identity.PrintIdentityDetail(mockClient, "taro@parent.domain.com", &identity.ShowOptions{SameLocalPart: true}, format)
+			assert.NoError(t, err)
+		})
+	}
+
+	err := identity.PrintIdentityDetail(mockClient, "nobody@parent.domain.com", &identity.ShowOptions{}, "pretty")
+	assert.Error(t, err)
+}
+
+func TestPrettyDetailFormatterMasksMergedPeople(t *testing.T) {
+	identity.SetNoMask(false)
+
+	details := identity.GetIdentityDetails(showTestIdentities(t), "100", &identity.ShowOptions{})
+	output, err := (&identity.PrettyDetailFormatter{}).Format(details)
+	require.NoError(t, err)
+	assert.Contains(t, output, "[202] Taro Yamada <tar*@child.domain.com> (username: taro)")
+	assert.NotContains(t, output, "taro@")
+}
+
+func TestPrettyDetailFormatterNoMask(t *testing.T) {
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	details := identity.GetIdentityDetails(showTestIdentities(t), "100", &identity.ShowOptions{})
+	output, err := (&identity.PrettyDetailFormatter{}).Format(details)
+	require.NoError(t, err)
+	assert.Contains(t, output, "[202] Taro Yamada <taro@child.domain.com> (username: taro)")
+}
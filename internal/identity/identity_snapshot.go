@@ -0,0 +1,225 @@
+package identity
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// DefaultCacheDir はスナップショットの既定の保存先です
+const DefaultCacheDir = "out/cache"
+
+// SnapshotMeta はスナップショットファイルの先頭行に書き込まれるメタ情報です
+type SnapshotMeta struct {
+	OrganizationID string    `json:"organizationId"`
+	FetchedAt      time.Time `json:"fetchedAt"`
+	Count          int       `json:"count"`
+}
+
+// Snapshot はある時点で取得した組織の全アイデンティティです
+type Snapshot struct {
+	SnapshotMeta
+	Identities []admina.Identity
+}
+
+// IsFresh はスナップショットが ttl 以内に取得されたものかを返します
+func (s *Snapshot) IsFresh(ttl time.Duration, now time.Time) bool {
+	return now.Sub(s.FetchedAt) < ttl
+}
+
+// SnapshotStore はスナップショットを組織IDごとのJSON Linesファイルとして保存します
+type SnapshotStore struct {
+	dir string
+}
+
+// NewSnapshotStore は dir を保存先とする SnapshotStore を作成します
+func NewSnapshotStore(dir string) *SnapshotStore {
+	if dir == "" {
+		dir = DefaultCacheDir
+	}
+	return &SnapshotStore{dir: dir}
+}
+
+// Path は組織のスナップショットファイルのパスを返します
+func (s *SnapshotStore) Path(organizationID string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("identities-%s.jsonl", organizationID))
+}
+
+// Load は組織のスナップショットを読み込みます
+func (s *SnapshotStore) Load(organizationID string) (*Snapshot, error) {
+	snapshot, err := ReadSnapshotFile(s.Path(organizationID))
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.OrganizationID != organizationID {
+		return nil, fmt.Errorf("snapshot %s belongs to organization %s", s.Path(organizationID), snapshot.OrganizationID)
+	}
+	return snapshot, nil
+}
+
+// Save はスナップショットを保存します
+func (s *SnapshotStore) Save(snapshot *Snapshot) error {
+	return WriteSnapshotFile(s.Path(snapshot.OrganizationID), snapshot)
+}
+
+// Refresh はAPIから全アイデンティティを取得してスナップショットを更新します
+// Admina APIには差分取得の手段がないため、常に全ページを読み直します
+func (s *SnapshotStore) Refresh(client Client, organizationID string) (*Snapshot, error) {
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		SnapshotMeta: SnapshotMeta{
+			OrganizationID: organizationID,
+			FetchedAt:      time.Now(),
+			Count:          len(identities),
+		},
+		Identities: identities,
+	}
+	if err := s.Save(snapshot); err != nil {
+		return nil, err
+	}
+
+	logger.LogInfo("Identity snapshot saved to %s (%d identities)", s.Path(organizationID), len(identities))
+	return snapshot, nil
+}
+
+// WriteSnapshotFile はスナップショットを path に書き込みます
+// 途中で失敗しても既存のファイルを壊さないよう、一時ファイルに書いてから置き換えます
+func WriteSnapshotFile(path string, snapshot *Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	snapshot.Count = len(snapshot.Identities)
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(snapshot.SnapshotMeta); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write snapshot header: %v", err)
+	}
+	for _, identity := range snapshot.Identities {
+		if err := encoder.Encode(identity); err != nil {
+			tmpFile.Close()
+			return fmt.Errorf("failed to write snapshot record: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %v", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot file: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshotFile は path からスナップショットを読み込みます
+func ReadSnapshotFile(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	snapshot := &Snapshot{Identities: []admina.Identity{}}
+	if err := decoder.Decode(&snapshot.SnapshotMeta); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot header %s: %v", path, err)
+	}
+
+	for decoder.More() {
+		var identity admina.Identity
+		if err := decoder.Decode(&identity); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot record %d in %s: %v", len(snapshot.Identities)+1, path, err)
+		}
+		snapshot.Identities = append(snapshot.Identities, identity)
+	}
+
+	if snapshot.Count != len(snapshot.Identities) {
+		return nil, fmt.Errorf("snapshot %s is incomplete: header says %d identities, found %d", path, snapshot.Count, len(snapshot.Identities))
+	}
+	return snapshot, nil
+}
+
+// CachedClient はスナップショットからアイデンティティを返す Client です
+// スナップショットが ttl より古い場合はAPIから取得し直して保存します
+type CachedClient struct {
+	client         Client
+	store          *SnapshotStore
+	organizationID string
+	ttl            time.Duration
+	offline        bool
+}
+
+// NewCachedClient は新しい CachedClient を作成します
+// offline が true の場合はスナップショットの鮮度に関わらずAPIを呼び出しません
+func NewCachedClient(client Client, store *SnapshotStore, organizationID string, ttl time.Duration, offline bool) *CachedClient {
+	return &CachedClient{
+		client:         client,
+		store:          store,
+		organizationID: organizationID,
+		ttl:            ttl,
+		offline:        offline,
+	}
+}
+
+// GetIdentities はスナップショットの全アイデンティティを1ページとして返します
+func (c *CachedClient) GetIdentities(ctx context.Context, cursor string) ([]admina.Identity, string, error) {
+	if cursor != "" {
+		return []admina.Identity{}, "", nil
+	}
+
+	snapshot, err := c.store.Load(c.organizationID)
+	switch {
+	case err == nil && (c.offline || snapshot.IsFresh(c.ttl, time.Now())):
+		logger.LogInfo("Using identity snapshot fetched at %s (%d identities)", snapshot.FetchedAt.Format(time.RFC3339), len(snapshot.Identities))
+		return snapshot.Identities, "", nil
+	case c.offline:
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", fmt.Errorf("no identity snapshot for organization %s: run 'identity snapshot' first", c.organizationID)
+		}
+		return nil, "", err
+	case err == nil:
+		logger.LogInfo("Identity snapshot is older than %s, refreshing", c.ttl)
+	case errors.Is(err, os.ErrNotExist):
+		logger.LogInfo("No identity snapshot found, fetching from API")
+	default:
+		logger.LogWarning("Ignoring unreadable identity snapshot: %v", err)
+	}
+
+	snapshot, err = c.store.Refresh(c.client, c.organizationID)
+	if err != nil {
+		return nil, "", err
+	}
+	return snapshot.Identities, "", nil
+}
+
+// MergeIdentities はオフラインでなければ元のクライアントに委譲します
+func (c *CachedClient) MergeIdentities(ctx context.Context, fromPeopleID, toPeopleID int) (admina.MergeIdentity, error) {
+	if c.offline || c.client == nil {
+		return admina.MergeIdentity{}, fmt.Errorf("merge is not available in offline mode")
+	}
+	return c.client.MergeIdentities(ctx, fromPeopleID, toPeopleID)
+}
@@ -0,0 +1,136 @@
+package identity_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotStoreSaveAndLoad(t *testing.T) {
+	logger.Init()
+
+	store := identity.NewSnapshotStore(t.TempDir())
+	snapshot := &identity.Snapshot{
+		SnapshotMeta: identity.SnapshotMeta{
+			OrganizationID: "123",
+			FetchedAt:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Identities: testIdentities,
+	}
+
+	require.NoError(t, store.Save(snapshot))
+
+	loaded, err := store.Load("123")
+	require.NoError(t, err)
+	assert.Equal(t, "123", loaded.OrganizationID)
+	assert.Equal(t, len(testIdentities), loaded.Count)
+	assert.True(t, snapshot.FetchedAt.Equal(loaded.FetchedAt))
+	assert.Equal(t, testIdentities, loaded.Identities)
+
+	_, err = store.Load("456")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadSnapshotFileIncomplete(t *testing.T) {
+	path := t.TempDir() + "/broken.jsonl"
+	content := `{"organizationId":"123","fetchedAt":"2024-01-02T03:04:05Z","count":2}
+{"id":"100","primaryEmail":"user1@parent.domain.com"}
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	_, err := identity.ReadSnapshotFile(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "incomplete")
+}
+
+func TestCachedClient(t *testing.T) {
+	logger.Init()
+
+	t.Run("スナップショットがない場合はAPIから取得して保存する", func(t *testing.T) {
+		store := identity.NewSnapshotStore(t.TempDir())
+		client := identity.NewCachedClient(&mock.Client{Identities: testIdentities}, store, "123", time.Hour, false)
+
+		identities, err := identity.FetchAllIdentities(client)
+		require.NoError(t, err)
+		assert.Len(t, identities, len(testIdentities))
+		assert.FileExists(t, store.Path("123"))
+	})
+
+	t.Run("有効期限内のスナップショットはAPIを呼び出さない", func(t *testing.T) {
+		store := identity.NewSnapshotStore(t.TempDir())
+		require.NoError(t, store.Save(&identity.Snapshot{
+			SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Now()},
+			Identities:   testIdentities[:1],
+		}))
+
+		apiClient := &mock.Client{Error: fmt.Errorf("API should not be called")}
+		client := identity.NewCachedClient(apiClient, store, "123", time.Hour, false)
+
+		identities, err := identity.FetchAllIdentities(client)
+		require.NoError(t, err)
+		assert.Len(t, identities, 1)
+	})
+
+	t.Run("期限切れのスナップショットは更新される", func(t *testing.T) {
+		store := identity.NewSnapshotStore(t.TempDir())
+		require.NoError(t, store.Save(&identity.Snapshot{
+			SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Now().Add(-2 * time.Hour)},
+			Identities:   testIdentities[:1],
+		}))
+
+		client := identity.NewCachedClient(&mock.Client{Identities: testIdentities}, store, "123", time.Hour, false)
+
+		identities, err := identity.FetchAllIdentities(client)
+		require.NoError(t, err)
+		assert.Len(t, identities, len(testIdentities))
+
+		loaded, err := store.Load("123")
+		require.NoError(t, err)
+		assert.Len(t, loaded.Identities, len(testIdentities))
+	})
+
+	t.Run("オフラインでは古いスナップショットも使用する", func(t *testing.T) {
+		store := identity.NewSnapshotStore(t.TempDir())
+		require.NoError(t, store.Save(&identity.Snapshot{
+			SnapshotMeta: identity.SnapshotMeta{OrganizationID: "123", FetchedAt: time.Now().Add(-24 * time.Hour)},
+			Identities:   testIdentities,
+		}))
+
+		client := identity.NewCachedClient(nil, store, "123", 0, true)
+
+		matrix, err := identity.GetIdentityMatrix(client, nil)
+		require.NoError(t, err)
+		assert.NotEmpty(t, matrix.Rows)
+
+		_, err = client.MergeIdentities(context.Background(), 1, 2)
+		assert.Error(t, err)
+	})
+
+	t.Run("オフラインでスナップショットがない場合はエラー", func(t *testing.T) {
+		store := identity.NewSnapshotStore(t.TempDir())
+		client := identity.NewCachedClient(nil, store, "123", 0, true)
+
+		_, err := identity.FetchAllIdentities(client)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "identity snapshot")
+	})
+}
+
+func TestSnapshotStoreRefresh(t *testing.T) {
+	logger.Init()
+
+	store := identity.NewSnapshotStore(t.TempDir())
+	snapshot, err := store.Refresh(&mock.Client{Identities: []admina.Identity{testIdentities[0]}}, "123")
+	require.NoError(t, err)
+	assert.Equal(t, 1, snapshot.Count)
+	assert.False(t, snapshot.FetchedAt.IsZero())
+}
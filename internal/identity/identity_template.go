@@ -0,0 +1,208 @@
+package identity
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/organization"
+)
+
+// BuiltinTemplatePrefix を付けたテンプレート名は同梱のテンプレートを指します (例: builtin:matrix-summary)
+const BuiltinTemplatePrefix = "builtin:"
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// MatrixTemplateData は matrix のテンプレートに渡すデータです
+type MatrixTemplateData struct {
+	// Matrix は集計結果です。合計・割合・グループを含みます
+	Matrix *Matrix
+	// Organization は組織情報です。--offline の場合は nil です
+	Organization      *admina.Organization
+	OrganizationLines []string
+	GeneratedAt       time.Time
+}
+
+// MergeTemplateData は samemerge のテンプレートに渡すデータです
+// 候補と未マッピングのアイデンティティのメールアドレスは --nomask を指定しない限りマスクされています
+type MergeTemplateData struct {
+	Summary    *MergeSummary
+	Candidates []MergeCandidate
+	Unmapped   []admina.Identity
+	// Merged, Skipped はマージ・スキップした候補の件数です
+	Merged            int
+	Skipped           int
+	Organization      *admina.Organization
+	OrganizationLines []string
+	GeneratedAt       time.Time
+}
+
+// TemplateFuncs はテンプレートで使用できる関数です
+//
+//	maskEmail  メールアドレスをマスクします (--nomask の場合はそのまま。マスク済みの値はそのまま)
+//	domain     メールアドレスのドメインを返します
+//	localPart  メールアドレスのローカルパートを返します
+//	join       文字列のスライスを区切り文字で連結します
+//	cell       マトリックスのセルの表示値を返します (cell .Matrix i j)
+//	inc        1を加えます (0始まりのインデックスを番号にする場合)
+var TemplateFuncs = template.FuncMap{
+	"maskEmail": MaskEmail,
+	"domain":    ExtractDomain,
+	"localPart": ExtractLocalPart,
+	"join":      strings.Join,
+	"cell":      func(m *Matrix, i, j int) string { return m.Cell(i, j) },
+	"inc":       func(i int) int { return i + 1 },
+}
+
+// TemplateError はテンプレートの解析・実行時のエラーです
+type TemplateError struct {
+	Name string
+	// Line はエラーの行番号 (1始まり) です。不明な場合は0です
+	Line int
+	// Source はエラーの行の内容です
+	Source string
+	Msg    string
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("template %s: %s", e.Name, e.Msg)
+	}
+	return fmt.Sprintf("template %s line %d: %s\n  %d | %s", e.Name, e.Line, e.Msg, e.Line, e.Source)
+}
+
+// templateErrorPattern は text/template のエラー "template: NAME:LINE[:COL]: MSG" に一致します
+var templateErrorPattern = regexp.MustCompile(`^template: (?:[^:]*):(\d+)(?::\d+)?: (.*)$`)
+
+func newTemplateError(name, source string, err error) error {
+	message := strings.SplitN(err.Error(), "\n", 2)[0]
+	match := templateErrorPattern.FindStringSubmatch(message)
+	if match == nil {
+		return &TemplateError{Name: name, Msg: strings.TrimPrefix(message, "template: ")}
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	sourceLine := ""
+	if lines := strings.Split(source, "\n"); line >= 1 && line <= len(lines) {
+		sourceLine = strings.TrimRight(lines[line-1], "\r")
+	}
+	return &TemplateError{Name: name, Line: line, Source: sourceLine, Msg: match[2]}
+}
+
+// BuiltinTemplateNames は同梱のテンプレート名を返します
+func BuiltinTemplateNames() []string {
+	entries, _ := builtinTemplates.ReadDir("templates")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, BuiltinTemplatePrefix+strings.TrimSuffix(entry.Name(), ".tmpl"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputTemplate は解析済みの出力テンプレートです
+type OutputTemplate struct {
+	name     string
+	source   string
+	template *template.Template
+}
+
+// LoadTemplate はファイルまたは同梱のテンプレートを読み込んで解析します
+func LoadTemplate(name string) (*OutputTemplate, error) {
+	if name == "" {
+		return nil, fmt.Errorf("--template is required for template output")
+	}
+
+	var content []byte
+	var err error
+	if strings.HasPrefix(name, BuiltinTemplatePrefix) {
+		content, err = builtinTemplates.ReadFile(path.Join("templates", strings.TrimPrefix(name, BuiltinTemplatePrefix)+".tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown builtin template: %s (available: %s)", name, strings.Join(BuiltinTemplateNames(), ", "))
+		}
+	} else {
+		content, err = os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %v", err)
+		}
+	}
+
+	return ParseTemplate(name, string(content))
+}
+
+// ParseTemplate はテンプレートの文字列を解析します
+func ParseTemplate(name, source string) (*OutputTemplate, error) {
+	tmpl, err := template.New(name).Funcs(TemplateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, newTemplateError(name, source, err)
+	}
+	return &OutputTemplate{name: name, source: source, template: tmpl}, nil
+}
+
+// Execute はテンプレートにデータを適用します
+func (t *OutputTemplate) Execute(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return "", newTemplateError(t.name, t.source, err)
+	}
+	return buf.String(), nil
+}
+
+// TemplateMatrixFormatter の実装
+type TemplateMatrixFormatter struct {
+	Template     *OutputTemplate
+	Organization *admina.Organization
+}
+
+func (f *TemplateMatrixFormatter) Format(matrix *Matrix) (string, error) {
+	return f.Template.Execute(&MatrixTemplateData{
+		Matrix:            matrix,
+		Organization:      f.Organization,
+		OrganizationLines: organization.HeaderLines(f.Organization),
+		GeneratedAt:       time.Now(),
+	})
+}
+
+// TemplateFormatter の実装
+type TemplateFormatter struct {
+	Template     *OutputTemplate
+	Organization *admina.Organization
+}
+
+func (f *TemplateFormatter) Format(result *MergeResult, mergedCount, skippedCount int) (string, error) {
+	summary := result.Summary
+	if summary == nil {
+		summary = &MergeSummary{}
+	}
+	// 独自のテンプレートがメールアドレスをそのまま出力しても漏れないよう、マスクしてから渡す
+	candidates := make([]MergeCandidate, len(result.Candidates))
+	for i, candidate := range result.Candidates {
+		candidate.Parent = maskIdentity(candidate.Parent)
+		candidate.Child = maskIdentity(candidate.Child)
+		candidates[i] = candidate
+	}
+	unmapped := make([]admina.Identity, len(result.Unmapped))
+	for i, identity := range result.Unmapped {
+		unmapped[i] = maskIdentity(identity)
+	}
+	return f.Template.Execute(&MergeTemplateData{
+		Summary:           summary,
+		Candidates:        candidates,
+		Unmapped:          unmapped,
+		Merged:            mergedCount,
+		Skipped:           skippedCount,
+		Organization:      f.Organization,
+		OrganizationLines: organization.HeaderLines(f.Organization),
+		GeneratedAt:       time.Now(),
+	})
+}
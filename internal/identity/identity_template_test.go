@@ -0,0 +1,169 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateMatrixFormatter(t *testing.T) {
+	matrix, err := identity.GetIdentityMatrix(&mock.Client{Identities: listTestIdentities}, nil)
+	require.NoError(t, err)
+
+	tmpl, err := identity.ParseTemplate("matrix.tmpl", `{{range $i, $row := .Matrix.Rows}}{{$row}}={{index $.Matrix.RowTotals $i}};{{end}}total={{.Matrix.GrandTotal}} cell={{cell .Matrix 1 1}}`)
+	require.NoError(t, err)
+
+	output, err := (&identity.TemplateMatrixFormatter{Template: tmpl, Organization: htmlTestOrganization}).Format(matrix)
+	require.NoError(t, err)
+	assert.Equal(t, "external=1;managed=2;total=3 cell=1", output)
+}
+
+func TestTemplateFormatterMasksEmails(t *testing.T) {
+	result := &identity.MergeResult{
+		Candidates: []identity.MergeCandidate{{Parent: testIdentities[0], Child: testIdentities[1], Status: "Skip", Reason: "dry-run"}},
+		Summary:    &identity.MergeSummary{TotalIdentities: 3, MergeCandidates: 1},
+	}
+	tmpl, err := identity.ParseTemplate("merge.tmpl", `{{range .Candidates}}{{maskEmail .Child.Email}}->{{domain .Parent.Email}} {{.Reason}}{{end}} {{.Summary.MergeCandidates}}/{{.Skipped}}`)
+	require.NoError(t, err)
+
+	output, err := (&identity.TemplateFormatter{Template: tmpl}).Format(result, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "use**@child.domain.com->parent.domain.com dry-run 1/1", output)
+}
+
+func TestTemplateFormatterMasksRawEmails(t *testing.T) {
+	result := &identity.MergeResult{
+		Candidates: []identity.MergeCandidate{{Parent: testIdentities[0], Child: testIdentities[1]}},
+		Unmapped:   []admina.Identity{{ID: "300", Email: "unmapped@child.domain.com", SecondaryEmails: []string{"alias@child.domain.com"}}},
+	}
+	tmpl, err := identity.ParseTemplate("merge.tmpl", `{{range .Candidates}}{{.Child.Email}}->{{.Parent.Email}}{{end}} {{range .Unmapped}}{{.Email}} {{join .SecondaryEmails ","}}{{end}}`)
+	require.NoError(t, err)
+
+	identity.SetNoMask(false)
+	output, err := (&identity.TemplateFormatter{Template: tmpl}).Format(result, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "use**@child.domain.com->use**@parent.domain.com unm*****@child.domain.com ali**@child.domain.com", output)
+	assert.Equal(t, "user1@child.domain.com", result.Candidates[0].Child.Email, "結果そのものは変更しない")
+
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+	output, err = (&identity.TemplateFormatter{Template: tmpl}).Format(result, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "user1@child.domain.com->user1@parent.domain.com unmapped@child.domain.com alias@child.domain.com", output)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	t.Run("解析エラーは行番号と該当行を表示する", func(t *testing.T) {
+		_, err := identity.ParseTemplate("report.tmpl", "Title\n{{.Matrix.GrandTotal}} {{end}}\n{{.}}\n")
+		require.Error(t, err)
+
+		var templateErr *identity.TemplateError
+		require.ErrorAs(t, err, &templateErr)
+		assert.Equal(t, 2, templateErr.Line)
+		assert.Equal(t, "{{.Matrix.GrandTotal}} {{end}}", templateErr.Source)
+		assert.Contains(t, err.Error(), "template report.tmpl line 2: ")
+	})
+
+	t.Run("未定義の関数", func(t *testing.T) {
+		_, err := identity.ParseTemplate("report.tmpl", "ok\n{{upper .Matrix.RowField}}")
+		var templateErr *identity.TemplateError
+		require.ErrorAs(t, err, &templateErr)
+		assert.Equal(t, 2, templateErr.Line)
+		assert.Contains(t, templateErr.Msg, `function "upper" not defined`)
+	})
+
+	t.Run("実行エラーも行番号を表示する", func(t *testing.T) {
+		tmpl, err := identity.ParseTemplate("report.tmpl", "line1\nline2 {{.Matrix.Unknown}}")
+		require.NoError(t, err)
+
+		_, err = tmpl.Execute(&identity.MatrixTemplateData{Matrix: &identity.Matrix{}})
+		var templateErr *identity.TemplateError
+		require.ErrorAs(t, err, &templateErr)
+		assert.Equal(t, 2, templateErr.Line)
+		assert.Equal(t, "line2 {{.Matrix.Unknown}}", templateErr.Source)
+	})
+
+	t.Run("テンプレート未指定", func(t *testing.T) {
+		_, err := identity.LoadTemplate("")
+		assert.Error(t, err)
+	})
+
+	t.Run("不明な同梱テンプレート", func(t *testing.T) {
+		_, err := identity.LoadTemplate("builtin:unknown")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "builtin:matrix-summary")
+	})
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	logger.Init()
+
+	names := identity.BuiltinTemplateNames()
+	assert.Equal(t, []string{"builtin:matrix-slack", "builtin:matrix-summary", "builtin:merge-email", "builtin:merge-summary"}, names)
+
+	matrix, err := identity.GetIdentityMatrix(&mock.Client{Identities: listTestIdentities}, &identity.MatrixOptions{Group: "domain"})
+	require.NoError(t, err)
+	result := &identity.MergeResult{
+		Candidates: []identity.MergeCandidate{{Parent: testIdentities[0], Child: testIdentities[1], Status: "Skip", Reason: "dry-run"}},
+		Unmapped:   testIdentities[2:],
+		Summary:    &identity.MergeSummary{TotalIdentities: 3, MergeCandidates: 1, UnmappedIdentities: 1},
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := identity.LoadTemplate(name)
+			require.NoError(t, err)
+
+			var output string
+			if strings.HasPrefix(name, "builtin:matrix") {
+				output, err = (&identity.TemplateMatrixFormatter{Template: tmpl, Organization: htmlTestOrganization}).Format(matrix)
+			} else {
+				output, err = (&identity.TemplateFormatter{Template: tmpl, Organization: htmlTestOrganization}).Format(result, 0, 1)
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, output)
+			assert.NotContains(t, output, "user1@child.domain.com")
+		})
+	}
+}
+
+func TestTemplateOutputFromFile(t *testing.T) {
+	logger.Init()
+
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "matrix.tmpl")
+	require.NoError(t, os.WriteFile(templatePath, []byte("rows={{len .Matrix.Rows}}\n"), 0644))
+	outputPath := filepath.Join(dir, "matrix.txt")
+
+	err := identity.PrintIdentityMatrix(&mock.Client{Identities: listTestIdentities}, "template", &identity.MatrixOptions{Template: templatePath, OutputFile: outputPath})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "rows=2\n", string(content))
+
+	t.Run("samemergeはマージ前にテンプレートを検証する", func(t *testing.T) {
+		brokenPath := filepath.Join(dir, "broken.tmpl")
+		require.NoError(t, os.WriteFile(brokenPath, []byte("{{if .Merged}}"), 0644))
+
+		mockClient := &mock.Client{Identities: testIdentities}
+		err := identity.MergeIdentities(mockClient, &identity.MergeConfig{
+			ParentDomain: "parent.domain.com",
+			ChildDomains: []string{"child.domain.com"},
+			AutoApprove:  true,
+			OutputFormat: "template",
+			OutputDir:    t.TempDir(),
+			Template:     brokenPath,
+		})
+		require.Error(t, err)
+		assert.Empty(t, mockClient.MergeResults)
+	})
+}
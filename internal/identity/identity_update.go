@@ -0,0 +1,487 @@
+package identity
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+)
+
+// updateResultsFileName は identity update の結果を出力するファイル名です
+const updateResultsFileName = "identity_update_results.csv"
+
+// UpdateFields は identity update で変更できるフィールドです
+var UpdateFields = []string{"displayName", "employeeType", "employeeStatus"}
+
+// UpdateConfig は identity update の設定です
+type UpdateConfig struct {
+	// Filter に一致するアイデンティティを変更します。InputFile とは同時に指定できません
+	Filter *ListOptions
+	// InputFile は変更するアイデンティティを id 列に記載したCSVファイルです
+	// UpdateFields と同名の列があれば、その値で Set を上書きします
+	InputFile string
+	// Set は対象のすべてのアイデンティティに設定する値です（フィールド名 → 値）
+	Set         map[string]string
+	DryRun      bool
+	AutoApprove bool
+	// Interval は更新APIを連続して呼び出す際の最小間隔です
+	Interval      time.Duration
+	OutputDir     string
+	OutputDirMode string
+	// CSV は結果ファイルの文字コード・区切り文字です。列の指定は使用しません
+	CSV          CSVOptions
+	Organization *admina.Organization
+	// Stdin は確認プロンプトの入力です。nil の場合は標準入力を使い、端末でない場合は --y なしでは実行できません
+	Stdin   io.Reader
+	Version string
+	Args    []string
+}
+
+// UpdateRow は変更するアイデンティティのCSVの1行です
+// Values には値が空でない変更フィールドのみが含まれます
+type UpdateRow struct {
+	Line   int
+	Value  string
+	Values map[string]string
+}
+
+// UpdateResult は1件分の変更結果です
+// Status は Success, Skip (dry-run・変更なし・未確認), Invalid (入力の誤り), NotFound, Error のいずれかです
+type UpdateResult struct {
+	// Query は CSV で指定された値です。フィルタで選んだ場合は空です
+	Query    string
+	Line     int
+	Identity admina.Identity
+	Changes  []FieldChange
+	Status   string
+	Reason   string
+}
+
+// ParseUpdateSet は field=value 形式の指定を解析します
+// フィールド名は大文字小文字を区別せず、UpdateFields の表記に揃えます
+func ParseUpdateSet(values []string) (map[string]string, error) {
+	set := make(map[string]string)
+	for _, value := range values {
+		name, fieldValue, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --set value %q: expected field=value", value)
+		}
+		field := updateFieldName(name)
+		if field == "" {
+			return nil, fmt.Errorf("unknown field %q: must be one of %s", strings.TrimSpace(name), strings.Join(UpdateFields, ", "))
+		}
+		set[field] = strings.TrimSpace(fieldValue)
+	}
+	return set, nil
+}
+
+// updateFieldName は大文字小文字を区別せずに UpdateFields の名前を返します。該当しない場合は空です
+func updateFieldName(name string) string {
+	name = strings.TrimSpace(name)
+	for _, field := range UpdateFields {
+		if strings.EqualFold(field, name) {
+			return field
+		}
+	}
+	return ""
+}
+
+// ReadUpdateRows は変更するアイデンティティのCSVを読み込みます
+// ヘッダー行に id の列が必要です。UpdateFields と同名の列の値は行ごとの変更内容になります
+func ReadUpdateRows(path string) ([]UpdateRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open update targets: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("update targets file is empty: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read update targets header: %v", err)
+	}
+
+	idIndex := -1
+	fields := make([]string, len(headers))
+	for i, header := range headers {
+		name := strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))
+		if strings.EqualFold(name, deleteIDColumn) {
+			idIndex = i
+		}
+		fields[i] = updateFieldName(name)
+	}
+	if idIndex < 0 {
+		return nil, fmt.Errorf("update targets header must contain %q column: %s", deleteIDColumn, strings.Join(headers, ","))
+	}
+
+	var rows []UpdateRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read update targets: %v", err)
+		}
+		if idIndex >= len(record) || strings.TrimSpace(record[idIndex]) == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		row := UpdateRow{Line: line, Value: strings.TrimSpace(record[idIndex]), Values: make(map[string]string)}
+		for i, value := range record {
+			if value = strings.TrimSpace(value); i < len(fields) && fields[i] != "" && value != "" {
+				row.Values[fields[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// validateUpdateValues は変更後の値を検証します。問題がない場合は空文字を返します
+func validateUpdateValues(values map[string]string) string {
+	var reasons []string
+	if value, ok := values["employeeType"]; ok && !contains(CreateEmployeeTypes, value) {
+		reasons = append(reasons, fmt.Sprintf("unknown employeeType: %s", value))
+	}
+	if value, ok := values["employeeStatus"]; ok && !contains(CreateEmployeeStatuses, value) {
+		reasons = append(reasons, fmt.Sprintf("unknown employeeStatus: %s", value))
+	}
+	if value, ok := values["displayName"]; ok && value == "" {
+		reasons = append(reasons, "displayName must not be empty")
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// updateFieldValue は変更フィールドの現在の値を返します
+func updateFieldValue(identity admina.Identity, field string) string {
+	switch field {
+	case "displayName":
+		return identity.DisplayName
+	case "employeeType":
+		return identity.EmployeeType
+	case "employeeStatus":
+		return identity.EmployeeStatus
+	}
+	return ""
+}
+
+// diffUpdate は現在の値と異なるフィールドの変更内容を UpdateFields の順に返します
+func diffUpdate(identity admina.Identity, values map[string]string) []FieldChange {
+	var changes []FieldChange
+	for _, field := range UpdateFields {
+		after, ok := values[field]
+		if before := updateFieldValue(identity, field); ok && before != after {
+			changes = append(changes, FieldChange{Field: field, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// updateRequest は変更内容から API のリクエストを作成します
+func updateRequest(changes []FieldChange) *admina.UpdateIdentityRequest {
+	req := &admina.UpdateIdentityRequest{}
+	for _, change := range changes {
+		value := change.New
+		switch change.Field {
+		case "displayName":
+			req.DisplayName = &value
+		case "employeeType":
+			req.EmployeeType = &value
+		case "employeeStatus":
+			req.EmployeeStatus = &value
+		}
+	}
+	return req
+}
+
+// selectUpdateTargets は変更対象と変更内容を決定します
+func selectUpdateTargets(identities []admina.Identity, config *UpdateConfig, rows []UpdateRow) []UpdateResult {
+	var results []UpdateResult
+	add := func(result UpdateResult, values map[string]string) {
+		if result.Status == "" {
+			if reason := validateUpdateValues(values); reason != "" {
+				result.Status = "Invalid"
+				result.Reason = reason
+			} else if result.Changes = diffUpdate(result.Identity, values); len(result.Changes) == 0 {
+				result.Status = "Skip"
+				result.Reason = "no changes"
+			}
+		}
+		results = append(results, result)
+	}
+
+	if config.InputFile == "" {
+		for _, identity := range identities {
+			if config.Filter.matches(identity) {
+				add(UpdateResult{Identity: identity}, config.Set)
+			}
+		}
+		return results
+	}
+
+	seen := make(map[string]int)
+	for _, row := range rows {
+		identity, err := resolveTargetIdentity(identities, row.Value)
+		result := UpdateResult{Query: row.Value, Line: row.Line, Identity: identity}
+		if errors.Is(err, errIndirectMatch) {
+			result.Status = "Invalid"
+			result.Reason = err.Error()
+		} else if err != nil {
+			result.Status = "NotFound"
+			result.Reason = err.Error()
+		} else if line, ok := seen[identity.ID]; ok {
+			result.Status = "Invalid"
+			result.Reason = fmt.Sprintf("duplicate of line %d", line)
+		} else {
+			seen[identity.ID] = row.Line
+		}
+
+		values := make(map[string]string, len(config.Set)+len(row.Values))
+		for field, value := range config.Set {
+			values[field] = value
+		}
+		for field, value := range row.Values {
+			values[field] = value
+		}
+		if len(values) == 0 && result.Status == "" {
+			result.Status = "Invalid"
+			result.Reason = "no fields to update"
+		}
+		add(result, values)
+	}
+	return results
+}
+
+// UpdateIdentities はフィルタまたはCSVで指定したアイデンティティの属性を変更します
+// 変更前に差分を表示し、確認のうえで変更します
+func UpdateIdentities(client Client, config *UpdateConfig) error {
+	logger.LogInfo("Starting identity update process")
+
+	if config.InputFile == "" && (config.Filter == nil || !config.Filter.HasFilter()) {
+		return fmt.Errorf("update requires a filter or --from-csv; refusing to update all identities")
+	}
+	if config.InputFile != "" && config.Filter != nil && config.Filter.HasFilter() {
+		return fmt.Errorf("specify either a filter or --from-csv for update, not both")
+	}
+	if config.InputFile == "" && len(config.Set) == 0 {
+		return fmt.Errorf("update requires --set when using a filter")
+	}
+	if err := config.CSV.Validate(); err != nil {
+		return err
+	}
+	run, err := NewOutputRun(config.OutputDir, config.OutputDirMode, time.Now())
+	if err != nil {
+		return err
+	}
+	updater, canUpdate := client.(IdentityUpdater)
+	if !config.DryRun && !canUpdate {
+		return fmt.Errorf("client does not support updating identities")
+	}
+	var prompt *bufio.Reader
+	if !config.DryRun && !config.AutoApprove {
+		// 応答できない入力で待ち続けないよう、取得の前に確認する
+		if prompt, err = openPrompt(config.Stdin, "use --y to update without confirmation, or --dry-run to preview"); err != nil {
+			return err
+		}
+	}
+
+	var rows []UpdateRow
+	if config.InputFile != "" {
+		if rows, err = ReadUpdateRows(config.InputFile); err != nil {
+			return err
+		}
+		logger.LogInfo("Read %d update targets from %s", len(rows), config.InputFile)
+	}
+
+	identities, err := FetchAllIdentities(client)
+	if err != nil {
+		return fmt.Errorf("failed to fetch identities: %v", err)
+	}
+	results := selectUpdateTargets(identities, config, rows)
+
+	var pending []int
+	for i, result := range results {
+		if result.Status == "" {
+			pending = append(pending, i)
+		}
+	}
+	printUpdatePreview(results, len(pending))
+
+	switch {
+	case len(pending) == 0:
+		logger.LogInfo("No identities to update")
+	case config.DryRun:
+		for _, i := range pending {
+			results[i].Status = "Skip"
+			results[i].Reason = "dry-run"
+		}
+	case !config.AutoApprove && !confirmUpdate(prompt, len(pending)):
+		for _, i := range pending {
+			results[i].Status = "Skip"
+			results[i].Reason = "not confirmed"
+		}
+		if err := outputUpdateResults(results, config, run); err != nil {
+			return err
+		}
+		return fmt.Errorf("update was not confirmed: %d identities were not updated", len(pending))
+	default:
+		updateTargets(updater, config, results, pending)
+	}
+
+	if err := outputUpdateResults(results, config, run); err != nil {
+		return err
+	}
+
+	updatedCount, skippedCount, errorCount := countUpdateResults(results)
+	if errorCount > 0 {
+		return fmt.Errorf("completed with %d errors, %d updated, %d skipped", errorCount, updatedCount, skippedCount)
+	}
+	return nil
+}
+
+// printUpdatePreview は変更前後の値の差分を標準エラー出力に表示します
+func printUpdatePreview(results []UpdateResult, pendingCount int) {
+	logger.PrintErr("=== Identity Update Preview ===\n")
+	for _, result := range results {
+		label := MaskEmail(result.Identity.Email)
+		if result.Identity.ID == "" {
+			label = MaskEmail(result.Query)
+		}
+		if result.Status != "" {
+			logger.PrintErr("  - %s: %s (%s)\n", label, result.Status, result.Reason)
+			continue
+		}
+		logger.PrintErr("  - %s (%s): %s\n", label, result.Identity.ID, formatChanges(result.Changes))
+	}
+	logger.PrintErr("Matched identities: %d\n", len(results))
+	logger.PrintErr("To be updated: %d\n", pendingCount)
+}
+
+// formatChanges は変更内容を "field: before -> after" 形式でつなげます
+func formatChanges(changes []FieldChange) string {
+	parts := make([]string, 0, len(changes))
+	for _, change := range changes {
+		parts = append(parts, fmt.Sprintf("%s: %q -> %q", change.Field, change.Old, change.New))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func updateTargets(updater IdentityUpdater, config *UpdateConfig, results []UpdateResult, pending []int) {
+	ctx := context.Background()
+	throttle := newRequestThrottle(config.Interval)
+	for _, i := range pending {
+		result := &results[i]
+		throttle.Wait()
+		if _, err := updater.UpdateIdentity(ctx, result.Identity.ID, updateRequest(result.Changes)); err != nil {
+			logger.LogInfo("Failed to update %s (%s): %v", MaskEmail(result.Identity.Email), result.Identity.ID, err)
+			result.Status = "Error"
+			result.Reason = fmt.Sprintf("Failed to update: %v", err)
+			continue
+		}
+		logger.LogInfo("Successfully updated %s (%s)", MaskEmail(result.Identity.Email), result.Identity.ID)
+		result.Status = "Success"
+	}
+}
+
+func confirmUpdate(prompt *bufio.Reader, count int) bool {
+	return confirmOnce(prompt, fmt.Sprintf("Update %d identities? (y/n): ", count), "y", "yes")
+}
+
+func countUpdateResults(results []UpdateResult) (updatedCount, skippedCount, errorCount int) {
+	for _, result := range results {
+		switch result.Status {
+		case "Success":
+			updatedCount++
+		case "Skip":
+			skippedCount++
+		case "Error", "Invalid", "NotFound":
+			errorCount++
+		}
+	}
+	return
+}
+
+// updateResultHeaders は identity_update_results.csv のヘッダーです
+// 変更フィールドごとに変更前と変更後の列があります
+func updateResultHeaders() []string {
+	headers := []string{"Line", "Query", "IdentityID", "PeopleID", "Email"}
+	for _, field := range UpdateFields {
+		title := strings.ToUpper(field[:1]) + field[1:]
+		headers = append(headers, title+"Before", title+"After")
+	}
+	return append(headers, "Status", "Reason")
+}
+
+func updateResultRows(results []UpdateResult) [][]string {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		line := ""
+		if result.Line > 0 {
+			line = strconv.Itoa(result.Line)
+		}
+		row := []string{line, MaskEmail(result.Query), result.Identity.ID, peopleIDValue(result.Identity), MaskEmail(result.Identity.Email)}
+
+		changed := make(map[string]FieldChange, len(result.Changes))
+		for _, change := range result.Changes {
+			changed[change.Field] = change
+		}
+		for _, field := range UpdateFields {
+			if change, ok := changed[field]; ok {
+				row = append(row, change.Old, change.New)
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		rows = append(rows, append(row, result.Status, result.Reason))
+	}
+	return rows
+}
+
+func outputUpdateResults(results []UpdateResult, config *UpdateConfig, run *OutputRun) error {
+	if err := run.Prepare(); err != nil {
+		return err
+	}
+	csvWriter, err := NewCSVWriter(run.Dir, run.Append(), &config.CSV)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV writer: %v", err)
+	}
+	if err := csvWriter.WriteCSV(updateResultsFileName, updateResultHeaders(), updateResultRows(results)); err != nil {
+		return fmt.Errorf("failed to write update results CSV: %v", err)
+	}
+	logger.LogInfo("Update results written to %s", run.Dir)
+
+	updatedCount, skippedCount, errorCount := countUpdateResults(results)
+	manifest := newManifest("update", config.Version, config.Args, config.Organization, run, config.DryRun)
+	manifest.InputFile = config.InputFile
+	manifest.Set = sortedSet(config.Set)
+	manifest.Updated = updatedCount
+	manifest.Skipped = skippedCount
+	manifest.Errors = errorCount
+	return WriteManifest(run.Dir, manifest, []string{updateResultsFileName})
+}
+
+// sortedSet は --set の指定を field=value 形式でフィールド名順に並べます
+func sortedSet(set map[string]string) []string {
+	values := make([]string, 0, len(set))
+	for field, value := range set {
+		values = append(values, field+"="+value)
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,209 @@
+package identity_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpdateSet(t *testing.T) {
+	set, err := identity.ParseUpdateSet([]string{"EmployeeStatus=retired", "displayName = Taro Yamada"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"employeeStatus": "retired", "displayName": "Taro Yamada"}, set)
+
+	_, err = identity.ParseUpdateSet([]string{"employeeStatus"})
+	assert.ErrorContains(t, err, "expected field=value")
+	_, err = identity.ParseUpdateSet([]string{"email=a@b.com"})
+	assert.ErrorContains(t, err, `unknown field "email"`)
+}
+
+func TestReadUpdateRows(t *testing.T) {
+	rows, err := identity.ReadUpdateRows(writeCSVFile(t, "id,EmployeeStatus,memo\n100,retired,a\n200,,b\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []identity.UpdateRow{
+		{Line: 2, Value: "100", Values: map[string]string{"employeeStatus": "retired"}},
+		{Line: 3, Value: "200", Values: map[string]string{}},
+	}, rows)
+
+	_, err = identity.ReadUpdateRows(writeCSVFile(t, "email\na@b.com\n"))
+	assert.ErrorContains(t, err, `update targets header must contain "id" column`)
+}
+
+func TestUpdateIdentities(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	readResults := func(t *testing.T, outputDir string) [][]string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_update_results.csv"))
+		require.NoError(t, err)
+		return readCSV(t, content)
+	}
+	newConfig := func(t *testing.T) *identity.UpdateConfig {
+		return &identity.UpdateConfig{
+			Filter:        &identity.ListOptions{Domains: []string{"child.domain.com"}},
+			Set:           map[string]string{"employeeStatus": "retired"},
+			AutoApprove:   true,
+			OutputDir:     t.TempDir(),
+			OutputDirMode: "overwrite",
+		}
+	}
+
+	t.Run("対象または変更内容の指定がない場合は変更しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{}
+		assert.ErrorContains(t, identity.UpdateIdentities(client, config), "refusing to update all identities")
+
+		config = newConfig(t)
+		config.Set = nil
+		assert.ErrorContains(t, identity.UpdateIdentities(client, config), "update requires --set")
+		assert.Empty(t, client.UpdateRequests)
+	})
+
+	t.Run("dry-run では差分のみを出力する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.DryRun = true
+		require.NoError(t, identity.UpdateIdentities(client, config))
+		assert.Empty(t, client.UpdateRequests)
+
+		results := readResults(t, config.OutputDir)
+		assert.Equal(t, []string{
+			"Line", "Query", "IdentityID", "PeopleID", "Email",
+			"DisplayNameBefore", "DisplayNameAfter", "EmployeeTypeBefore", "EmployeeTypeAfter", "EmployeeStatusBefore", "EmployeeStatusAfter",
+			"Status", "Reason",
+		}, results[0])
+		assert.Equal(t, []string{"", "", "200", "202", "user1@child.domain.com", "", "", "", "", "active", "retired", "Skip", "dry-run"}, results[1])
+	})
+
+	t.Run("変更のある項目のみを送信し、結果を出力する", func(t *testing.T) {
+		client := &mock.Client{
+			Identities:   testIdentities,
+			UpdateErrors: map[string]error{"300": fmt.Errorf("403 forbidden")},
+		}
+		config := newConfig(t)
+		config.Set["displayName"] = "Renamed"
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 1 errors, 1 updated, 0 skipped")
+
+		require.Contains(t, client.UpdateRequests, "200")
+		req := client.UpdateRequests["200"]
+		assert.Equal(t, "retired", *req.EmployeeStatus)
+		assert.Equal(t, "Renamed", *req.DisplayName)
+		assert.Nil(t, req.EmployeeType)
+		// 共有のテストデータは変更されない
+		assert.Equal(t, "active", testIdentities[1].EmployeeStatus)
+
+		results := readResults(t, config.OutputDir)
+		assert.Equal(t, []string{"Success", ""}, results[1][11:])
+		assert.Equal(t, []string{"Error", "Failed to update: 403 forbidden"}, results[2][11:])
+
+		manifest, err := identity.ReadManifest(config.OutputDir)
+		require.NoError(t, err)
+		assert.Equal(t, "update", manifest.Command)
+		assert.Equal(t, []string{"displayName=Renamed", "employeeStatus=retired"}, manifest.Set)
+		assert.Equal(t, 1, manifest.Updated)
+		assert.Equal(t, 1, manifest.Errors)
+	})
+
+	t.Run("CSV の行ごとの値で変更する", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{}
+		config.Set = map[string]string{"employeeStatus": "on_leave"}
+		config.InputFile = writeCSVFile(t, "id,employeeStatus,employeeType\n"+
+			"100,retired,\n"+
+			"user1@child.domain.com,active,\n"+
+			"202,,other\n"+
+			"300,,ninja\n"+
+			"nobody@example.com,,\n")
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 3 errors, 1 updated, 1 skipped")
+		assert.Equal(t, "retired", *client.UpdateRequests["100"].EmployeeStatus)
+		assert.Len(t, client.UpdateRequests, 1)
+
+		results := readResults(t, config.OutputDir)
+		require.Len(t, results, 6)
+		assert.Equal(t, []string{"Skip", "no changes"}, results[2][11:])
+		assert.Equal(t, []string{"Invalid", "duplicate of line 3"}, results[3][11:])
+		assert.Equal(t, []string{"Invalid", "unknown employeeType: ninja"}, results[4][11:])
+		assert.Equal(t, "NotFound", results[5][11])
+	})
+
+	t.Run("セカンダリーメールにのみ一致する行は変更しない", func(t *testing.T) {
+		identities := append(append([]admina.Identity{}, testIdentities...),
+			admina.Identity{ID: "400", PeopleID: 401, ManagementType: "external", Email: "new@child.domain.com", SecondaryEmails: []string{"old@child.domain.com"}})
+		client := &mock.Client{Identities: identities}
+		config := newConfig(t)
+		config.Filter = &identity.ListOptions{}
+		config.InputFile = writeCSVFile(t, "id\nold@child.domain.com\nNEW@child.domain.com\n")
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "completed with 1 errors, 1 updated, 0 skipped")
+		assert.Len(t, client.UpdateRequests, 1)
+		assert.Contains(t, client.UpdateRequests, "400")
+
+		results := readResults(t, config.OutputDir)
+		require.Len(t, results, 3)
+		assert.Equal(t, []string{"Invalid", "identity old@child.domain.com matches only a secondary or merged email of new@child.domain.com (400); specify its identity ID or primary email"}, results[1][11:])
+		assert.Equal(t, []string{"3", "NEW@child.domain.com", "400"}, results[2][:3])
+	})
+
+	t.Run("確認で拒否された場合は変更せずエラーを返す", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.AutoApprove = false
+		config.Stdin = strings.NewReader("n\n")
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "update was not confirmed: 2 identities were not updated")
+		assert.Empty(t, client.UpdateRequests)
+		assert.Equal(t, []string{"Skip", "not confirmed"}, readResults(t, config.OutputDir)[1][11:])
+	})
+
+	t.Run("入力が終了した場合は変更せずエラーを返す", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.AutoApprove = false
+		config.Stdin = strings.NewReader("")
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "update was not confirmed: 2 identities were not updated")
+		assert.Empty(t, client.UpdateRequests)
+		assert.Equal(t, []string{"Skip", "not confirmed"}, readResults(t, config.OutputDir)[1][11:])
+	})
+
+	t.Run("端末でない標準入力では --y なしで実行しない", func(t *testing.T) {
+		client := &mock.Client{Identities: testIdentities}
+		config := newConfig(t)
+		config.AutoApprove = false
+		withStdin(t, "y\n")
+		err := identity.UpdateIdentities(client, config)
+		assert.ErrorContains(t, err, "stdin is not a terminal: use --y to update without confirmation")
+		assert.Empty(t, client.UpdateRequests)
+	})
+}
+
+// withStdin はテストの間だけ標準入力を input に置き換えます
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	require.NoError(t, os.WriteFile(path, []byte(input), 0644))
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	original := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = original
+		file.Close()
+	})
+}
@@ -0,0 +1,579 @@
+package identity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+)
+
+// --where で使用する小さな式言語です
+//
+//	expr       := or
+//	or         := and ( "||" and )*
+//	and        := unary ( "&&" unary )*
+//	unary      := "!" unary | "(" expr ")" | comparison | boolField
+//	comparison := field op value
+//	op         := "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" | "not in"
+//	              | "contains" | "startsWith" | "endsWith"
+//	value      := string | number | true | false | "[" value ( "," value )* "]"
+//
+// 文字列の比較は大文字小文字を区別しません。
+
+// whereFieldType はフィールドの値の型です
+type whereFieldType int
+
+const (
+	whereString whereFieldType = iota
+	whereNumber
+	whereBool
+	whereList
+)
+
+func (t whereFieldType) String() string {
+	switch t {
+	case whereNumber:
+		return "number"
+	case whereBool:
+		return "bool"
+	case whereList:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+// whereFieldList は式で参照できるフィールドとその型です
+// whereFields と WhereFields はこの一覧から作成するため、フィールドの追加はここだけで行います
+var whereFieldList = []struct {
+	name      string
+	fieldType whereFieldType
+}{
+	{"id", whereString},
+	{"peopleId", whereNumber},
+	{"displayName", whereString},
+	{"email", whereString},
+	{"domain", whereString},
+	{"localPart", whereString},
+	{"managementType", whereString},
+	{"employeeType", whereString},
+	{"employeeStatus", whereString},
+	{"secondaryEmails", whereList},
+	{"mergedPeople", whereNumber},
+	{"hasSecondaryEmails", whereBool},
+	{"hasMergedPeople", whereBool},
+}
+
+// whereFields はフィールド名からその型を引きます
+var whereFields = func() map[string]whereFieldType {
+	fields := make(map[string]whereFieldType, len(whereFieldList))
+	for _, field := range whereFieldList {
+		fields[field.name] = field.fieldType
+	}
+	return fields
+}()
+
+// WhereFields は式で参照できるフィールド名の一覧です。エラーメッセージやヘルプはこの順に表示します
+var WhereFields = func() []string {
+	names := make([]string, 0, len(whereFieldList))
+	for _, field := range whereFieldList {
+		names = append(names, field.name)
+	}
+	return names
+}()
+
+// WhereError は式の構文エラーです
+type WhereError struct {
+	Source string
+	Pos    int
+	Msg    string
+}
+
+func (e *WhereError) Error() string {
+	return fmt.Sprintf("invalid where expression at column %d: %s\n  %s\n  %s^",
+		e.Pos+1, e.Msg, e.Source, strings.Repeat(" ", len([]rune(e.Source[:e.Pos]))))
+}
+
+// Where は解析済みの絞り込み条件です。nil の場合は全てに一致します
+type Where struct {
+	source string
+	root   whereNode
+}
+
+// ParseWhere は式を解析します
+func ParseWhere(source string) (*Where, error) {
+	tokens, err := tokenizeWhere(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &whereParser{source: source, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok.describe())
+	}
+	return &Where{source: source, root: root}, nil
+}
+
+// String は元の式を返します
+func (w *Where) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.source
+}
+
+// Match はアイデンティティが条件に一致するかを返します
+func (w *Where) Match(identity admina.Identity) bool {
+	if w == nil {
+		return true
+	}
+	return w.root.eval(identity)
+}
+
+// FilterIdentities は条件に一致するアイデンティティを返します
+func FilterIdentities(identities []admina.Identity, where *Where) []admina.Identity {
+	if where == nil {
+		return identities
+	}
+	filtered := make([]admina.Identity, 0, len(identities))
+	for _, identity := range identities {
+		if where.Match(identity) {
+			filtered = append(filtered, identity)
+		}
+	}
+	return filtered
+}
+
+// ---- 字句解析 ----
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value string
+	pos   int
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func tokenizeWhere(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	// pos はバイト単位の位置です（エラー表示で元の文字列を切り出すため）
+	bytePos := func(i int) int { return len(string(runes[:i])) }
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: bytePos(i)})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: bytePos(i)})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "[", pos: bytePos(i)})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]", pos: bytePos(i)})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: bytePos(i)})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var value strings.Builder
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &WhereError{Source: source, Pos: bytePos(start), Msg: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start:i]), value: value.String(), pos: bytePos(start)})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: text, pos: bytePos(start)})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			text := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenIdent, text: text, value: text, pos: bytePos(start)})
+		default:
+			start := i
+			matched := ""
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" {
+				msg := fmt.Sprintf("unexpected character %q", r)
+				if r == '=' {
+					msg += " (use == for equality)"
+				}
+				return nil, &WhereError{Source: source, Pos: bytePos(start), Msg: msg}
+			}
+			i += len([]rune(matched))
+			tokens = append(tokens, token{kind: tokenOp, text: matched, value: matched, pos: bytePos(start)})
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(source)})
+	return tokens, nil
+}
+
+// ---- 構文解析 ----
+
+type whereParser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *whereParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *whereParser) errorf(tok token, format string, args ...interface{}) error {
+	return &WhereError{Source: p.source, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseUnary() (whereNode, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenOp && tok.text == "!":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	case tok.kind == tokenLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected \")\", got %s", closing.describe())
+		}
+		return inner, nil
+	case tok.kind == tokenIdent:
+		return p.parseComparison()
+	default:
+		return nil, p.errorf(tok, "expected field name, \"!\" or \"(\", got %s", tok.describe())
+	}
+}
+
+func (p *whereParser) parseComparison() (whereNode, error) {
+	fieldTok := p.next()
+	fieldType, ok := whereFields[fieldTok.text]
+	if !ok {
+		return nil, p.errorf(fieldTok, "unknown field %q (available: %s)", fieldTok.text, strings.Join(WhereFields, ", "))
+	}
+
+	opTok := p.peek()
+	op, isOp := p.comparisonOperator()
+	if !isOp {
+		if fieldType == whereBool {
+			return &compareNode{field: fieldTok.text, op: "==", values: []string{"true"}}, nil
+		}
+		return nil, p.errorf(opTok, "expected operator after %q, got %s", fieldTok.text, opTok.describe())
+	}
+
+	if err := checkOperator(fieldType, op); err != nil {
+		return nil, p.errorf(opTok, "%s cannot be used with %s field %q", op, fieldType, fieldTok.text)
+	}
+
+	var values []string
+	var err error
+	if op == "in" || op == "not in" {
+		values, err = p.parseList(fieldType)
+	} else {
+		var value string
+		value, err = p.parseValue(fieldType, op)
+		values = []string{value}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &compareNode{field: fieldTok.text, op: op, values: values}, nil
+}
+
+// comparisonOperator は比較演算子を読み進めます
+func (p *whereParser) comparisonOperator() (string, bool) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenOp && tok.text != "&&" && tok.text != "||" && tok.text != "!":
+		p.next()
+		return tok.text, true
+	case tok.kind == tokenIdent && (tok.text == "in" || tok.text == "contains" || tok.text == "startsWith" || tok.text == "endsWith"):
+		p.next()
+		return tok.text, true
+	case tok.kind == tokenIdent && tok.text == "not" && p.tokens[p.pos+1].kind == tokenIdent && p.tokens[p.pos+1].text == "in":
+		p.next()
+		p.next()
+		return "not in", true
+	}
+	return "", false
+}
+
+func checkOperator(fieldType whereFieldType, op string) error {
+	allowed := map[whereFieldType][]string{
+		whereString: {"==", "!=", "in", "not in", "contains", "startsWith", "endsWith"},
+		whereNumber: {"==", "!=", "<", "<=", ">", ">=", "in", "not in"},
+		whereBool:   {"==", "!="},
+		whereList:   {"contains"},
+	}
+	if contains(allowed[fieldType], op) {
+		return nil
+	}
+	return fmt.Errorf("operator not allowed")
+}
+
+func (p *whereParser) parseList(fieldType whereFieldType) ([]string, error) {
+	if open := p.next(); open.kind != tokenLBracket {
+		return nil, p.errorf(open, "expected \"[\", got %s", open.describe())
+	}
+
+	var values []string
+	for {
+		value, err := p.parseValue(fieldType, "in")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		sep := p.next()
+		if sep.kind == tokenRBracket {
+			return values, nil
+		}
+		if sep.kind != tokenComma {
+			return nil, p.errorf(sep, "expected \",\" or \"]\", got %s", sep.describe())
+		}
+	}
+}
+
+func (p *whereParser) parseValue(fieldType whereFieldType, op string) (string, error) {
+	tok := p.next()
+	switch fieldType {
+	case whereNumber:
+		if tok.kind != tokenNumber {
+			return "", p.errorf(tok, "expected number, got %s", tok.describe())
+		}
+		if _, err := strconv.Atoi(tok.value); err != nil {
+			return "", p.errorf(tok, "number %s is out of range", tok.text)
+		}
+	case whereBool:
+		if tok.kind != tokenIdent || (tok.text != "true" && tok.text != "false") {
+			return "", p.errorf(tok, "expected true or false, got %s", tok.describe())
+		}
+	default:
+		if tok.kind != tokenString {
+			return "", p.errorf(tok, "expected quoted string after %s, got %s", op, tok.describe())
+		}
+	}
+	return tok.value, nil
+}
+
+// ---- 評価 ----
+
+type whereNode interface {
+	eval(identity admina.Identity) bool
+}
+
+type orNode struct{ left, right whereNode }
+
+func (n *orNode) eval(identity admina.Identity) bool {
+	return n.left.eval(identity) || n.right.eval(identity)
+}
+
+type andNode struct{ left, right whereNode }
+
+func (n *andNode) eval(identity admina.Identity) bool {
+	return n.left.eval(identity) && n.right.eval(identity)
+}
+
+type notNode struct{ operand whereNode }
+
+func (n *notNode) eval(identity admina.Identity) bool {
+	return !n.operand.eval(identity)
+}
+
+type compareNode struct {
+	field  string
+	op     string
+	values []string
+}
+
+func (n *compareNode) eval(identity admina.Identity) bool {
+	switch whereFields[n.field] {
+	case whereNumber:
+		return n.evalNumber(whereNumberValue(identity, n.field))
+	case whereBool:
+		actual := strconv.FormatBool(whereBoolValue(identity, n.field))
+		return (actual == n.values[0]) == (n.op == "==")
+	case whereList:
+		for _, item := range identity.SecondaryEmails {
+			if strings.EqualFold(item, n.values[0]) {
+				return true
+			}
+		}
+		return false
+	default:
+		return n.evalString(whereStringValue(identity, n.field))
+	}
+}
+
+func (n *compareNode) evalString(actual string) bool {
+	actual = strings.ToLower(actual)
+	expected := strings.ToLower(n.values[0])
+	switch n.op {
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case "contains":
+		return strings.Contains(actual, expected)
+	case "startsWith":
+		return strings.HasPrefix(actual, expected)
+	case "endsWith":
+		return strings.HasSuffix(actual, expected)
+	case "in", "not in":
+		return matchesAny(n.values, actual) == (n.op == "in")
+	}
+	return false
+}
+
+func (n *compareNode) evalNumber(actual int) bool {
+	if n.op == "in" || n.op == "not in" {
+		found := false
+		for _, value := range n.values {
+			if expected, _ := strconv.Atoi(value); expected == actual {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	}
+
+	expected, _ := strconv.Atoi(n.values[0])
+	switch n.op {
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	}
+	return false
+}
+
+func whereStringValue(identity admina.Identity, field string) string {
+	if field == "localPart" {
+		return ExtractLocalPart(identity.Email)
+	}
+	return fieldValue(identity, field)
+}
+
+func whereNumberValue(identity admina.Identity, field string) int {
+	if field == "mergedPeople" {
+		return len(identity.MergedPeople)
+	}
+	return identity.PeopleID
+}
+
+func whereBoolValue(identity admina.Identity, field string) bool {
+	if field == "hasMergedPeople" {
+		return len(identity.MergedPeople) > 0
+	}
+	return len(identity.SecondaryEmails) > 0
+}
@@ -0,0 +1,151 @@
+package identity_test
+
+import (
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereMatch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expression  string
+		expectedIDs []string
+	}{
+		{"等価", `managementType == "managed"`, []string{"100", "300"}},
+		{"大文字小文字を区別しない", `managementType == "MANAGED"`, []string{"100", "300"}},
+		{"不等価", `employeeStatus != "active"`, []string{"300"}},
+		{"in", `domain in ["child.domain.com", "other.com"]`, []string{"200"}},
+		{"not in", `domain not in ["child.domain.com"]`, []string{"100", "300"}},
+		{"AND", `managementType == "managed" && employeeStatus == "active"`, []string{"100"}},
+		{"OR", `peopleId == 202 || employeeStatus == "retired"`, []string{"200", "300"}},
+		{"優先順位", `peopleId == 202 || managementType == "managed" && employeeStatus == "retired"`, []string{"200", "300"}},
+		{"括弧", `(peopleId == 202 || managementType == "managed") && employeeStatus == "active"`, []string{"100", "200"}},
+		{"否定", `!(managementType == "managed")`, []string{"200"}},
+		{"真偽値フィールド", `hasSecondaryEmails`, []string{"100"}},
+		{"真偽値フィールドの否定", `!hasSecondaryEmails && managementType == "managed"`, []string{"300"}},
+		{"真偽値の比較", `hasSecondaryEmails == false`, []string{"200", "300"}},
+		{"数値の大小", `peopleId >= 202`, []string{"200", "300"}},
+		{"数値のin", `peopleId in [101, 303]`, []string{"100", "300"}},
+		{"部分一致", `displayName contains "tana"`, []string{"300"}},
+		{"前方一致", `email startsWith "hana"`, []string{"200"}},
+		{"後方一致", `email endsWith "@parent.domain.com"`, []string{"100", "300"}},
+		{"ローカルパート", `localPart == 'taro'`, []string{"100"}},
+		{"リストの包含", `secondaryEmails contains "TARO@child.domain.com"`, []string{"100"}},
+		{"統合済みPeople数", `mergedPeople == 0`, []string{"100", "200", "300"}},
+		{"エスケープ", `displayName != "a\"b"`, []string{"100", "200", "300"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			where, err := identity.ParseWhere(tc.expression)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, matched := range identity.FilterIdentities(listTestIdentities, where) {
+				ids = append(ids, matched.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expression, where.String())
+		})
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		expression string
+		column     int
+		message    string
+	}{
+		{"未知のフィールド", `status == "active"`, 1, `unknown field "status"`},
+		{"代入演算子", `managementType = "managed"`, 16, `use == for equality`},
+		{"引用符のない文字列", `managementType == managed`, 19, `expected quoted string after ==, got "managed"`},
+		{"閉じていない文字列", `managementType == "managed`, 19, "unterminated string"},
+		{"閉じていない括弧", `(peopleId == 1`, 15, `expected ")", got end of expression`},
+		{"数値フィールドに文字列", `peopleId == "1"`, 13, "expected number"},
+		{"範囲外の数値", `peopleId == 99999999999999999999`, 13, "number 99999999999999999999 is out of range"},
+		{"リスト内の範囲外の数値", `peopleId in [1, -99999999999999999999]`, 17, "number -99999999999999999999 is out of range"},
+		{"文字列フィールドに大小比較", `email > "a"`, 7, `> cannot be used with string field "email"`},
+		{"リストフィールドに等価", `secondaryEmails == "a"`, 17, `== cannot be used with list field "secondaryEmails"`},
+		{"演算子の欠落", `managementType "managed"`, 16, `expected operator after "managementType"`},
+		{"末尾の余分なトークン", `hasMergedPeople hasSecondaryEmails`, 17, `unexpected "hasSecondaryEmails"`},
+		{"空のAND", `hasMergedPeople &&`, 19, "expected field name"},
+		{"不正なリスト", `domain in ["a.com" "b.com"]`, 20, `expected "," or "]"`},
+		{"空の式", ``, 1, "expected field name"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := identity.ParseWhere(tc.expression)
+			require.Error(t, err)
+
+			var whereErr *identity.WhereError
+			require.ErrorAs(t, err, &whereErr)
+			assert.Equal(t, tc.column, whereErr.Pos+1)
+			assert.Contains(t, whereErr.Msg, tc.message)
+		})
+	}
+}
+
+func TestWhereErrorMessage(t *testing.T) {
+	_, err := identity.ParseWhere(`domain == "a.com" && status == "active"`)
+	require.Error(t, err)
+	assert.Equal(t, "invalid where expression at column 22: unknown field \"status\" (available: id, peopleId, displayName, email, domain, localPart, managementType, employeeType, employeeStatus, secondaryEmails, mergedPeople, hasSecondaryEmails, hasMergedPeople)\n"+
+		"  domain == \"a.com\" && status == \"active\"\n"+
+		"                       ^", err.Error())
+}
+
+func TestWhereFieldsAreParsable(t *testing.T) {
+	for _, field := range identity.WhereFields {
+		_, err := identity.ParseWhere(field + ` == "x"`)
+		if err != nil {
+			assert.NotContains(t, err.Error(), "unknown field", field)
+		}
+	}
+}
+
+func TestNilWhereMatchesAll(t *testing.T) {
+	var where *identity.Where
+	assert.True(t, where.Match(admina.Identity{}))
+	assert.Len(t, identity.FilterIdentities(listTestIdentities, nil), len(listTestIdentities))
+}
+
+func TestWhereWithCommands(t *testing.T) {
+	logger.Init()
+
+	where, err := identity.ParseWhere(`managementType == "managed"`)
+	require.NoError(t, err)
+
+	t.Run("matrix", func(t *testing.T) {
+		matrix, err := identity.GetIdentityMatrix(&mock.Client{Identities: listTestIdentities}, &identity.MatrixOptions{Where: where})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"managed"}, matrix.Rows)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := identity.ListIdentities(listTestIdentities, &identity.ListOptions{Where: where, Fields: []string{"id"}})
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"100"}, {"300"}}, list.Rows)
+	})
+
+	t.Run("samemerge", func(t *testing.T) {
+		// 子ドメインのexternalアイデンティティが除外されるため、マージは行われない
+		mockClient := &mock.Client{Identities: testIdentities}
+		err := identity.MergeIdentities(mockClient, &identity.MergeConfig{
+			ParentDomain: "parent.domain.com",
+			ChildDomains: []string{"child.domain.com"},
+			AutoApprove:  true,
+			OutputFormat: "json",
+			OutputDir:    t.TempDir(),
+			Where:        where,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, mockClient.MergeResults)
+	})
+}
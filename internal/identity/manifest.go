@@ -0,0 +1,173 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+)
+
+// ManifestFileName は実行ごとに出力ディレクトリへ書き出すマニフェストのファイル名です
+const ManifestFileName = "manifest.json"
+
+// redactedValue は秘密情報を含む引数の置き換え後の値です
+const redactedValue = "[REDACTED]"
+
+// secretArgKeywords を名前に含むフラグの値はマニフェストに記録しません
+var secretArgKeywords = []string{"key", "token", "secret", "password"}
+
+// Manifest は出力がどのように作成されたかを監査のために記録します
+type Manifest struct {
+	Version           string                `json:"version"`
+	Command           string                `json:"command"`
+	RunID             string                `json:"runId"`
+	Args              []string              `json:"args"`
+	Organization      *ManifestOrganization `json:"organization,omitempty"`
+	ParentDomain      string                `json:"parentDomain,omitempty"`
+	ChildDomains      []string              `json:"childDomains,omitempty"`
+	PairsFile         string                `json:"pairsFile,omitempty"`
+	DecisionsFile     string                `json:"decisionsFile,omitempty"`
+	AfterMerge        string                `json:"afterMerge,omitempty"`
+	MinNameSimilarity float64               `json:"minNameSimilarity,omitempty"`
+	InputFile         string                `json:"inputFile,omitempty"`
+	Set               []string              `json:"set,omitempty"`
+	DryRun            bool                  `json:"dryRun"`
+	OutputFormat      string                `json:"outputFormat,omitempty"`
+	OutputDirMode     string                `json:"outputDirMode"`
+	CSVSchema         int                   `json:"csvSchemaVersion,omitempty"`
+	StartedAt         time.Time             `json:"startedAt"`
+	FinishedAt        time.Time             `json:"finishedAt"`
+	Summary           *MergeSummary         `json:"summary,omitempty"`
+	Merged            int                   `json:"merged,omitempty"`
+	Created           int                   `json:"created,omitempty"`
+	Deleted           int                   `json:"deleted,omitempty"`
+	Updated           int                   `json:"updated,omitempty"`
+	Skipped           int                   `json:"skipped"`
+	Errors            int                   `json:"errors"`
+	Files             []ManifestFile        `json:"files"`
+}
+
+// ManifestOrganization はマニフェストに記録する組織情報です
+type ManifestOrganization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// newManifest は全コマンドに共通の項目を設定したマニフェストを作成します
+func newManifest(command, version string, args []string, organization *admina.Organization, run *OutputRun, dryRun bool) *Manifest {
+	manifest := &Manifest{
+		Version:       version,
+		Command:       command,
+		RunID:         run.RunID,
+		Args:          RedactArgs(args),
+		DryRun:        dryRun,
+		OutputDirMode: run.Mode,
+		StartedAt:     run.StartedAt,
+		FinishedAt:    time.Now(),
+	}
+	if organization != nil {
+		manifest.Organization = &ManifestOrganization{ID: organization.ID, Name: organization.Name}
+	}
+	return manifest
+}
+
+// ManifestFile は出力したファイルと検証用のチェックサムです
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// RedactArgs は秘密情報を含むフラグの値を置き換えた引数を返します
+// --api-key=xxx と --api-key xxx のどちらの形式にも対応します
+func RedactArgs(args []string) []string {
+	redacted := make([]string, 0, len(args))
+	redactNext := false
+	for _, arg := range args {
+		if redactNext {
+			redacted = append(redacted, redactedValue)
+			redactNext = false
+			continue
+		}
+
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !isSecretArg(name) {
+			redacted = append(redacted, arg)
+			continue
+		}
+		if hasValue {
+			redacted = append(redacted, arg[:strings.Index(arg, "=")+1]+redactedValue)
+		} else {
+			redacted = append(redacted, arg)
+			redactNext = true
+		}
+	}
+	return redacted
+}
+
+func isSecretArg(name string) bool {
+	name = strings.ToLower(name)
+	for _, keyword := range secretArgKeywords {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteManifest は出力ファイルのチェックサムを計算し、manifest.json を dir に書き出します
+func WriteManifest(dir string, manifest *Manifest, files []string) error {
+	manifest.Files = make([]ManifestFile, 0, len(files))
+	for _, name := range files {
+		file, err := checksumFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		file.Name = name
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
+
+// ReadManifest は manifest.json を読み込みます
+func ReadManifest(dir string) (*Manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+func checksumFile(path string) (ManifestFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to open %s for checksum: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to read %s for checksum: %v", path, err)
+	}
+	return ManifestFile{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
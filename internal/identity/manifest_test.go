@@ -0,0 +1,73 @@
+package identity_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"identity", "samemerge", "--api-key=abc", "--token", "xyz", "--parent-domain", "parent.domain.com", "-secret", "s"}
+	assert.Equal(t, []string{
+		"identity", "samemerge", "--api-key=[REDACTED]", "--token", "[REDACTED]", "--parent-domain", "parent.domain.com", "-secret", "[REDACTED]",
+	}, identity.RedactArgs(args))
+}
+
+func TestMergeIdentitiesManifest(t *testing.T) {
+	logger.Init()
+
+	outputDir := t.TempDir()
+	err := identity.MergeIdentities(&mock.Client{Identities: testIdentities}, &identity.MergeConfig{
+		ParentDomain: "parent.domain.com",
+		ChildDomains: []string{"child.domain.com"},
+		DryRun:       true,
+		AutoApprove:  true,
+		OutputFormat: "html",
+		OutputDir:    outputDir,
+		Organization: htmlTestOrganization,
+		Version:      "1.2.3",
+		Args:         []string{"identity", "samemerge", "--api-key", "abc", "--dry-run"},
+	})
+	require.NoError(t, err)
+
+	runDir, err := identity.LatestOutputDir(outputDir)
+	require.NoError(t, err)
+	manifest, err := identity.ReadManifest(runDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.2.3", manifest.Version)
+	assert.Equal(t, "samemerge", manifest.Command)
+	assert.Equal(t, []string{"identity", "samemerge", "--api-key", "[REDACTED]", "--dry-run"}, manifest.Args)
+	assert.Equal(t, &identity.ManifestOrganization{ID: 123, Name: "Test <Org>"}, manifest.Organization)
+	assert.Equal(t, "parent.domain.com", manifest.ParentDomain)
+	assert.Equal(t, []string{"child.domain.com"}, manifest.ChildDomains)
+	assert.True(t, manifest.DryRun)
+	assert.Equal(t, "timestamped", manifest.OutputDirMode)
+	assert.False(t, manifest.FinishedAt.Before(manifest.StartedAt))
+	assert.Equal(t, 3, manifest.Summary.TotalIdentities)
+	assert.Equal(t, 1, manifest.Summary.MergeCandidates)
+	assert.Equal(t, 0, manifest.Merged)
+	assert.Equal(t, 1, manifest.Skipped)
+	assert.Equal(t, 0, manifest.Errors)
+
+	// 記録されたチェックサムで成果物を検証できる
+	require.Len(t, manifest.Files, 3)
+	names := make([]string, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		names = append(names, file.Name)
+		content, err := os.ReadFile(filepath.Join(runDir, file.Name))
+		require.NoError(t, err)
+		sum := sha256.Sum256(content)
+		assert.Equal(t, hex.EncodeToString(sum[:]), file.SHA256, file.Name)
+		assert.Equal(t, int64(len(content)), file.Size, file.Name)
+	}
+	assert.Equal(t, []string{"identity_mappings.csv", "unmapped_child_identities.csv", identity.MergeReportFileName}, names)
+}
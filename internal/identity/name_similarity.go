@@ -0,0 +1,191 @@
+package identity
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameSimilarity は2つの表示名の類似度を 0〜1 で返します
+// 全角・半角、大文字小文字、空白・記号の違いを除き、かなはローマ字に変換してから比較します
+// ローマ字はヘボン式と訓令式の違い (shi/si, tsu/tu)、長音 (ou, oo, oh) を同じ綴りにそろえます
+// 姓名の順序が異なる場合 (Yamada Taro / Taro Yamada) も考慮し、高い方の値を返します
+// 括弧で囲んだ注記 (山田 太郎 (業務委託)) は比較に含めません
+// 漢字の読みは推定できないため、漢字とローマ字の表示名は低い値になります
+// どちらかの表示名が空の場合は 0 を返します
+func NameSimilarity(a, b string) float64 {
+	tokensA, tokensB := nameTokens(a), nameTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	score := stringSimilarity(strings.Join(tokensA, ""), strings.Join(tokensB, ""))
+	sort.Strings(tokensA)
+	sort.Strings(tokensB)
+	if sorted := stringSimilarity(strings.Join(tokensA, ""), strings.Join(tokensB, "")); sorted > score {
+		score = sorted
+	}
+	return roundScore(score)
+}
+
+// nameAnnotation は表示名に付けられた括弧書きの注記です
+var nameAnnotation = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]|【[^】]*】`)
+
+// nameTokens は表示名を正規化した語に分割します
+func nameTokens(name string) []string {
+	name = strings.ToLower(norm.NFKC.String(name))
+	name = nameAnnotation.ReplaceAllString(name, " ")
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '・' || r == ',' || r == '.' || r == '-' || r == '_' || r == '/'
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		token := canonicalRomaji(kanaToRomaji(field))
+		token = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, token)
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// katakanaRomaji はカタカナの訓令式のローマ字です。ひらがなはカタカナに変換してから引きます
+var katakanaRomaji = map[rune]string{
+	'ア': "a", 'イ': "i", 'ウ': "u", 'エ': "e", 'オ': "o",
+	'カ': "ka", 'キ': "ki", 'ク': "ku", 'ケ': "ke", 'コ': "ko",
+	'ガ': "ga", 'ギ': "gi", 'グ': "gu", 'ゲ': "ge", 'ゴ': "go",
+	'サ': "sa", 'シ': "si", 'ス': "su", 'セ': "se", 'ソ': "so",
+	'ザ': "za", 'ジ': "zi", 'ズ': "zu", 'ゼ': "ze", 'ゾ': "zo",
+	'タ': "ta", 'チ': "ti", 'ツ': "tu", 'テ': "te", 'ト': "to",
+	'ダ': "da", 'ヂ': "zi", 'ヅ': "zu", 'デ': "de", 'ド': "do",
+	'ナ': "na", 'ニ': "ni", 'ヌ': "nu", 'ネ': "ne", 'ノ': "no",
+	'ハ': "ha", 'ヒ': "hi", 'フ': "hu", 'ヘ': "he", 'ホ': "ho",
+	'バ': "ba", 'ビ': "bi", 'ブ': "bu", 'ベ': "be", 'ボ': "bo",
+	'パ': "pa", 'ピ': "pi", 'プ': "pu", 'ペ': "pe", 'ポ': "po",
+	'マ': "ma", 'ミ': "mi", 'ム': "mu", 'メ': "me", 'モ': "mo",
+	'ヤ': "ya", 'ユ': "yu", 'ヨ': "yo",
+	'ラ': "ra", 'リ': "ri", 'ル': "ru", 'レ': "re", 'ロ': "ro",
+	'ワ': "wa", 'ヰ': "i", 'ヱ': "e", 'ヲ': "o", 'ン': "n", 'ヴ': "bu",
+	'ァ': "a", 'ィ': "i", 'ゥ': "u", 'ェ': "e", 'ォ': "o",
+}
+
+// kanaToRomaji はかなをローマ字に変換します。かな以外の文字はそのまま残します
+func kanaToRomaji(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		// ひらがなはカタカナにそろえる
+		if r >= 'ぁ' && r <= 'ゖ' {
+			runes[i] = r + 0x60
+		}
+	}
+
+	var b strings.Builder
+	doubled := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case 'ッ':
+			// 促音は次の子音を重ねる
+			doubled = true
+			continue
+		case 'ー':
+			// 長音は canonicalRomaji で母音の重なりと同じように扱う
+			continue
+		}
+
+		romaji, ok := katakanaRomaji[r]
+		if !ok {
+			b.WriteRune(r)
+			doubled = false
+			continue
+		}
+		if i+1 < len(runes) {
+			switch next := runes[i+1]; next {
+			case 'ャ', 'ュ', 'ョ':
+				// 拗音: キャ -> kya, シャ -> sya
+				if strings.HasSuffix(romaji, "i") && len(romaji) > 1 {
+					romaji = strings.TrimSuffix(romaji, "i") + katakanaRomaji[next+1]
+					i++
+				}
+			case 'ァ', 'ィ', 'ゥ', 'ェ', 'ォ':
+				// 小書きの母音は直前の母音を置き換える: フォ -> ho, ティ -> ti
+				if len(romaji) > 1 {
+					romaji = romaji[:len(romaji)-1] + katakanaRomaji[next]
+					i++
+				}
+			}
+		}
+		if doubled && romaji[0] != 'n' && !strings.ContainsRune("aiueo", rune(romaji[0])) {
+			b.WriteByte(romaji[0])
+		}
+		doubled = false
+		b.WriteString(romaji)
+	}
+	return b.String()
+}
+
+// romajiSpellings はヘボン式などの綴りを kanaToRomaji と同じ訓令式にそろえます
+var romajiSpellings = strings.NewReplacer(
+	"sha", "sya", "shu", "syu", "sho", "syo", "she", "sye", "shi", "si",
+	"cha", "tya", "chu", "tyu", "cho", "tyo", "che", "tye", "chi", "ti",
+	"tsu", "tu",
+	"ja", "zya", "ju", "zyu", "jo", "zyo", "je", "zye", "ji", "zi",
+	"f", "h", "v", "b",
+	"mb", "nb", "mp", "np",
+)
+
+var (
+	// romajiLongOh は Ohno のような子音の前の oh です。母音の前 (Ohashi の h) は子音として残します
+	romajiLongOh = regexp.MustCompile(`oh([^aiueoy]|$)`)
+	// romajiLongVowels は長音の綴りの違い (Satou, Satoo, Sato) をそろえます
+	romajiLongVowels = strings.NewReplacer("ou", "o", "oo", "o", "uu", "u")
+)
+
+// canonicalRomaji はローマ字の綴りの違いをそろえます
+func canonicalRomaji(s string) string {
+	s = romajiSpellings.Replace(s)
+	s = romajiLongOh.ReplaceAllString(s, "o$1")
+	return romajiLongVowels.Replace(s)
+}
+
+// stringSimilarity は編集距離から 0〜1 の類似度を求めます
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
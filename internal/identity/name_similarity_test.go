@@ -0,0 +1,105 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/admina"
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"同じ表示名", "Taro Yamada", "Taro Yamada", 1},
+		{"全角・半角と大文字小文字", "Ｔａｒｏ　ＹＡＭＡＤＡ", "taro yamada", 1},
+		{"姓名の順序", "Yamada Taro", "Taro Yamada", 1},
+		{"カタカナとローマ字", "ヤマダ タロウ", "Taro Yamada", 1},
+		{"半角カナとひらがな", "ﾔﾏﾀﾞ ﾀﾛｳ", "やまだ たろう", 1},
+		{"ヘボン式と訓令式", "Shinichi Tsuchiya", "Siniti Tutiya", 1},
+		{"拗音・促音と長音", "ハットリ ジュン オオノ", "Jun Hattori Ohno", 1},
+		{"括弧書きの注記", "山田 太郎 (業務委託)", "山田　太郎", 1},
+		{"一部の違い", "Taro Yamada", "Taro Yamda", 0.9},
+		{"別人", "Taro Yamada", "Hanako Suzuki", 0.17},
+		{"漢字とローマ字は比較できない", "山田 太郎", "Taro Yamada", 0},
+		{"空の表示名", "", "Taro Yamada", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, identity.NameSimilarity(tt.a, tt.b))
+		})
+	}
+}
+
+func TestMergeIdentitiesMinNameSimilarity(t *testing.T) {
+	logger.Init()
+	identity.SetNoMask(true)
+	t.Cleanup(func() { identity.SetNoMask(false) })
+
+	identities := []admina.Identity{
+		{ID: "100", PeopleID: 101, DisplayName: "Taro Yamada", ManagementType: "managed", Email: "taro@parent.domain.com"},
+		{ID: "200", PeopleID: 202, DisplayName: "ヤマダ タロウ", ManagementType: "external", Email: "taro@child.domain.com"},
+		{ID: "110", PeopleID: 111, DisplayName: "Jiro Sato", ManagementType: "managed", Email: "jiro@parent.domain.com"},
+		{ID: "210", PeopleID: 212, DisplayName: "Jiro Tanaka", ManagementType: "external", Email: "jiro@child.domain.com"},
+	}
+	newConfig := func(t *testing.T) *identity.MergeConfig {
+		return &identity.MergeConfig{
+			ParentDomain:      "parent.domain.com",
+			ChildDomains:      []string{"child.domain.com"},
+			AutoApprove:       true,
+			OutputFormat:      "json",
+			OutputDir:         t.TempDir(),
+			OutputDirMode:     "overwrite",
+			CSV:               identity.CSVOptions{Columns: []string{"ChildIdentityID", "Status", "Reason", "NameSimilarity"}},
+			MinNameSimilarity: 0.8,
+		}
+	}
+	readMappings := func(t *testing.T, outputDir string) [][]string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outputDir, "identity_mappings.csv"))
+		require.NoError(t, err)
+		return readCSV(t, content)
+	}
+
+	t.Run("類似度の低い候補はマージせず NeedsReview にする", func(t *testing.T) {
+		client := &mock.Client{Identities: identities}
+		config := newConfig(t)
+		require.NoError(t, identity.MergeIdentities(client, config))
+		require.Len(t, client.MergeResults, 1)
+		assert.Equal(t, 202, client.MergeResults[0].FromPeopleID)
+
+		mappings := readMappings(t, config.OutputDir)
+		assert.Equal(t, []string{"200", "Success", "", "1.00"}, mappings[1])
+		assert.Equal(t, []string{"210", "NeedsReview", "display name similarity 0.50 is below 0.80", "0.50"}, mappings[2])
+
+		manifest, err := identity.ReadManifest(config.OutputDir)
+		require.NoError(t, err)
+		assert.Equal(t, 0.8, manifest.MinNameSimilarity)
+		assert.Equal(t, 1, manifest.Skipped)
+	})
+
+	t.Run("dry-run でも NeedsReview を出力する", func(t *testing.T) {
+		client := &mock.Client{Identities: identities}
+		config := newConfig(t)
+		config.DryRun = true
+		require.NoError(t, identity.MergeIdentities(client, config))
+		assert.Equal(t, "NeedsReview", readMappings(t, config.OutputDir)[2][1])
+	})
+
+	t.Run("指定しない場合は判定しない", func(t *testing.T) {
+		client := &mock.Client{Identities: identities}
+		config := newConfig(t)
+		config.MinNameSimilarity = 0
+		require.NoError(t, identity.MergeIdentities(client, config))
+		assert.Len(t, client.MergeResults, 2)
+		assert.Equal(t, []string{"210", "Success", "", "0.50"}, readMappings(t, config.OutputDir)[2])
+	})
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutdirModes は --outdir への出力方法です
+//
+//	timestamped  実行ごとに data-<日時>-<実行ID> ディレクトリを作成します (デフォルト)
+//	overwrite    --outdir に直接書き込み、同名のファイルのみ上書きします
+//	append       --outdir に直接書き込み、既存のCSVファイルには行を追記します
+var OutdirModes = []string{"timestamped", "overwrite", "append"}
+
+// DefaultOutdirMode は --outdir-mode を指定しない場合の出力方法です
+const DefaultOutdirMode = "timestamped"
+
+// LatestFileName は最新の実行ディレクトリ名を記録するファイルです
+const LatestFileName = "latest"
+
+// OutputRun は1回の実行の出力先です
+// 既存のファイルやディレクトリを削除することはありません
+type OutputRun struct {
+	Mode      string
+	BaseDir   string
+	Dir       string
+	RunID     string
+	StartedAt time.Time
+}
+
+// NewOutputRun は出力先を決定します。ディレクトリは Prepare で作成されます
+func NewOutputRun(baseDir, mode string, now time.Time) (*OutputRun, error) {
+	if baseDir == "" {
+		baseDir = "out"
+	}
+	if mode == "" {
+		mode = DefaultOutdirMode
+	}
+	if !contains(OutdirModes, mode) {
+		return nil, fmt.Errorf("unknown outdir mode: %s (available: %s)", mode, strings.Join(OutdirModes, ", "))
+	}
+
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &OutputRun{
+		Mode:      mode,
+		BaseDir:   baseDir,
+		Dir:       baseDir,
+		RunID:     runID,
+		StartedAt: now,
+	}
+	if mode == "timestamped" {
+		run.Dir = filepath.Join(baseDir, fmt.Sprintf("data-%s-%s", now.Format("20060102-150405"), runID))
+	}
+	return run, nil
+}
+
+// Prepare は出力ディレクトリを作成し、timestamped の場合は latest を更新します
+func (r *OutputRun) Prepare() error {
+	if err := os.MkdirAll(r.Dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if r.Mode != "timestamped" {
+		return nil
+	}
+
+	// 書き込み途中の latest を読まれないように一時ファイルから置き換える
+	latestPath := filepath.Join(r.BaseDir, LatestFileName)
+	tmpPath := latestPath + ".tmp-" + r.RunID
+	if err := os.WriteFile(tmpPath, []byte(filepath.Base(r.Dir)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write latest pointer: %v", err)
+	}
+	if err := os.Rename(tmpPath, latestPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write latest pointer: %v", err)
+	}
+	return nil
+}
+
+// Append は既存のCSVファイルに行を追記するかを返します
+func (r *OutputRun) Append() bool {
+	return r.Mode == "append"
+}
+
+// LatestOutputDir は baseDir の latest が指す最新の実行ディレクトリを返します
+func LatestOutputDir(baseDir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(baseDir, LatestFileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to read latest pointer: %w", err)
+	}
+	name := strings.TrimSpace(string(content))
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid latest pointer in %s: %q", baseDir, name)
+	}
+	return filepath.Join(baseDir, name), nil
+}
+
+func newRunID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate run id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
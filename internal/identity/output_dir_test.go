@@ -0,0 +1,123 @@
+package identity_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	mock "github.com/moneyforward-i/admina-sysutils/internal/admina/mock"
+	"github.com/moneyforward-i/admina-sysutils/internal/identity"
+	"github.com/moneyforward-i/admina-sysutils/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOutputRun(t *testing.T) {
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	run, err := identity.NewOutputRun("out", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, "timestamped", run.Mode)
+	assert.Len(t, run.RunID, 8)
+	assert.Equal(t, filepath.Join("out", "data-20240304-050607-"+run.RunID), run.Dir)
+
+	other, err := identity.NewOutputRun("out", "timestamped", now)
+	require.NoError(t, err)
+	assert.NotEqual(t, run.Dir, other.Dir, "同時刻の実行でも別のディレクトリになる")
+
+	overwrite, err := identity.NewOutputRun("out", "overwrite", now)
+	require.NoError(t, err)
+	assert.Equal(t, "out", overwrite.Dir)
+
+	_, err = identity.NewOutputRun("out", "replace", now)
+	assert.Error(t, err)
+}
+
+func TestOutputRunPrepare(t *testing.T) {
+	baseDir := t.TempDir()
+	existing := filepath.Join(baseDir, "keep.txt")
+	require.NoError(t, os.WriteFile(existing, []byte("keep"), 0644))
+
+	run, err := identity.NewOutputRun(baseDir, "timestamped", time.Now())
+	require.NoError(t, err)
+	require.NoError(t, run.Prepare())
+
+	assert.DirExists(t, run.Dir)
+	assert.FileExists(t, existing, "既存のファイルは削除されない")
+
+	latest, err := identity.LatestOutputDir(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, run.Dir, latest)
+
+	_, err = identity.LatestOutputDir(t.TempDir())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMergeIdentitiesOutdirModes(t *testing.T) {
+	logger.Init()
+
+	merge := func(t *testing.T, outputDir, mode string) {
+		t.Helper()
+		err := identity.MergeIdentities(&mock.Client{Identities: testIdentities}, &identity.MergeConfig{
+			ParentDomain:  "parent.domain.com",
+			ChildDomains:  []string{"child.domain.com"},
+			DryRun:        true,
+			AutoApprove:   true,
+			OutputFormat:  "json",
+			OutputDir:     outputDir,
+			OutputDirMode: mode,
+		})
+		require.NoError(t, err)
+	}
+
+	countLines := func(t *testing.T, path string) int {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return len(strings.Split(strings.TrimSpace(string(content)), "\n"))
+	}
+
+	t.Run("timestamped は実行ごとにディレクトリを作成し既存データを残す", func(t *testing.T) {
+		outputDir := t.TempDir()
+		existing := filepath.Join(outputDir, "cache", "identities.jsonl")
+		require.NoError(t, os.MkdirAll(filepath.Dir(existing), os.ModePerm))
+		require.NoError(t, os.WriteFile(existing, []byte("{}"), 0644))
+
+		merge(t, outputDir, "timestamped")
+		first, err := identity.LatestOutputDir(outputDir)
+		require.NoError(t, err)
+		merge(t, outputDir, "")
+		second, err := identity.LatestOutputDir(outputDir)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, first, second)
+		assert.FileExists(t, filepath.Join(first, "identity_mappings.csv"))
+		assert.FileExists(t, filepath.Join(second, "identity_mappings.csv"))
+		assert.FileExists(t, existing)
+	})
+
+	t.Run("overwrite は同名のファイルのみ置き換える", func(t *testing.T) {
+		outputDir := t.TempDir()
+		other := filepath.Join(outputDir, "notes.txt")
+		require.NoError(t, os.WriteFile(other, []byte("keep"), 0644))
+
+		merge(t, outputDir, "overwrite")
+		merge(t, outputDir, "overwrite")
+
+		assert.Equal(t, 2, countLines(t, filepath.Join(outputDir, "identity_mappings.csv")))
+		assert.FileExists(t, other)
+		assert.NoFileExists(t, filepath.Join(outputDir, identity.LatestFileName))
+	})
+
+	t.Run("append は既存のCSVに行を追記する", func(t *testing.T) {
+		outputDir := t.TempDir()
+
+		merge(t, outputDir, "append")
+		merge(t, outputDir, "append")
+
+		path := filepath.Join(outputDir, "identity_mappings.csv")
+		assert.Equal(t, 3, countLines(t, path), "ヘッダーは1回だけ書き込まれる")
+	})
+}
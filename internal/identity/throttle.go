@@ -0,0 +1,26 @@
+package identity
+
+import "time"
+
+// DefaultRequestInterval は作成・削除などの更新系APIを連続して呼び出す際の最小間隔です
+const DefaultRequestInterval = 500 * time.Millisecond
+
+// requestThrottle は API の呼び出しが interval より短い間隔にならないように待機します
+type requestThrottle struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func newRequestThrottle(interval time.Duration) *requestThrottle {
+	return &requestThrottle{interval: interval}
+}
+
+// Wait は前回の呼び出しから interval が経過するまで待機します
+func (t *requestThrottle) Wait() {
+	if !t.last.IsZero() && t.interval > 0 {
+		if wait := t.interval - time.Since(t.last); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	t.last = time.Now()
+}
@@ -1,6 +1,8 @@
 package organization
 
 import (
+	"fmt"
+
 	"github.com/moneyforward-i/admina-sysutils/internal/admina"
 	"github.com/moneyforward-i/admina-sysutils/internal/logger"
 )
@@ -9,11 +11,23 @@ type Client interface {
 	GetOrganization() (*admina.Organization, error)
 }
 
+// HeaderLines returns the organization summary lines shown by PrintInfo and in reports
+func HeaderLines(org *admina.Organization) []string {
+	if org == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("%s | %s | %d (%s)", org.Name, org.UniqueName, org.ID, org.Status),
+		fmt.Sprintf("Language: %s | Location: %s | TimeZone: %s", org.SystemLanguage, org.Location, org.TimeZone),
+		fmt.Sprintf("Domains: %v", org.Domains),
+	}
+}
+
 // PrintInfo prints organization information in a formatted way
 func PrintInfo(org *admina.Organization) {
 	logger.LogInfo("-----------------------------------------------------------------")
-	logger.LogInfo("%s | %s | %d (%s)", org.Name, org.UniqueName, org.ID, org.Status)
-	logger.LogInfo("Language: %s | Location: %s | TimeZone: %s", org.SystemLanguage, org.Location, org.TimeZone)
-	logger.LogInfo("Domains: %v", org.Domains)
+	for _, line := range HeaderLines(org) {
+		logger.LogInfo("%s", line)
+	}
 	logger.LogInfo("-----------------------------------------------------------------")
 }
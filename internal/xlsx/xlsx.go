@@ -0,0 +1,259 @@
+// Package xlsx は外部ライブラリを使わずに最小限の Excel ワークブック (.xlsx) を書き出します
+//
+// 対応しているのは文字列・数値セル、太字、ウィンドウ枠の固定のみです
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxSheetNameLength は Excel のシート名の最大文字数です
+const maxSheetNameLength = 31
+
+// Cell はワークシートの1セルです
+type Cell struct {
+	Text     string
+	Number   float64
+	IsNumber bool
+	Bold     bool
+}
+
+// String は文字列セルを作成します
+func String(text string) Cell {
+	return Cell{Text: text}
+}
+
+// Number は数値セルを作成します
+func Number(number float64) Cell {
+	return Cell{Number: number, IsNumber: true}
+}
+
+// Sheet はワークシートです
+type Sheet struct {
+	Name string
+	Rows [][]Cell
+	// FreezeRows, FreezeColumns は固定する先頭の行数・列数です
+	FreezeRows    int
+	FreezeColumns int
+}
+
+// Workbook は複数のワークシートを持つワークブックです
+type Workbook struct {
+	sheets []*Sheet
+}
+
+// NewWorkbook は空のワークブックを作成します
+func NewWorkbook() *Workbook {
+	return &Workbook{}
+}
+
+// AddSheet はワークシートを追加します
+// シート名は Excel で使用できない文字を置き換え、重複しないように調整します
+func (w *Workbook) AddSheet(name string, rows [][]Cell) *Sheet {
+	sheet := &Sheet{Name: w.uniqueSheetName(name), Rows: rows}
+	w.sheets = append(w.sheets, sheet)
+	return sheet
+}
+
+// Sheets は追加されたワークシートを返します
+func (w *Workbook) Sheets() []*Sheet {
+	return w.sheets
+}
+
+// Write はワークブックを xlsx 形式で書き出します
+func (w *Workbook) Write(out io.Writer) error {
+	if len(w.sheets) == 0 {
+		return fmt.Errorf("workbook has no sheets")
+	}
+
+	archive := zip.NewWriter(out)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", w.contentTypes()},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", w.workbook()},
+		{"xl/_rels/workbook.xml.rels", w.workbookRels()},
+		{"xl/styles.xml", styles},
+	}
+	for i, sheet := range w.sheets {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", file.name, err)
+		}
+		if _, err := io.WriteString(writer, file.content); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// Bytes はワークブックを xlsx 形式のバイト列で返します
+func (w *Workbook) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := w.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Workbook) uniqueSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+	base := truncate(name, maxSheetNameLength)
+
+	candidate := base
+	for n := 2; w.hasSheet(candidate); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = truncate(base, maxSheetNameLength-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+func (w *Workbook) hasSheet(name string) bool {
+	for _, sheet := range w.sheets {
+		if strings.EqualFold(sheet.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return s
+}
+
+func (w *Workbook) contentTypes() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range w.sheets {
+		b.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1))
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func (w *Workbook) workbook() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range w.sheets {
+		b.WriteString(fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheet.Name), i+1, i+1))
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func (w *Workbook) workbookRels() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range w.sheets {
+		b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1))
+	}
+	b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1))
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+func (s *Sheet) xml() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	if s.FreezeRows > 0 || s.FreezeColumns > 0 {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane`)
+		if s.FreezeColumns > 0 {
+			b.WriteString(fmt.Sprintf(` xSplit="%d"`, s.FreezeColumns))
+		}
+		if s.FreezeRows > 0 {
+			b.WriteString(fmt.Sprintf(` ySplit="%d"`, s.FreezeRows))
+		}
+		activePane := "bottomRight"
+		if s.FreezeColumns == 0 {
+			activePane = "bottomLeft"
+		} else if s.FreezeRows == 0 {
+			activePane = "topRight"
+		}
+		b.WriteString(fmt.Sprintf(` topLeftCell="%s" activePane="%s" state="frozen"/></sheetView></sheetViews>`,
+			CellRef(s.FreezeRows, s.FreezeColumns), activePane))
+	}
+
+	b.WriteString(`<sheetData>`)
+	for i, row := range s.Rows {
+		b.WriteString(fmt.Sprintf(`<row r="%d">`, i+1))
+		for j, cell := range row {
+			style := ""
+			if cell.Bold {
+				style = ` s="1"`
+			}
+			if cell.IsNumber {
+				b.WriteString(fmt.Sprintf(`<c r="%s"%s><v>%s</v></c>`, CellRef(i, j), style, strconv.FormatFloat(cell.Number, 'f', -1, 64)))
+			} else {
+				b.WriteString(fmt.Sprintf(`<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, CellRef(i, j), style, escape(cell.Text)))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// CellRef は0始まりの行・列番号を A1 形式のセル参照に変換します
+func CellRef(row, column int) string {
+	name := ""
+	for n := column + 1; n > 0; n = (n - 1) / 26 {
+		name = string(rune('A'+(n-1)%26)) + name
+	}
+	return name + strconv.Itoa(row+1)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// styles はデフォルト (s="0") と太字 (s="1") の2つのセルスタイルを定義します
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,96 @@
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/moneyforward-i/admina-sysutils/internal/xlsx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+
+		// すべてのパーツが整形式の XML であること
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, file.Name)
+		}
+		files[file.Name] = string(content)
+	}
+	return files
+}
+
+func TestWorkbookWrite(t *testing.T) {
+	workbook := xlsx.NewWorkbook()
+	sheet := workbook.AddSheet("Matrix", [][]xlsx.Cell{
+		{{Text: "managementType", Bold: true}, {Text: "active & <new>", Bold: true}},
+		{xlsx.String("managed"), xlsx.Number(12)},
+		{xlsx.String("external"), xlsx.Number(2.5)},
+	})
+	sheet.FreezeRows = 1
+	sheet.FreezeColumns = 1
+	workbook.AddSheet("Matrix", [][]xlsx.Cell{{xlsx.String("x")}})
+
+	data, err := workbook.Bytes()
+	require.NoError(t, err)
+	files := readZip(t, data)
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		assert.Contains(t, files, name)
+	}
+
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Matrix" sheetId="1" r:id="rId1"/>`)
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Matrix (2)" sheetId="2" r:id="rId2"/>`)
+
+	sheet1 := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet1, `<pane xSplit="1" ySplit="1" topLeftCell="B2" activePane="bottomRight" state="frozen"/>`)
+	assert.Contains(t, sheet1, `<c r="B1" t="inlineStr" s="1"><is><t xml:space="preserve">active &amp; &lt;new&gt;</t></is></c>`)
+	assert.Contains(t, sheet1, `<c r="B2"><v>12</v></c>`)
+	assert.Contains(t, sheet1, `<c r="B3"><v>2.5</v></c>`)
+}
+
+func TestWorkbookSheetNames(t *testing.T) {
+	workbook := xlsx.NewWorkbook()
+	workbook.AddSheet("a/b:c", nil)
+	workbook.AddSheet("", nil)
+	workbook.AddSheet("abcdefghijklmnopqrstuvwxyz0123456789", nil)
+	workbook.AddSheet("abcdefghijklmnopqrstuvwxyz0123456789", nil)
+
+	names := []string{}
+	for _, sheet := range workbook.Sheets() {
+		names = append(names, sheet.Name)
+	}
+	assert.Equal(t, []string{"a_b_c", "Sheet", "abcdefghijklmnopqrstuvwxyz01234", "abcdefghijklmnopqrstuvwxyz0 (2)"}, names)
+}
+
+func TestWorkbookWithoutSheets(t *testing.T) {
+	_, err := xlsx.NewWorkbook().Bytes()
+	assert.Error(t, err)
+}
+
+func TestCellRef(t *testing.T) {
+	assert.Equal(t, "A1", xlsx.CellRef(0, 0))
+	assert.Equal(t, "Z10", xlsx.CellRef(9, 25))
+	assert.Equal(t, "AA1", xlsx.CellRef(0, 26))
+	assert.Equal(t, "AZ2", xlsx.CellRef(1, 51))
+	assert.Equal(t, "BA3", xlsx.CellRef(2, 52))
+}